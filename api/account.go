@@ -1,12 +1,15 @@
 package api
 
 import (
-	"database/sql"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
 	"github.com/pawpaw2022/simplebank/token"
 )
 
@@ -21,7 +24,7 @@ func (server *Server) createAccount(ctx *gin.Context) {
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
 		return
 	}
 
@@ -29,34 +32,24 @@ func (server *Server) createAccount(ctx *gin.Context) {
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	// Create the account
-	account, err := server.store.CreateAccount(ctx, db.CreateAccountParams{
-		Owner:    authPayload.Username,
-		Balance:  0,
-		Currency: req.Currency,
+	account, err := server.store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+		CreateAccountParams: db.CreateAccountParams{
+			Owner:    authPayload.Username,
+			Balance:  0,
+			Currency: req.Currency,
+		},
+		Audit: auditParams(ctx, authPayload.Username),
 	})
 
 	if err != nil {
-
-		// // Check if the error is pq.Error
-		// if pqErr, ok := err.(*pq.Error); ok {
-		// 	// print the error code name
-		// 	// log.Println("pqErr:", pqErr.Code.Name())
-		// 	switch pqErr.Code.Name() {
-		// 	// return 403 if user not found or user_account already exists
-		// 	case "unique_violation", "foreign_key_violation":
-		// 		ctx.JSON(http.StatusForbidden, errorResponse(err))
-		// 		return
-		// 	}
-		// }
-
-		errCode := db.ErrorCode(err)
-		if errCode == db.ForeignKeyViolation || errCode == db.UniqueViolation {
-			ctx.JSON(http.StatusForbidden, errorResponse(err))
-			return
+		switch db.ErrorCode(err) {
+		case db.UniqueViolation:
+			err = apperr.Wrap(err, apperr.CodeAlreadyExists, fmt.Sprintf("user already has a %s account", req.Currency))
+		case db.ForeignKeyViolation:
+			err = apperr.Wrap(err, apperr.CodeNotFound, "owner not found")
 		}
 
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
@@ -68,14 +61,14 @@ type GetAccountParams struct {
 	ID int64 `uri:"id" binding:"required,min=1"` // uri: path parameter
 }
 
-// Authorization: A logged-in user can only get his own account.
+// Authorization: A logged-in user can only get his own account, bankers can get any account.
 func (server *Server) getAccount(ctx *gin.Context) {
 	var req GetAccountParams
 
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindUri(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
 		return
 	}
 
@@ -83,22 +76,17 @@ func (server *Server) getAccount(ctx *gin.Context) {
 	account, err := server.store.GetAccount(ctx, req.ID)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrRecordNotFound) {
 			// Account not found
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return
+			err = apperr.Wrap(err, apperr.CodeNotFound, "account not found")
 		}
 
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
-	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
-	if account.Owner != authPayload.Username {
-		// Forbidden
-		err := errors.New("account doesn't belong to the authenticated user")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+	if !canAccess(ctx, account.Owner) {
+		abortWithError(ctx, apperr.New(apperr.CodeForbidden, "account doesn't belong to the authenticated user"))
 		return
 	}
 
@@ -107,8 +95,14 @@ func (server *Server) getAccount(ctx *gin.Context) {
 }
 
 type ListAccountParams struct {
-	PageID   int32 `form:"page_id" binding:"required,min=1"` // form: query parameter
-	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
+	PageID   int32  `form:"page_id" binding:"omitempty,min=1"` // form: query parameter. Deprecated: use cursor
+	PageSize int32  `form:"page_size" binding:"required,min=5,max=10"`
+	Cursor   string `form:"cursor" binding:"excluded_with=PageID"` // next_cursor of the previous page, empty for the first page
+}
+
+type ListAccountsResponse struct {
+	Accounts   []db.Account `json:"accounts"`
+	NextCursor string       `json:"next_cursor,omitempty"` // empty on the last page
 }
 
 // Authorization: A logged-in user can only list his own accounts.
@@ -118,14 +112,54 @@ func (server *Server) listAccounts(ctx *gin.Context) {
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindQuery(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
 		return
 	}
 
 	// Get the owner from the token
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if req.PageID > 0 {
+		server.listAccountsByPage(ctx, authPayload.Username, req)
+		return
+	}
+
+	cursor, err := page.DecodeCursor(req.Cursor)
+	if err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.InvalidField("cursor", err.Error()))
+		return
+	}
+
+	// Fetch one more row than the page size to know if there is a next page
+	accounts, err := server.store.ListAccountsAfter(ctx, db.ListAccountsAfterParams{
+		Owner:          authPayload.Username,
+		AfterCreatedAt: cursor.CreatedAt,
+		AfterID:        cursor.ID,
+		Limit:          req.PageSize + 1,
+	})
+	if err != nil {
+		// Database Error
+		abortWithError(ctx, err)
+		return
+	}
+
+	accounts, nextCursor := page.Next(accounts, req.PageSize, func(account db.Account) page.Cursor {
+		return page.Cursor{CreatedAt: account.CreatedAt, ID: account.ID}
+	})
+
+	ctx.JSON(http.StatusOK, ListAccountsResponse{
+		Accounts:   accounts,
+		NextCursor: nextCursor,
+	})
+}
+
+// listAccountsByPage serves the deprecated offset pagination with page_id.
+func (server *Server) listAccountsByPage(ctx *gin.Context, owner string, req ListAccountParams) {
+	deprecatePageID(ctx)
+
 	arg := db.ListAccountsParams{
-		Owner:  authPayload.Username,
+		Owner:  owner,
 		Limit:  req.PageSize,
 		Offset: (req.PageID - 1) * req.PageSize,
 	}
@@ -134,14 +168,12 @@ func (server *Server) listAccounts(ctx *gin.Context) {
 	accounts, err := server.store.ListAccounts(ctx, arg)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrRecordNotFound) {
 			// Account not found
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return
+			err = apperr.Wrap(err, apperr.CodeNotFound, "account not found")
 		}
 
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
@@ -154,5 +186,76 @@ type UpdateAccountBalanceUri struct {
 }
 
 type UpdateAccountBalanceJSON struct {
-	Amount int64 `json:"amount" binding:"required,ne=0"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
+	Currency  string `json:"currency" binding:"required,currency"`
+	Reference string `json:"reference" binding:"required,max=100"` // reference of the external cash movement
+}
+
+// Authorization: Only bankers can deposit, into any account, once they have received the cash.
+func (server *Server) createDeposit(ctx *gin.Context) {
+	server.updateAccountBalance(ctx, server.store.DepositTx)
+}
+
+// Authorization: A logged-in user can only withdraw from his own account, bankers can withdraw from any account.
+func (server *Server) createWithdrawal(ctx *gin.Context) {
+	server.updateAccountBalance(ctx, server.store.WithdrawTx)
+}
+
+// updateAccountBalance validates a deposit or withdrawal request and runs it with the given store transaction.
+func (server *Server) updateAccountBalance(
+	ctx *gin.Context,
+	cashTx func(context.Context, db.CashTxParams) (db.CashTxResult, error),
+) {
+	var uri UpdateAccountBalanceUri
+	var req UpdateAccountBalanceJSON
+
+	// Assign the path parameter and request body
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	// Get the account
+	account, err := server.store.GetAccount(ctx, uri.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			// Account not found
+			err = apperr.Wrap(err, apperr.CodeNotFound, "account not found")
+		}
+
+		abortWithError(ctx, err)
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccess(ctx, account.Owner) {
+		abortWithError(ctx, apperr.New(apperr.CodeForbidden, "account doesn't belong to the authenticated user"))
+		return
+	}
+
+	// Validate the currency
+	if account.Currency != req.Currency {
+		abortWithError(ctx, apperr.Newf(apperr.CodeCurrencyMismatch, "accountID [%d] currency mismatch: %s vs %s", account.ID, account.Currency, req.Currency))
+		return
+	}
+
+	result, err := cashTx(ctx, db.CashTxParams{
+		AccountID: account.ID,
+		Amount:    req.Amount,
+		Reference: req.Reference,
+		Audit:     auditParams(ctx, authPayload.Username),
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
 }
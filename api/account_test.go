@@ -12,8 +12,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
 	mockdb "github.com/pawpaw2022/simplebank/db/mock"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
 	"github.com/pawpaw2022/simplebank/token"
 	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
@@ -35,7 +37,7 @@ func TestGetAccountAPI(t *testing.T) {
 			name:      "OK",
 			accountID: account.ID,
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
@@ -52,7 +54,7 @@ func TestGetAccountAPI(t *testing.T) {
 			name:      "UnauthorizedUser",
 			accountID: account.ID,
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorized_user", time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorized_user", util.DepositorRole, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
@@ -61,7 +63,40 @@ func TestGetAccountAPI(t *testing.T) {
 					Return(account, nil)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name:      "BankerReadsAnyAccount",
+			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchAccount(t, recorder.Body, account)
+			},
+		},
+		{
+			name:      "AdminForbidden",
+			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
 			},
 		},
 		{
@@ -83,13 +118,13 @@ func TestGetAccountAPI(t *testing.T) {
 			name:      "NotFound",
 			accountID: account.ID,
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
 					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
 					Times(1).
-					Return(db.Account{}, sql.ErrNoRows)
+					Return(db.Account{}, db.ErrRecordNotFound)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
@@ -99,7 +134,7 @@ func TestGetAccountAPI(t *testing.T) {
 			name:      "InternalError",
 			accountID: account.ID,
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
@@ -115,7 +150,7 @@ func TestGetAccountAPI(t *testing.T) {
 			name:      "BadRequest: invalid ID",
 			accountID: 0,
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
@@ -175,10 +210,15 @@ func TestListAccountsAPI(t *testing.T) {
 	}
 
 	type Query struct {
-		pageID   int
+		pageID   int // deprecated offset pagination, omitted if zero
 		pageSize int
+		cursor   string
 	}
 
+	// the stub returns one more account than the page size when there is a next page
+	moreAccounts := append(append([]db.Account{}, accounts...), randomAccount(user.Username))
+	lastCursor := page.Cursor{CreatedAt: accounts[n-1].CreatedAt, ID: accounts[n-1].ID}
+
 	testCases := []struct {
 		name       string
 		query      Query
@@ -193,7 +233,7 @@ func TestListAccountsAPI(t *testing.T) {
 				pageSize: n,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 
@@ -210,6 +250,7 @@ func TestListAccountsAPI(t *testing.T) {
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(deprecationHeaderKey))
 				requireBodyMatchAccounts(t, recorder.Body, accounts)
 			},
 		},
@@ -240,7 +281,7 @@ func TestListAccountsAPI(t *testing.T) {
 				pageSize: n,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				args := db.ListAccountsParams{
@@ -252,7 +293,7 @@ func TestListAccountsAPI(t *testing.T) {
 				store.EXPECT().
 					ListAccounts(gomock.Any(), gomock.Eq(args)).
 					Times(1).
-					Return([]db.Account{}, sql.ErrNoRows)
+					Return([]db.Account{}, db.ErrRecordNotFound)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
@@ -265,7 +306,7 @@ func TestListAccountsAPI(t *testing.T) {
 				pageSize: n,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				args := db.ListAccountsParams{
@@ -283,14 +324,111 @@ func TestListAccountsAPI(t *testing.T) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "OK Cursor First Page",
+			query: Query{
+				pageSize: n,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				args := db.ListAccountsAfterParams{
+					Owner:          user.Username,
+					AfterCreatedAt: time.Time{},
+					AfterID:        0,
+					Limit:          int32(n + 1),
+				}
+
+				store.EXPECT().
+					ListAccountsAfter(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(moreAccounts, nil)
+				store.EXPECT().
+					ListAccounts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(deprecationHeaderKey))
+				requireBodyMatchAccountsPage(t, recorder.Body, accounts, lastCursor.Encode())
+			},
+		},
+		{
+			name: "OK Cursor Last Page",
+			query: Query{
+				pageSize: n,
+				cursor:   lastCursor.Encode(),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				args := db.ListAccountsAfterParams{
+					Owner:          user.Username,
+					AfterCreatedAt: lastCursor.CreatedAt,
+					AfterID:        lastCursor.ID,
+					Limit:          int32(n + 1),
+				}
+
+				store.EXPECT().
+					ListAccountsAfter(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(accounts[:2], nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchAccountsPage(t, recorder.Body, accounts[:2], "")
+			},
+		},
+		{
+			name: "BadRequest: invalid cursor",
+			query: Query{
+				pageSize: n,
+				cursor:   "not-a-cursor",
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAccountsAfter(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "BadRequest: both page_id and cursor",
+			query: Query{
+				pageID:   1,
+				pageSize: n,
+				cursor:   lastCursor.Encode(),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAccounts(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					ListAccountsAfter(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
 		{
 			name: "BadRequest: invalid page_id",
 			query: Query{
-				pageID:   0,
+				pageID:   -1,
 				pageSize: n,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 
@@ -327,8 +465,13 @@ func TestListAccountsAPI(t *testing.T) {
 
 			// Add query parameters to request URL
 			q := request.URL.Query()
-			q.Add("page_id", fmt.Sprintf("%d", tc.query.pageID))
+			if tc.query.pageID != 0 {
+				q.Add("page_id", fmt.Sprintf("%d", tc.query.pageID))
+			}
 			q.Add("page_size", fmt.Sprintf("%d", tc.query.pageSize))
+			if tc.query.cursor != "" {
+				q.Add("cursor", tc.query.cursor)
+			}
 			request.URL.RawQuery = q.Encode()
 
 			// Setup authorization
@@ -362,17 +505,20 @@ func TestCreateAccountAPI(t *testing.T) {
 				"currency": account.Currency,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
-				args := db.CreateAccountParams{
-					Owner:    user.Username,
-					Currency: account.Currency,
-					Balance:  0,
+				args := db.CreateAccountTxParams{
+					CreateAccountParams: db.CreateAccountParams{
+						Owner:    user.Username,
+						Currency: account.Currency,
+						Balance:  0,
+					},
+					Audit: db.AuditParams{Actor: user.Username},
 				}
 				// Build stubs
 				store.EXPECT().
-					CreateAccount(gomock.Any(), gomock.Eq(args)).
+					CreateAccountTx(gomock.Any(), gomock.Eq(args)).
 					Times(1).
 					Return(account, nil)
 			},
@@ -393,7 +539,7 @@ func TestCreateAccountAPI(t *testing.T) {
 
 				// Build stubs
 				store.EXPECT().
-					CreateAccount(gomock.Any(), gomock.Any()).
+					CreateAccountTx(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -407,16 +553,12 @@ func TestCreateAccountAPI(t *testing.T) {
 				"currency": "invalid_currency",
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
-				args := db.CreateAccountParams{
-					Currency: "",
-					Balance:  0,
-				}
 				// Build stubs
 				store.EXPECT().
-					CreateAccount(gomock.Any(), gomock.Eq(args)).
+					CreateAccountTx(gomock.Any(), gomock.Any()).
 					Times(0).
 					Return(account, nil)
 			},
@@ -431,12 +573,12 @@ func TestCreateAccountAPI(t *testing.T) {
 				"currency": account.Currency,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// Build stubs
 				store.EXPECT().
-					CreateAccount(gomock.Any(), gomock.Any()).
+					CreateAccountTx(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(account, sql.ErrConnDone)
 			},
@@ -485,10 +627,261 @@ func TestCreateAccountAPI(t *testing.T) {
 
 }
 
+func TestUpdateAccountBalanceAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	amount := int64(10)
+	reference := util.RandomString(12)
+
+	testCases := []struct {
+		name       string
+		path       string
+		body       gin.H
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Deposit",
+			path: fmt.Sprintf("/accounts/%d/deposits", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CashTxParams{
+					AccountID: account.ID,
+					Amount:    amount,
+					Reference: reference,
+					Audit:     db.AuditParams{Actor: "banker"},
+				}
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Withdrawal",
+			path: fmt.Sprintf("/accounts/%d/withdrawals", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CashTxParams{
+					AccountID: account.ID,
+					Amount:    amount,
+					Reference: reference,
+					Audit:     db.AuditParams{Actor: user.Username},
+				}
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InsufficientFunds",
+			path: fmt.Sprintf("/accounts/%d/withdrawals", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					WithdrawTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.CashTxResult{}, db.ErrInsufficientFunds)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "DepositorDeposit",
+			path: fmt.Sprintf("/accounts/%d/deposits", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				// owning the account is not enough, the cash must go through a banker
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name: "BankerWithdrawal",
+			path: fmt.Sprintf("/accounts/%d/withdrawals", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "UnauthorizedUser",
+			path: fmt.Sprintf("/accounts/%d/withdrawals", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorized_user", util.DepositorRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name: "CurrencyMismatch",
+			path: fmt.Sprintf("/accounts/%d/deposits", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  otherCurrency(account.Currency),
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeCurrencyMismatch)
+			},
+		},
+		{
+			name: "NegativeAmount",
+			path: fmt.Sprintf("/accounts/%d/deposits", account.ID),
+			body: gin.H{
+				"amount":    -amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "AccountNotFound",
+			path: fmt.Sprintf("/accounts/%d/deposits", account.ID),
+			body: gin.H{
+				"amount":    amount,
+				"currency":  account.Currency,
+				"reference": reference,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Marshal body data to JSON
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, tc.path, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			// Setup authorization
+			tc.setupAuth(t, request, server.tokenMaker)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+// otherCurrency returns a supported currency different from the given one
+func otherCurrency(currency string) string {
+	if currency == util.USD {
+		return util.EUR
+	}
+	return util.USD
+}
+
 // randomAccount generates a random account for testing purposes
 func randomAccount(owner string) db.Account {
 	return db.Account{
-		ID:       util.RandomInt(0, 1000),
+		ID:       util.RandomInt(1, 1000),
 		Owner:    owner,
 		Balance:  util.RandomMoney(),
 		Currency: util.RandomCurrency(),
@@ -514,3 +907,14 @@ func requireBodyMatchAccounts(t *testing.T, body *bytes.Buffer, accounts []db.Ac
 	require.NoError(t, err)
 	require.Equal(t, accounts, gotAccounts)
 }
+
+func requireBodyMatchAccountsPage(t *testing.T, body *bytes.Buffer, accounts []db.Account, nextCursor string) {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var gotPage ListAccountsResponse
+	err = json.Unmarshal(data, &gotPage)
+	require.NoError(t, err)
+	require.Equal(t, accounts, gotPage.Accounts)
+	require.Equal(t, nextCursor, gotPage.NextCursor)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
+)
+
+// auditParams describes the client of the request, actor is the user performing the operation
+func auditParams(ctx *gin.Context, actor string) db.AuditParams {
+	return db.AuditParams{
+		Actor:     actor,
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
+
+type ListAuditEventsParams struct {
+	PageSize   int32     `form:"page_size" binding:"required,min=5,max=100"`
+	Cursor     string    `form:"cursor"`                                         // next_cursor of the previous page, empty for the first page
+	Actor      string    `form:"actor"`                                          // optional
+	Action     string    `form:"action"`                                         // optional, e.g. transfer.created
+	TargetType string    `form:"target_type"`                                    // optional, e.g. account
+	TargetID   string    `form:"target_id"`                                      // optional, only meaningful with target_type
+	StartTime  time.Time `form:"start_time"`                                     // optional, RFC 3339, inclusive
+	EndTime    time.Time `form:"end_time" binding:"omitempty,gtfield=StartTime"` // optional, RFC 3339, exclusive
+}
+
+type AuditEventResponse struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	ClientIP   string          `json:"client_ip"`
+	UserAgent  string          `json:"user_agent"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// newAuditEventResponse returns the before and after states as JSON instead of encoded bytes
+func newAuditEventResponse(event db.AuditEvent) AuditEventResponse {
+	rsp := AuditEventResponse{
+		ID:         event.ID,
+		Actor:      event.Actor,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		ClientIP:   event.ClientIp,
+		UserAgent:  event.UserAgent,
+		CreatedAt:  event.CreatedAt,
+	}
+
+	// a nil RawMessage would be encoded as an empty value, which is invalid JSON
+	if event.Before != nil {
+		rsp.Before = event.Before
+	}
+	if event.After != nil {
+		rsp.After = event.After
+	}
+
+	return rsp
+}
+
+type ListAuditEventsResponse struct {
+	AuditEvents []AuditEventResponse `json:"audit_events"`
+	NextCursor  string               `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// Authorization: only admins can read the audit log.
+func (server *Server) listAuditEvents(ctx *gin.Context) {
+	var req ListAuditEventsParams
+
+	// Assign the query parameters to the req variable
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	cursor, err := page.DecodeCursor(req.Cursor)
+	if err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.InvalidField("cursor", err.Error()))
+		return
+	}
+
+	endTime := req.EndTime
+	if endTime.IsZero() {
+		endTime = endOfTime
+	}
+
+	// Fetch one more row than the page size to know if there is a next page
+	events, err := server.store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		Actor:          req.Actor,
+		Action:         req.Action,
+		TargetType:     req.TargetType,
+		TargetID:       req.TargetID,
+		StartTime:      req.StartTime,
+		EndTime:        endTime,
+		AfterCreatedAt: cursor.CreatedAt,
+		AfterID:        cursor.ID,
+		Limit:          req.PageSize + 1,
+	})
+	if err != nil {
+		// Database Error
+		abortWithError(ctx, err)
+		return
+	}
+
+	events, nextCursor := page.Next(events, req.PageSize, func(event db.AuditEvent) page.Cursor {
+		return page.Cursor{CreatedAt: event.CreatedAt, ID: event.ID}
+	})
+
+	rsp := ListAuditEventsResponse{
+		AuditEvents: make([]AuditEventResponse, 0, len(events)),
+		NextCursor:  nextCursor,
+	}
+	for _, event := range events {
+		rsp.AuditEvents = append(rsp.AuditEvents, newAuditEventResponse(event))
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestListAuditEventsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	n := 5
+	events := make([]db.AuditEvent, n+1)
+	for i := range events {
+		events[i] = randomAuditEvent(user.Username)
+	}
+	lastCursor := page.Cursor{CreatedAt: events[n-1].CreatedAt, ID: events[n-1].ID}
+
+	type Query struct {
+		pageSize  int
+		cursor    string
+		actor     string
+		startTime string
+		endTime   string
+	}
+
+	testCases := []struct {
+		name       string
+		query      Query
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: Query{pageSize: n, actor: user.Username},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				args := db.ListAuditEventsParams{
+					Actor:   user.Username,
+					EndTime: endOfTime,
+					Limit:   int32(n + 1),
+				}
+
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(events, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp ListAuditEventsResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &rsp)
+				require.NoError(t, err)
+				require.Len(t, rsp.AuditEvents, n)
+				require.Equal(t, lastCursor.Encode(), rsp.NextCursor)
+
+				// the states are returned as JSON, a missing one as null
+				require.JSONEq(t, string(events[0].After), string(rsp.AuditEvents[0].After))
+				require.Equal(t, "null", string(rsp.AuditEvents[0].Before))
+			},
+		},
+		{
+			name:  "OK Cursor Time Range",
+			query: Query{pageSize: n, cursor: lastCursor.Encode(), startTime: "2023-09-01T00:00:00Z", endTime: "2023-10-01T00:00:00Z"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				args := db.ListAuditEventsParams{
+					StartTime:      time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC),
+					EndTime:        time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC),
+					AfterCreatedAt: lastCursor.CreatedAt,
+					AfterID:        lastCursor.ID,
+					Limit:          int32(n + 1),
+				}
+
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(events[:1], nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp ListAuditEventsResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &rsp)
+				require.NoError(t, err)
+				require.Len(t, rsp.AuditEvents, 1)
+				require.Empty(t, rsp.NextCursor)
+			},
+		},
+		{
+			name:  "Forbidden",
+			query: Query{pageSize: n},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:  "BadRequest: invalid cursor",
+			query: Query{pageSize: n, cursor: "not-a-cursor"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "BadRequest: page size",
+			query: Query{pageSize: 1000},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InternalError",
+			query: Query{pageSize: n},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]db.AuditEvent{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/audit_events", nil)
+			require.NoError(t, err)
+
+			// Add query parameters to request URL
+			q := request.URL.Query()
+			q.Add("page_size", fmt.Sprintf("%d", tc.query.pageSize))
+			for key, value := range map[string]string{
+				"cursor":     tc.query.cursor,
+				"actor":      tc.query.actor,
+				"start_time": tc.query.startTime,
+				"end_time":   tc.query.endTime,
+			} {
+				if value != "" {
+					q.Add(key, value)
+				}
+			}
+			request.URL.RawQuery = q.Encode()
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func randomAuditEvent(actor string) db.AuditEvent {
+	return db.AuditEvent{
+		ID:         util.RandomInt(1, 1000),
+		Actor:      actor,
+		Action:     db.AuditAccountCreated,
+		TargetType: db.AuditTargetAccount,
+		TargetID:   fmt.Sprint(util.RandomInt(1, 1000)),
+		ClientIp:   "127.0.0.1",
+		UserAgent:  "test",
+		After:      []byte(fmt.Sprintf(`{"owner": %q}`, actor)),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+}
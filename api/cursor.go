@@ -0,0 +1,13 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// deprecationHeaderKey marks responses to requests using page_id, which is superseded by cursor
+const deprecationHeaderKey = "Deprecation"
+
+// deprecatePageID tells the client page_id is deprecated in favour of cursor
+func deprecatePageID(ctx *gin.Context) {
+	ctx.Header(deprecationHeaderKey, "true")
+}
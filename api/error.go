@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/logger"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code      apperr.Code             `json:"code"`
+	Message   string                  `json:"message"`
+	Details   []apperr.FieldViolation `json:"details,omitempty"`
+	RequestID string                  `json:"request_id,omitempty"`
+}
+
+// httpStatus maps every error code to its HTTP status, unknown codes are internal errors
+var httpStatus = map[apperr.Code]int{
+	apperr.CodeValidationFailed:     http.StatusBadRequest,
+	apperr.CodeUnauthenticated:      http.StatusUnauthorized,
+	apperr.CodeForbidden:            http.StatusForbidden,
+	apperr.CodeEmailNotVerified:     http.StatusForbidden,
+	apperr.CodeTooManyAttempts:      http.StatusTooManyRequests,
+	apperr.CodeNotFound:             http.StatusNotFound,
+	apperr.CodeAlreadyExists:        http.StatusConflict,
+	apperr.CodeIdempotencyKeyReused: http.StatusConflict,
+	apperr.CodeInsufficientFunds:    http.StatusUnprocessableEntity,
+	apperr.CodeCurrencyMismatch:     http.StatusUnprocessableEntity,
+	apperr.CodeRateNotFound:         http.StatusUnprocessableEntity,
+	apperr.CodeInternal:             http.StatusInternalServerError,
+}
+
+// abortWithError ends the request with the error response of err, its code decides the HTTP status.
+// err is attached to the gin context so the request log has the cause, the client only gets the message.
+func abortWithError(ctx *gin.Context, err error) {
+	appErr := apperr.From(err)
+
+	status, ok := httpStatus[appErr.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	_ = ctx.Error(err)
+	ctx.AbortWithStatusJSON(status, ErrorResponse{
+		Code:      appErr.Code,
+		Message:   appErr.Message,
+		Details:   appErr.Violations,
+		RequestID: logger.RequestID(ctx.Request.Context()),
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestErrorResponse(t *testing.T) {
+	const requestID = "req-123"
+
+	testCases := []struct {
+		name       string
+		body       gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "ValidationFailed",
+			body: gin.H{
+				"username":  "user_!",
+				"password":  "secret",
+				"full_name": "John Doe",
+				"email":     "not-an-email",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+				rsp := requireBodyError(t, recorder.Body)
+				require.Equal(t, apperr.CodeValidationFailed, rsp.Code)
+				require.Equal(t, requestID, rsp.RequestID)
+
+				// Fields are named as the client sends them
+				require.ElementsMatch(t, []apperr.FieldViolation{
+					{Field: "username", Message: "must contain only letters and digits"},
+					{Field: "email", Message: "must be a valid email address"},
+				}, rsp.Details)
+			},
+		},
+		{
+			name: "MalformedJSON",
+			body: nil,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+				rsp := requireBodyError(t, recorder.Body)
+				require.Equal(t, apperr.CodeValidationFailed, rsp.Code)
+				require.Equal(t, "request body is not valid JSON", rsp.Message)
+			},
+		},
+		{
+			name: "InternalErrorHidesCause",
+			body: gin.H{
+				"username":  "johndoe",
+				"password":  "secret",
+				"full_name": "John Doe",
+				"email":     "john@example.com",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserTx(gomock.Any(), gomock.Any()).Times(1).Return(db.CreateUserTxResult{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), sql.ErrConnDone.Error())
+
+				rsp := requireBodyError(t, recorder.Body)
+				require.Equal(t, apperr.CodeInternal, rsp.Code)
+				require.Equal(t, "internal server error", rsp.Message)
+				require.Equal(t, requestID, rsp.RequestID)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			body := []byte("{")
+			if tc.body != nil {
+				var err error
+				body, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+
+			request, err := http.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+			require.NoError(t, err)
+			request.Header.Set(logger.RequestIDHeader, requestID)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func requireBodyError(t *testing.T, body *bytes.Buffer) ErrorResponse {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var rsp ErrorResponse
+	err = json.Unmarshal(data, &rsp)
+	require.NoError(t, err)
+	return rsp
+}
+
+func requireBodyErrorCode(t *testing.T, body *bytes.Buffer, code apperr.Code) {
+	rsp := requireBodyError(t, body)
+	require.Equal(t, code, rsp.Code)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/logger"
+)
+
+// readinessCheckTimeout bounds each readiness check, so a hanging database fails the probe instead of blocking it
+const readinessCheckTimeout = 2 * time.Second
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+	healthStatusFail     = "fail"
+)
+
+// Readiness check codes, the details of a failed check are only logged
+const (
+	healthCodeUnavailable    = "unavailable"
+	healthCodeSchemaMissing  = "schema_missing"
+	healthCodeSchemaDirty    = "schema_dirty"
+	healthCodeSchemaOutdated = "schema_outdated"
+	healthCodeSchemaNewer    = "schema_newer"
+)
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Status string `json:"status"`
+	Code   string `json:"code,omitempty"`
+}
+
+// healthCheckError is returned by a readiness check with the code reported to the probe.
+// Other errors are reported as healthCodeUnavailable.
+type healthCheckError struct {
+	code     string
+	degraded bool // something is off but it doesn't keep the instance from serving traffic
+	error
+}
+
+// HealthResponse reports the overall status and the result of every check
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// healthz tells the process is alive, it never touches dependencies
+// so a database outage does not get every pod restarted.
+func (server *Server) healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, HealthResponse{Status: healthStatusOK})
+}
+
+// readyz tells the instance can serve traffic: the database answers and its schema is at least at the expected version.
+// A degraded check is reported without failing the probe.
+func (server *Server) readyz(ctx *gin.Context) {
+	checks := map[string]HealthCheck{
+		"database":   runHealthCheck(ctx, "database", server.store.Ping),
+		"migrations": runHealthCheck(ctx, "migrations", server.checkSchemaVersion),
+	}
+
+	ready := true
+	rsp := HealthResponse{Status: healthStatusOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != healthStatusOK {
+			rsp.Status = healthStatusDegraded
+		}
+		if check.Status == healthStatusFail {
+			ready = false
+		}
+	}
+
+	if !ready {
+		ctx.JSON(http.StatusServiceUnavailable, rsp)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// checkSchemaVersion fails if the last migration is older than the one this build expects or it didn't complete.
+// A newer schema is only degraded: migrations are backward compatible, so the previous build keeps serving
+// while a new one is rolled out.
+func (server *Server) checkSchemaVersion(ctx context.Context) error {
+	version, dirty, err := server.store.GetSchemaVersion(ctx)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return healthCheckError{
+				code:  healthCodeSchemaMissing,
+				error: fmt.Errorf("no migration applied, expected version %d", server.schemaVersion),
+			}
+		}
+		return err
+	}
+
+	if dirty {
+		return healthCheckError{
+			code:  healthCodeSchemaDirty,
+			error: fmt.Errorf("migration %d failed and must be fixed manually", version),
+		}
+	}
+
+	if version < int64(server.schemaVersion) {
+		return healthCheckError{
+			code:  healthCodeSchemaOutdated,
+			error: fmt.Errorf("schema is at version %d, expected %d", version, server.schemaVersion),
+		}
+	}
+
+	if version > int64(server.schemaVersion) {
+		return healthCheckError{
+			code:     healthCodeSchemaNewer,
+			degraded: true,
+			error:    fmt.Errorf("schema is at version %d, newer than the expected %d", version, server.schemaVersion),
+		}
+	}
+
+	return nil
+}
+
+// runHealthCheck runs one readiness check. Its error is only logged, the response carries its status and code.
+func runHealthCheck(ctx context.Context, name string, check func(ctx context.Context) error) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	err := check(ctx)
+	if err == nil {
+		return HealthCheck{Status: healthStatusOK}
+	}
+
+	result := HealthCheck{Status: healthStatusFail, Code: healthCodeUnavailable}
+
+	var checkErr healthCheckError
+	if errors.As(err, &checkErr) {
+		result.Code = checkErr.code
+		if checkErr.degraded {
+			result.Status = healthStatusDegraded
+		}
+	}
+
+	logger.FromContext(ctx).Warn().Err(err).
+		Str("check", name).
+		Str("status", result.Status).
+		Str("code", result.Code).
+		Msg("readiness check did not pass")
+	return result
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pawpaw2022/simplebank/db/migrations"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHealthzAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Liveness never touches the database
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().Ping(gomock.Any()).Times(0)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+
+	server.internalRouter.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	rsp := requireBodyHealth(t, recorder)
+	require.Equal(t, healthStatusOK, rsp.Status)
+
+	// the probes are only served on the internal router
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestReadyzAPI(t *testing.T) {
+	schemaVersion, err := migrations.LatestVersion()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(schemaVersion), false, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusOK, rsp.Status)
+				require.Equal(t, healthStatusOK, rsp.Checks["database"].Status)
+				require.Equal(t, healthStatusOK, rsp.Checks["migrations"].Status)
+			},
+		},
+		{
+			name: "Database Down",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(errors.New("connection refused"))
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(0), false, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusDegraded, rsp.Status)
+				require.Equal(t, healthStatusFail, rsp.Checks["database"].Status)
+				require.Equal(t, healthCodeUnavailable, rsp.Checks["database"].Code)
+
+				// the error is logged, not returned
+				require.NotContains(t, recorder.Body.String(), "connection refused")
+			},
+		},
+		{
+			name: "Schema Behind",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(schemaVersion-1), false, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusDegraded, rsp.Status)
+				require.Equal(t, healthStatusOK, rsp.Checks["database"].Status)
+				require.Equal(t, healthStatusFail, rsp.Checks["migrations"].Status)
+				require.Equal(t, healthCodeSchemaOutdated, rsp.Checks["migrations"].Code)
+			},
+		},
+		{
+			name: "Schema Ahead",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(schemaVersion+1), false, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				// a newer build migrated the schema, this one keeps serving
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusDegraded, rsp.Status)
+				require.Equal(t, healthStatusOK, rsp.Checks["database"].Status)
+				require.Equal(t, healthStatusDegraded, rsp.Checks["migrations"].Status)
+				require.Equal(t, healthCodeSchemaNewer, rsp.Checks["migrations"].Code)
+			},
+		},
+		{
+			name: "Dirty Migration Ahead",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(schemaVersion+1), true, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusFail, rsp.Checks["migrations"].Status)
+				require.Equal(t, healthCodeSchemaDirty, rsp.Checks["migrations"].Code)
+			},
+		},
+		{
+			name: "Dirty Migration",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(schemaVersion), true, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusFail, rsp.Checks["migrations"].Status)
+				require.Equal(t, healthCodeSchemaDirty, rsp.Checks["migrations"].Code)
+			},
+		},
+		{
+			name: "No Migration",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetSchemaVersion(gomock.Any()).Times(1).Return(int64(0), false, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				rsp := requireBodyHealth(t, recorder)
+				require.Equal(t, healthStatusFail, rsp.Checks["migrations"].Status)
+				require.Equal(t, healthCodeSchemaMissing, rsp.Checks["migrations"].Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			require.NoError(t, err)
+
+			server.internalRouter.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func requireBodyHealth(t *testing.T, recorder *httptest.ResponseRecorder) HealthResponse {
+	var rsp HealthResponse
+	err := json.NewDecoder(recorder.Body).Decode(&rsp)
+	require.NoError(t, err)
+	return rsp
+}
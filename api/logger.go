@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/rs/zerolog"
+)
+
+// requestLogger assigns every request an ID, makes the request logger available to handlers and the store
+// through the request context, and logs one JSON line per request once it is served.
+func requestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		// Keep the caller's request ID so a call can be followed across services
+		requestID := ctx.GetHeader(logger.RequestIDHeader)
+		if !logger.ValidRequestID(requestID) {
+			requestID = logger.NewRequestID()
+		}
+		ctx.Header(logger.RequestIDHeader, requestID)
+		ctx.Request = ctx.Request.WithContext(logger.WithRequestID(ctx.Request.Context(), requestID))
+
+		ctx.Next()
+
+		statusCode := ctx.Writer.Status()
+
+		l := logger.FromContext(ctx.Request.Context())
+		var event *zerolog.Event
+		switch {
+		case statusCode >= http.StatusInternalServerError:
+			event = l.Error()
+		case statusCode >= http.StatusBadRequest:
+			event = l.Warn()
+		default:
+			event = l.Info()
+		}
+
+		// The cause of an error response, clients only get its message
+		if err := ctx.Errors.Last(); err != nil {
+			event.Err(err.Err)
+		}
+
+		// The body is never logged, it may hold passwords
+		event.Str("protocol", "http").
+			Str("method", ctx.Request.Method).
+			Str("path", ctx.Request.URL.Path).
+			Str("route", ctx.FullPath()).
+			Str("query", logger.RedactQuery(ctx.Request.URL.RawQuery)).
+			Str("client_ip", ctx.ClientIP()).
+			Int("status_code", statusCode).
+			Str("status_text", http.StatusText(statusCode)).
+			Dur("duration", time.Since(start)).
+			Msg("received an HTTP request")
+	}
+}
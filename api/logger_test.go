@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRequestLoggerRequestID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requestID string
+		checker   func(t *testing.T, requestID string, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "Keep Valid Request ID",
+			requestID: "upstream-request-1",
+			checker: func(t *testing.T, requestID string, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, requestID, recorder.Header().Get(logger.RequestIDHeader))
+			},
+		},
+		{
+			name:      "Generate Missing Request ID",
+			requestID: "",
+			checker: func(t *testing.T, requestID string, recorder *httptest.ResponseRecorder) {
+				require.True(t, logger.ValidRequestID(recorder.Header().Get(logger.RequestIDHeader)))
+			},
+		},
+		{
+			name:      "Replace Invalid Request ID",
+			requestID: "not a valid id",
+			checker: func(t *testing.T, requestID string, recorder *httptest.ResponseRecorder) {
+				generated := recorder.Header().Get(logger.RequestIDHeader)
+				require.NotEqual(t, requestID, generated)
+				require.True(t, logger.ValidRequestID(generated))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Any route works, the request is rejected before reaching the store
+			request, err := http.NewRequest(http.MethodGet, "/accounts/1", nil)
+			require.NoError(t, err)
+			if tc.requestID != "" {
+				request.Header.Set(logger.RequestIDHeader, tc.requestID)
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			tc.checker(t, tc.requestID, recorder)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/auth"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
 	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
@@ -13,11 +14,13 @@ import (
 
 func newTestServer(t *testing.T, store db.Store) *Server {
 	config := util.Config{
-		TokenSymmetricKey:   util.RandomString(32),
-		AccessTokenDuration: time.Minute,
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
 	}
 
-	server, err := NewServer(config, store)
+	// Tests distributing tasks set a mock distributor on the server
+	server, err := NewServer(config, store, nil, auth.NewRevoker(store, config.RefreshTokenDuration))
 	require.NoError(t, err)
 
 	return server
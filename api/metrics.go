@@ -0,0 +1,30 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/metrics"
+)
+
+// unmatchedRoute labels requests that matched no route, so random paths cannot grow the number of series
+const unmatchedRoute = "unmatched"
+
+// metricsMiddleware observes the duration of every request by route pattern.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(ctx.Request.Method, route, strconv.Itoa(ctx.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/metrics"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	// The request is observed by route pattern, whatever the outcome
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/accounts/42", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/no/such/route", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Metrics are not served on the public router
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Scraping the internal router needs no authentication
+	recorder = httptest.NewRecorder()
+	server.internalRouter.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	data, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	body := string(data)
+
+	require.True(t, strings.Contains(body, `simplebank_http_request_duration_seconds_count{method="GET",route="/accounts/:id",status="401"}`))
+	require.True(t, strings.Contains(body, `simplebank_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"}`))
+	require.False(t, strings.Contains(body, "/accounts/42"))
+	require.False(t, strings.Contains(body, "/no/such/route"))
+}
+
+func TestTransferMetrics(t *testing.T) {
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+	account1.Currency = util.CAD
+	account2.Currency = util.CAD
+
+	testCases := []struct {
+		name    string
+		outcome string
+		result  db.TransferTxResult
+		err     error
+	}{
+		{
+			name:    "Succeeded",
+			outcome: metrics.TransferSucceeded,
+		},
+		{
+			name:    "Replayed",
+			outcome: metrics.TransferReplayed,
+			result:  db.TransferTxResult{Replayed: true},
+		},
+		{
+			name:    "Insufficient Funds",
+			outcome: metrics.TransferInsufficientFunds,
+			err:     db.ErrInsufficientFunds,
+		},
+		{
+			name:    "Failed",
+			outcome: metrics.TransferFailed,
+			err:     sql.ErrConnDone,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubVerifiedUsers(store, user1)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+			store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(tc.result, tc.err)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			counter := metrics.TransfersTotal.WithLabelValues(util.CAD, tc.outcome)
+			before := testutil.ToFloat64(counter)
+
+			data, err := json.Marshal(gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account2.ID,
+				"amount":          10,
+				"currency":        util.CAD,
+			})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transfer", bytes.NewReader(data))
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
@@ -1,59 +1,83 @@
 package api
 
 import (
-	"errors"
-	"fmt"
-	"net/http"
-	"strings"
-
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/auth"
+	"github.com/pawpaw2022/simplebank/logger"
 	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
-	authorizationTypeBearer = "bearer"
+	authorizationTypeBearer = auth.AuthorizationTypeBearer
 	authorizationPayloadKey = "authorization_payload"
+	authorizationScopeKey   = "authorization_scope"
 )
 
-func authMiddleware(tokenMaker token.TokenMaker) gin.HandlerFunc {
+// authMiddleware authenticates the request with the bearer token of the authorization header.
+func authMiddleware(tokenMaker token.TokenMaker, revoker *auth.Revoker) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		// Get the access token from the authorization header.
-		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
-
-		// Check if the authorization header is provided.
-		if len(authorizationHeader) == 0 {
-			err := errors.New("authorization header is not provided")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		payload, err := auth.Authenticate(ctx, tokenMaker, revoker, ctx.GetHeader(authorizationHeaderKey))
+		if err != nil {
+			abortWithError(ctx, err)
 			return
 		}
 
-		// Check if the authorization header has the "Bearer" prefix.
-		fields := strings.Fields(authorizationHeader)
-		if len(fields) != 2 {
-			err := errors.New("invalid authorization header format")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
-			return
-		}
+		// Add the payload to context.
+		ctx.Set(authorizationPayloadKey, payload)
+		logger.SetUsername(ctx.Request.Context(), payload.Username)
+		ctx.Next() // Call the next handler.
+	}
+}
 
-		// Check if the authorization type is "Bearer".
-		authorizationType := strings.ToLower(fields[0])
-		if authorizationType != authorizationTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %s, only %s is supported", authorizationType, authorizationTypeBearer)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
-			return
-		}
+// accessPolicy lists the roles allowed on each authenticated route, keyed by method and route path,
+// and whether they reach the resources of every user or only their own.
+// Routes missing from the policy are denied to everyone.
+var accessPolicy = auth.Policy{
+	"POST /users/logout":             {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeOwn, util.AdminRole: auth.ScopeOwn},
+	"POST /users/logout_all":         {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeOwn, util.AdminRole: auth.ScopeOwn},
+	"PATCH /users/:username":         {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeOwn, util.AdminRole: auth.ScopeAny},
+	"POST /users/:username/freeze":   {util.AdminRole: auth.ScopeAny},
+	"POST /users/:username/unfreeze": {util.AdminRole: auth.ScopeAny},
+	"POST /users/:username/unlock":   {util.AdminRole: auth.ScopeAny},
+	"POST /accounts":                 {util.DepositorRole: auth.ScopeOwn},
+	"GET /accounts/:id":              {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	"GET /accounts":                  {util.DepositorRole: auth.ScopeOwn},
+	"POST /accounts/:id/deposits":    {util.BankerRole: auth.ScopeAny},
+	"POST /accounts/:id/withdrawals": {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	"GET /accounts/:id/transfers":    {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	"GET /accounts/:id/entries":      {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	"POST /transfer":                 {util.DepositorRole: auth.ScopeOwn},
+	"GET /audit_events":              {util.AdminRole: auth.ScopeAny},
+}
+
+// authorizeMiddleware only lets the request through if the role in the token is allowed on the route,
+// and sets the scope of its access for canAccess.
+// It must run after authMiddleware.
+func authorizeMiddleware(policy auth.Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
-		// Verify the access token.
-		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
+		scope, err := policy.Authorize(ctx.Request.Method+" "+ctx.FullPath(), payload.Role)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			abortWithError(ctx, err)
 			return
 		}
 
-		// Add the payload to context.
-		ctx.Set(authorizationPayloadKey, payload)
-		ctx.Next() // Call the next handler.
+		ctx.Set(authorizationScopeKey, scope)
+		ctx.Next()
 	}
 }
+
+// authorizationScope returns the scope set by authorizeMiddleware, zero if the route is not authorized
+func authorizationScope(ctx *gin.Context) auth.Scope {
+	scope, _ := ctx.Value(authorizationScopeKey).(auth.Scope)
+	return scope
+}
+
+// canAccess reports whether the authenticated user may access a resource of the owner on this route.
+func canAccess(ctx *gin.Context, owner string) bool {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	return authorizationScope(ctx).Allows(payload.Username, owner)
+}
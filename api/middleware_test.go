@@ -8,8 +8,12 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/auth"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
 	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
 )
 
 func addAuthorization(t *testing.T,
@@ -17,11 +21,13 @@ func addAuthorization(t *testing.T,
 	tokenMaker token.TokenMaker,
 	authorizationType string,
 	username string,
+	role string,
 	duration time.Duration,
 ) {
 	// Create a new token.
-	accessToken, err := tokenMaker.CreateToken(username, duration)
+	accessToken, payload, err := tokenMaker.CreateToken(username, role, token.TokenTypeAccessToken, duration)
 	require.NoError(t, err)
+	require.NotEmpty(t, payload)
 
 	// Add the token into the authorization header.
 	authorizationHeader := fmt.Sprintf("%s %s", authorizationType, accessToken)
@@ -37,7 +43,7 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "OK",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", util.DepositorRole, time.Minute)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -56,7 +62,7 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "UnsupportedAuthorizationType",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, "unsupported", "user", time.Minute)
+				addAuthorization(t, request, tokenMaker, "unsupported", "user", util.DepositorRole, time.Minute)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -66,7 +72,7 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "InvalidAuthorizationFormat",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, "", "user", time.Minute)
+				addAuthorization(t, request, tokenMaker, "", "user", util.DepositorRole, time.Minute)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -75,13 +81,26 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "ExpiredToken",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", -time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "user", util.DepositorRole, -time.Minute)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 				require.Contains(t, recorder.Body.String(), "token is expired")
 			},
 		},
+		{
+			name: "RefreshToken",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				refreshToken, _, err := tokenMaker.CreateToken("user", util.DepositorRole, token.TokenTypeRefreshToken, time.Minute)
+				require.NoError(t, err)
+
+				request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, refreshToken))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "invalid token type")
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -94,7 +113,7 @@ func TestAuthMiddleware(t *testing.T) {
 				authPath := "/auth"
 				server.router.GET(
 					authPath,
-					authMiddleware(server.tokenMaker),
+					authMiddleware(server.tokenMaker, server.revoker),
 					func(ctx *gin.Context) {
 						ctx.JSON(http.StatusOK, gin.H{})
 					},
@@ -112,3 +131,173 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddlewareRevokedToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+	authPath := "/auth"
+	server.router.GET(
+		authPath,
+		authMiddleware(server.tokenMaker, server.revoker),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	accessToken, payload, err := server.tokenMaker.CreateToken("user", util.DepositorRole, token.TokenTypeAccessToken, time.Minute)
+	require.NoError(t, err)
+
+	// Revoke the token, as a logout does.
+	server.revoker.Revoke(payload)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, authPath, nil)
+	require.NoError(t, err)
+
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+	server.router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "token has been revoked")
+}
+
+func TestAuthMiddlewarePasswordChanged(t *testing.T) {
+	server := newTestServer(t, nil)
+	authPath := "/auth"
+	server.router.GET(
+		authPath,
+		authMiddleware(server.tokenMaker, server.revoker),
+		func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{})
+		},
+	)
+
+	oldToken, _, err := server.tokenMaker.CreateToken("user", util.DepositorRole, token.TokenTypeAccessToken, time.Minute)
+	require.NoError(t, err)
+
+	server.revoker.RevokeIssuedBefore("user", time.Now())
+
+	newToken, _, err := server.tokenMaker.CreateToken("user", util.DepositorRole, token.TokenTypeAccessToken, time.Minute)
+	require.NoError(t, err)
+
+	for accessToken, code := range map[string]int{oldToken: http.StatusUnauthorized, newToken: http.StatusOK} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, authPath, nil)
+		require.NoError(t, err)
+
+		request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+		server.router.ServeHTTP(recorder, request)
+
+		require.Equal(t, code, recorder.Code)
+	}
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	policy := auth.Policy{
+		"GET /banker": {util.BankerRole: auth.ScopeAny},
+	}
+
+	testCases := []struct {
+		name          string
+		path          string
+		role          string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			path: "/banker",
+			role: util.BankerRole,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "RoleNotAllowed",
+			path: "/banker",
+			role: util.DepositorRole,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "RouteNotInPolicy",
+			path: "/unlisted",
+			role: util.AdminRole,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+			server.router.GET(
+				tc.path,
+				authMiddleware(server.tokenMaker, server.revoker),
+				authorizeMiddleware(policy),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{})
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	policy := auth.Policy{
+		"GET /users/:username": {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		role     string
+		wantCode int
+	}{
+		{name: "Own", path: "/users/user", role: util.DepositorRole, wantCode: http.StatusOK},
+		{name: "OtherUser", path: "/users/other", role: util.DepositorRole, wantCode: http.StatusForbidden},
+		{name: "AnyUser", path: "/users/other", role: util.BankerRole, wantCode: http.StatusOK},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+			server.router.GET(
+				"/users/:username",
+				authMiddleware(server.tokenMaker, server.revoker),
+				authorizeMiddleware(policy),
+				func(ctx *gin.Context) {
+					if !canAccess(ctx, ctx.Param("username")) {
+						ctx.Status(http.StatusForbidden)
+						return
+					}
+					ctx.Status(http.StatusOK)
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "user", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
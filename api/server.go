@@ -2,25 +2,41 @@ package api
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/pawpaw2022/simplebank/auth"
+	"github.com/pawpaw2022/simplebank/db/migrations"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+	"github.com/pawpaw2022/simplebank/lockout"
 	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/transfer"
 	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Server serves HTTP requests for our banking service.
 type Server struct {
-	config     util.Config
-	store      db.Store
-	router     *gin.Engine
-	tokenMaker token.TokenMaker
+	config          util.Config
+	store           db.Store
+	router          *gin.Engine
+	internalRouter  *gin.Engine // operational endpoints, served on a listener that is not exposed publicly
+	tokenMaker      token.TokenMaker
+	revoker         *auth.Revoker
+	loginGuard      *lockout.Guard
+	transfers       *transfer.Service
+	taskDistributor worker.TaskDistributor
+
+	schemaVersion uint // migration version the database must be at to be ready
 }
 
 // NewServer creates a new HTTP server and setup routing.
-func NewServer(config util.Config, store db.Store) (*Server, error) {
+// The revoker is shared with the gRPC server, its cache is kept in sync by the caller.
+func NewServer(config util.Config, store db.Store, taskDistributor worker.TaskDistributor, revoker *auth.Revoker) (*Server, error) {
 	// Use this for JWT
 	// tokenMaker, err := token.NewJWTMaker(config.TokenSymmetricKey)
 
@@ -30,43 +46,115 @@ func NewServer(config util.Config, store db.Store) (*Server, error) {
 		return nil, fmt.Errorf("cannot create token maker: %w", err)
 	}
 
+	rates, err := fx.NewProvider(config.FXRatesFile, config.FXRateMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rate provider: %w", err)
+	}
+
+	schemaVersion, err := migrations.LatestVersion()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read migrations: %w", err)
+	}
+
+	loginGuard := lockout.NewGuard(store, lockout.Config{
+		MaxAttempts:      config.LoginMaxAttempts,
+		MaxAttemptsPerIP: config.LoginMaxIPAttempts,
+		Window:           config.LoginAttemptWindow,
+		LockoutDuration:  config.LoginLockoutDuration,
+		Delay:            config.LoginDelay,
+		MaxDelay:         config.LoginMaxDelay,
+	})
+
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:          config,
+		store:           store,
+		tokenMaker:      tokenMaker,
+		revoker:         revoker,
+		loginGuard:      loginGuard,
+		transfers:       transfer.NewService(store, rates),
+		taskDistributor: taskDistributor,
+		schemaVersion:   schemaVersion,
 	}
 
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("currency", validCurrency)
+		v.RegisterTagNameFunc(fieldTagName)
 	}
 
-	server.setupRouter()
+	if err := server.setupRouter(); err != nil {
+		return nil, err
+	}
+	server.setupInternalRouter()
 	return server, nil
 }
 
-func (server *Server) setupRouter() {
-	router := gin.Default()
+func (server *Server) setupRouter() error {
+	router := gin.New()
+
+	// The client IP locks out logins and is recorded in sessions and audit events,
+	// only the configured proxies may set it through X-Forwarded-For
+	if err := router.SetTrustedProxies(server.config.TrustedProxies); err != nil {
+		return fmt.Errorf("cannot set trusted proxies: %w", err)
+	}
+
+	router.Use(requestLogger(), tracingMiddleware(), metricsMiddleware(), gin.Recovery())
+
+	// Handlers pass *gin.Context to the store, this makes it carry the request context values such as the logger
+	router.ContextWithFallback = true
 
 	// Params: endpoint, *middleware* ,handler
 	router.POST("/users", server.createUser)
 	router.POST("/users/login", server.login)
+	router.GET("/verify_email", server.verifyEmail)
+	router.POST("/users/password/forgot", server.forgotPassword)
+	router.POST("/users/password/reset", server.resetPassword)
+	router.POST("/tokens/renew_access", server.renewAccessToken)
 
 	// all routes below this line require authentication
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	// every one of them must also be listed in accessPolicy
+	authRoutes := router.Group("/").Use(
+		authMiddleware(server.tokenMaker, server.revoker),
+		authorizeMiddleware(accessPolicy),
+	)
+	authRoutes.POST("/users/logout", server.logout)
+	authRoutes.POST("/users/logout_all", server.logoutAll)
+	authRoutes.PATCH("/users/:username", server.updateUser)
+	authRoutes.POST("/users/:username/freeze", server.freezeUser)
+	authRoutes.POST("/users/:username/unfreeze", server.unfreezeUser)
+	authRoutes.POST("/users/:username/unlock", server.unlockUser)
 	authRoutes.POST("/accounts", server.createAccount)
 	authRoutes.GET("/accounts/:id", server.getAccount)
 	authRoutes.GET("/accounts", server.listAccounts)
+	authRoutes.POST("/accounts/:id/deposits", server.createDeposit)
+	authRoutes.POST("/accounts/:id/withdrawals", server.createWithdrawal)
+	authRoutes.GET("/accounts/:id/transfers", server.listAccountTransfers)
+	authRoutes.GET("/accounts/:id/entries", server.listAccountEntries)
 	authRoutes.POST("/transfer", server.createTransfer)
+	authRoutes.GET("/audit_events", server.listAuditEvents)
 
 	server.router = router
+	return nil
+}
+
+// setupInternalRouter routes the endpoints meant for the infrastructure only, the Prometheus scraper and the probes.
+// They need no authentication, so they must not be reachable from outside the cluster.
+func (server *Server) setupInternalRouter() {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", server.healthz)
+	router.GET("/readyz", server.readyz)
+
+	server.internalRouter = router
 }
 
-// Start runs the HTTP server on a specific address.
-func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+// Handler returns the HTTP handler serving the API routes.
+func (server *Server) Handler() http.Handler {
+	return server.router
 }
 
-// errorResponse is a helper to map an error to a JSON response
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// InternalHandler returns the HTTP handler serving the internal endpoints.
+func (server *Server) InternalHandler() http.Handler {
+	return server.internalRouter
 }
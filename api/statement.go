@@ -0,0 +1,225 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
+)
+
+// endOfTime is used as the end of the date range when the client doesn't set one
+var endOfTime = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+type AccountHistoryUri struct {
+	ID int64 `uri:"id" binding:"required,min=1"` // uri: path parameter
+}
+
+type AccountHistoryParams struct {
+	PageID    int32     `form:"page_id" binding:"omitempty,min=1"` // form: query parameter. Deprecated: use cursor
+	PageSize  int32     `form:"page_size" binding:"required,min=5,max=10"`
+	Cursor    string    `form:"cursor" binding:"excluded_with=PageID"`          // next_cursor of the previous page, empty for the first page
+	StartTime time.Time `form:"start_time"`                                     // optional, RFC 3339, inclusive
+	EndTime   time.Time `form:"end_time" binding:"omitempty,gtfield=StartTime"` // optional, RFC 3339, exclusive
+	MinAmount int64     `form:"min_amount" binding:"min=0"`                     // optional, in the account currency
+	MaxAmount int64     `form:"max_amount" binding:"omitempty,gtefield=MinAmount"`
+}
+
+// filters returns the query filters with defaults for the ones the client left out
+func (req AccountHistoryParams) filters() (startTime time.Time, endTime time.Time, minAmount int64, maxAmount int64) {
+	endTime = req.EndTime
+	if endTime.IsZero() {
+		endTime = endOfTime
+	}
+
+	maxAmount = req.MaxAmount
+	if maxAmount == 0 {
+		maxAmount = math.MaxInt64
+	}
+
+	return req.StartTime, endTime, req.MinAmount, maxAmount
+}
+
+type ListAccountTransfersResponse struct {
+	Transfers  []db.Transfer `json:"transfers"`
+	NextCursor string        `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// Authorization: A logged-in user can only list transfers of his own account, bankers can list any account.
+func (server *Server) listAccountTransfers(ctx *gin.Context) {
+	account, req, ok := server.bindAccountHistory(ctx)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, minAmount, maxAmount := req.filters()
+
+	// Deprecated offset pagination
+	if req.PageID > 0 {
+		deprecatePageID(ctx)
+
+		transfers, err := server.store.ListAccountTransfers(ctx, db.ListAccountTransfersParams{
+			AccountID: account.ID,
+			StartTime: startTime,
+			EndTime:   endTime,
+			MinAmount: minAmount,
+			MaxAmount: maxAmount,
+			Limit:     req.PageSize,
+			Offset:    (req.PageID - 1) * req.PageSize,
+		})
+		if err != nil {
+			// Database Error
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, transfers)
+		return
+	}
+
+	cursor, err := page.DecodeCursor(req.Cursor)
+	if err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.InvalidField("cursor", err.Error()))
+		return
+	}
+
+	// Fetch one more row than the page size to know if there is a next page
+	transfers, err := server.store.ListAccountTransfersAfter(ctx, db.ListAccountTransfersAfterParams{
+		AccountID:      account.ID,
+		StartTime:      startTime,
+		EndTime:        endTime,
+		MinAmount:      minAmount,
+		MaxAmount:      maxAmount,
+		AfterCreatedAt: cursor.CreatedAt,
+		AfterID:        cursor.ID,
+		Limit:          req.PageSize + 1,
+	})
+	if err != nil {
+		// Database Error
+		abortWithError(ctx, err)
+		return
+	}
+
+	transfers, nextCursor := page.Next(transfers, req.PageSize, func(transfer db.Transfer) page.Cursor {
+		return page.Cursor{CreatedAt: transfer.CreatedAt, ID: transfer.ID}
+	})
+
+	ctx.JSON(http.StatusOK, ListAccountTransfersResponse{
+		Transfers:  transfers,
+		NextCursor: nextCursor,
+	})
+}
+
+type ListAccountEntriesResponse struct {
+	Entries    []db.Entry `json:"entries"`
+	NextCursor string     `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// Authorization: A logged-in user can only get the statement of his own account, bankers can get any account.
+func (server *Server) listAccountEntries(ctx *gin.Context) {
+	account, req, ok := server.bindAccountHistory(ctx)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, minAmount, maxAmount := req.filters()
+
+	// Deprecated offset pagination
+	if req.PageID > 0 {
+		deprecatePageID(ctx)
+
+		entries, err := server.store.ListAccountEntries(ctx, db.ListAccountEntriesParams{
+			AccountID: account.ID,
+			StartTime: startTime,
+			EndTime:   endTime,
+			MinAmount: minAmount,
+			MaxAmount: maxAmount,
+			Limit:     req.PageSize,
+			Offset:    (req.PageID - 1) * req.PageSize,
+		})
+		if err != nil {
+			// Database Error
+			abortWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, entries)
+		return
+	}
+
+	cursor, err := page.DecodeCursor(req.Cursor)
+	if err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.InvalidField("cursor", err.Error()))
+		return
+	}
+
+	// Fetch one more row than the page size to know if there is a next page
+	entries, err := server.store.ListAccountEntriesAfter(ctx, db.ListAccountEntriesAfterParams{
+		AccountID:      account.ID,
+		StartTime:      startTime,
+		EndTime:        endTime,
+		MinAmount:      minAmount,
+		MaxAmount:      maxAmount,
+		AfterCreatedAt: cursor.CreatedAt,
+		AfterID:        cursor.ID,
+		Limit:          req.PageSize + 1,
+	})
+	if err != nil {
+		// Database Error
+		abortWithError(ctx, err)
+		return
+	}
+
+	entries, nextCursor := page.Next(entries, req.PageSize, func(entry db.Entry) page.Cursor {
+		return page.Cursor{CreatedAt: entry.CreatedAt, ID: entry.ID}
+	})
+
+	ctx.JSON(http.StatusOK, ListAccountEntriesResponse{
+		Entries:    entries,
+		NextCursor: nextCursor,
+	})
+}
+
+// bindAccountHistory validates a history request and gets the account if the caller may read it.
+func (server *Server) bindAccountHistory(ctx *gin.Context) (db.Account, AccountHistoryParams, bool) {
+	var uri AccountHistoryUri
+	var req AccountHistoryParams
+
+	// Assign the path and query parameters
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return db.Account{}, req, false
+	}
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return db.Account{}, req, false
+	}
+
+	// Get the account
+	account, err := server.store.GetAccount(ctx, uri.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			// Account not found
+			err = apperr.Wrap(err, apperr.CodeNotFound, "account not found")
+		}
+
+		abortWithError(ctx, err)
+		return account, req, false
+	}
+
+	if !canAccess(ctx, account.Owner) {
+		abortWithError(ctx, apperr.New(apperr.CodeForbidden, "account doesn't belong to the authenticated user"))
+		return account, req, false
+	}
+
+	return account, req, true
+}
@@ -0,0 +1,531 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestListAccountTransfersAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	otherAccount := randomAccount(util.RandomOwner())
+
+	transfers := []db.Transfer{
+		randomTransfer(account.ID, otherAccount.ID),
+		randomTransfer(otherAccount.ID, account.ID),
+	}
+
+	startTime := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.AddDate(0, 1, 0)
+
+	testCases := []struct {
+		name       string
+		accountID  int64
+		query      url.Values
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				// no filters means the whole history
+				arg := db.ListAccountTransfersParams{
+					AccountID: account.ID,
+					StartTime: time.Time{},
+					EndTime:   endOfTime,
+					MinAmount: 0,
+					MaxAmount: math.MaxInt64,
+					Limit:     5,
+					Offset:    0,
+				}
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Eq(arg)).Times(1).Return(transfers, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTransfers(t, recorder.Body, transfers)
+			},
+		},
+		{
+			name:      "OK With Filters",
+			accountID: account.ID,
+			query: url.Values{
+				"page_id":    {"2"},
+				"page_size":  {"5"},
+				"start_time": {startTime.Format(time.RFC3339)},
+				"end_time":   {endTime.Format(time.RFC3339)},
+				"min_amount": {"10"},
+				"max_amount": {"100"},
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				arg := db.ListAccountTransfersParams{
+					AccountID: account.ID,
+					StartTime: startTime,
+					EndTime:   endTime,
+					MinAmount: 10,
+					MaxAmount: 100,
+					Limit:     5,
+					Offset:    5,
+				}
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Eq(arg)).Times(1).Return(transfers, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "OK Cursor",
+			accountID: account.ID,
+			query:     url.Values{"page_size": {"5"}, "cursor": {page.Cursor{CreatedAt: startTime, ID: 7}.Encode()}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				arg := db.ListAccountTransfersAfterParams{
+					AccountID:      account.ID,
+					StartTime:      time.Time{},
+					EndTime:        endOfTime,
+					MinAmount:      0,
+					MaxAmount:      math.MaxInt64,
+					AfterCreatedAt: startTime,
+					AfterID:        7,
+					Limit:          6,
+				}
+				store.EXPECT().ListAccountTransfersAfter(gomock.Any(), gomock.Eq(arg)).Times(1).Return(transfers, nil)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := io.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var gotPage ListAccountTransfersResponse
+				err = json.Unmarshal(data, &gotPage)
+				require.NoError(t, err)
+				require.Equal(t, transfers, gotPage.Transfers)
+				require.Empty(t, gotPage.NextCursor)
+			},
+		},
+		{
+			name:      "Invalid Cursor",
+			accountID: account.ID,
+			query:     url.Values{"page_size": {"5"}, "cursor": {"%%%"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().ListAccountTransfersAfter(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Banker Lists Any Account",
+			accountID: otherAccount.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(otherAccount.ID)).Times(1).Return(otherAccount, nil)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(1).Return(transfers, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "Unauthorized User",
+			accountID: otherAccount.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(otherAccount.ID)).Times(1).Return(otherAccount, nil)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name:      "No Authorization",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				// Do nothing
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "Account Not Found",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:      "Invalid Amount Range",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}, "min_amount": {"100"}, "max_amount": {"10"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Invalid Date Range",
+			accountID: account.ID,
+			query: url.Values{
+				"page_id":    {"1"},
+				"page_size":  {"5"},
+				"start_time": {endTime.Format(time.RFC3339)},
+				"end_time":   {startTime.Format(time.RFC3339)},
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Invalid Page Size",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"50"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Internal Error",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().ListAccountTransfers(gomock.Any(), gomock.Any()).Times(1).Return(nil, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Create a request
+			target := fmt.Sprintf("/accounts/%d/transfers?%s", tc.accountID, tc.query.Encode())
+			request, err := http.NewRequest(http.MethodGet, target, nil)
+			require.NoError(t, err)
+
+			// Setup authorization
+			tc.setupAuth(t, request, server.tokenMaker)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func TestListAccountEntriesAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	otherAccount := randomAccount(util.RandomOwner())
+
+	entries := []db.Entry{
+		{ID: 1, AccountID: account.ID, Amount: 100, BalanceAfter: account.Balance - 50},
+		{ID: 2, AccountID: account.ID, Amount: 50, BalanceAfter: account.Balance},
+	}
+
+	pageEntries := make([]db.Entry, 6)
+	for i := range pageEntries {
+		pageEntries[i] = db.Entry{
+			ID:           int64(i + 1),
+			AccountID:    account.ID,
+			Amount:       10,
+			CreatedAt:    time.Date(2023, time.September, 1, i, 0, 0, 0, time.UTC),
+			BalanceAfter: account.Balance - int64(50-10*i),
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		accountID  int64
+		query      url.Values
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}, "min_amount": {"50"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				arg := db.ListAccountEntriesParams{
+					AccountID: account.ID,
+					StartTime: time.Time{},
+					EndTime:   endOfTime,
+					MinAmount: 50,
+					MaxAmount: math.MaxInt64,
+					Limit:     5,
+					Offset:    0,
+				}
+				store.EXPECT().ListAccountEntries(gomock.Any(), gomock.Eq(arg)).Times(1).Return(entries, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := io.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var gotEntries []db.Entry
+				err = json.Unmarshal(data, &gotEntries)
+				require.NoError(t, err)
+				require.Equal(t, entries, gotEntries)
+			},
+		},
+		{
+			name:      "OK Cursor With Next Page",
+			accountID: account.ID,
+			query:     url.Values{"page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+				arg := db.ListAccountEntriesAfterParams{
+					AccountID:      account.ID,
+					StartTime:      time.Time{},
+					EndTime:        endOfTime,
+					MinAmount:      0,
+					MaxAmount:      math.MaxInt64,
+					AfterCreatedAt: time.Time{},
+					AfterID:        0,
+					Limit:          6,
+				}
+				store.EXPECT().ListAccountEntriesAfter(gomock.Any(), gomock.Eq(arg)).Times(1).Return(pageEntries, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := io.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				// the extra row is dropped and the cursor points at the last row returned
+				var gotPage ListAccountEntriesResponse
+				err = json.Unmarshal(data, &gotPage)
+				require.NoError(t, err)
+				require.Equal(t, pageEntries[:5], gotPage.Entries)
+				require.Equal(t, page.Cursor{CreatedAt: pageEntries[4].CreatedAt, ID: pageEntries[4].ID}.Encode(), gotPage.NextCursor)
+			},
+		},
+		{
+			name:      "Unauthorized User",
+			accountID: otherAccount.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(otherAccount.ID)).Times(1).Return(otherAccount, nil)
+				store.EXPECT().ListAccountEntries(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name:      "Admin Forbidden",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountEntries(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:      "Invalid Min Amount",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}, "min_amount": {"-1"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountEntries(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Internal Error",
+			accountID: account.ID,
+			query:     url.Values{"page_id": {"1"}, "page_size": {"5"}},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().ListAccountEntries(gomock.Any(), gomock.Any()).Times(1).Return(nil, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Create a request
+			target := fmt.Sprintf("/accounts/%d/entries?%s", tc.accountID, tc.query.Encode())
+			request, err := http.NewRequest(http.MethodGet, target, nil)
+			require.NoError(t, err)
+
+			// Setup authorization
+			tc.setupAuth(t, request, server.tokenMaker)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func randomTransfer(fromAccountID int64, toAccountID int64) db.Transfer {
+	amount := util.RandomMoney()
+	return db.Transfer{
+		ID:            util.RandomInt(1, 1000),
+		FromAccountID: fromAccountID,
+		ToAccountID:   toAccountID,
+		Amount:        amount,
+		ToAmount:      amount,
+		ExchangeRate:  "1",
+	}
+}
+
+func requireBodyMatchTransfers(t *testing.T, body io.Reader, transfers []db.Transfer) {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var gotTransfers []db.Transfer
+	err = json.Unmarshal(data, &gotTransfers)
+	require.NoError(t, err)
+	require.Equal(t, transfers, gotTransfers)
+}
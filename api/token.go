@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
+)
+
+type RenewAccessTokenParams struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type RenewAccessTokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+}
+
+// renewAccessToken issues a new access token for a valid, non-blocked session.
+func (server *Server) renewAccessToken(ctx *gin.Context) {
+	var req RenewAccessTokenParams
+
+	// Assign the request body to the req variable
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	// Verify the refresh token itself
+	refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken, token.TokenTypeRefreshToken)
+	if err != nil {
+		abortWithError(ctx, apperr.Wrap(err, apperr.CodeUnauthenticated, err.Error()))
+		return
+	}
+
+	// Refresh tokens issued before the cutoff of the user are rejected like the access tokens
+	if server.revoker.IsRevoked(ctx, refreshPayload) {
+		abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "token has been revoked"))
+		return
+	}
+
+	// Get the session that was created for this refresh token
+	session, err := server.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, "session not found")
+		}
+
+		abortWithError(ctx, err)
+		return
+	}
+
+	if session.IsBlocked {
+		abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "blocked session"))
+		return
+	}
+
+	if session.Username != refreshPayload.Username {
+		abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "incorrect session user"))
+		return
+	}
+
+	if session.RefreshToken != req.RefreshToken {
+		abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "mismatched session token"))
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "expired session"))
+		return
+	}
+
+	// Generate the new access token
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		refreshPayload.Username,
+		refreshPayload.Role,
+		token.TokenTypeAccessToken,
+		server.config.AccessTokenDuration,
+	)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	res := RenewAccessTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpireAt,
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRenewAccessTokenAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		duration   time.Duration
+		buildStubs func(store *mockdb.MockStore, refreshToken string, payload *token.Payload)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(randomSession(refreshToken, payload), nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res RenewAccessTokenResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+			},
+		},
+		{
+			name:     "ExpiredRefreshToken",
+			duration: -time.Minute,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "SessionNotFound",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(db.Session{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:     "BlockedSession",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				session := randomSession(refreshToken, payload)
+				session.IsBlocked = true
+
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(session, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "IncorrectSessionUser",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				session := randomSession(refreshToken, payload)
+				session.Username = "otheruser"
+
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(session, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "ExpiredSession",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				session := randomSession(refreshToken, payload)
+				session.ExpiresAt = time.Now().Add(-time.Minute)
+
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(session, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "InternalError",
+			duration: time.Hour,
+			buildStubs: func(store *mockdb.MockStore, refreshToken string, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(db.Session{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Create the refresh token the client would have received at login
+			refreshToken, payload, err := server.tokenMaker.CreateToken(user.Username, user.Role, token.TokenTypeRefreshToken, tc.duration)
+			require.NoError(t, err)
+
+			// Build stubs
+			tc.buildStubs(store, refreshToken, payload)
+
+			// Marshal body data to JSON
+			data, err := json.Marshal(gin.H{"refresh_token": refreshToken})
+			require.NoError(t, err)
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, "/tokens/renew_access", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func TestRenewAccessTokenWithAccessToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	// An access token can't renew itself
+	accessToken, _, err := server.tokenMaker.CreateToken(util.RandomOwner(), util.DepositorRole, token.TokenTypeAccessToken, time.Minute)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(gin.H{"refresh_token": accessToken})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/tokens/renew_access", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid token type")
+}
+
+func TestRenewAccessTokenPasswordChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	refreshToken, payload, err := server.tokenMaker.CreateToken(util.RandomOwner(), util.DepositorRole, token.TokenTypeRefreshToken, time.Hour)
+	require.NoError(t, err)
+
+	// The password changed after the access token lifetime, the refresh token is still valid
+	server.revoker.RevokeIssuedBefore(payload.Username, payload.IssueAt.Add(2*server.config.AccessTokenDuration))
+
+	data, err := json.Marshal(gin.H{"refresh_token": refreshToken})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/tokens/renew_access", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "token has been revoked")
+}
+
+// randomSession builds the session stored for the given refresh token
+func randomSession(refreshToken string, payload *token.Payload) db.Session {
+	return db.Session{
+		ID:           payload.ID,
+		Username:     payload.Username,
+		RefreshToken: refreshToken,
+		ExpiresAt:    payload.ExpireAt,
+	}
+}
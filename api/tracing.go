@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/pawpaw2022/simplebank/api"
+
+// tracingMiddleware starts a server span for every request, continuing the trace of the caller
+// when the request carries W3C trace context headers. The store spans become its children
+// because handlers pass the request context down.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		request := ctx.Request
+		parent := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		spanName := fmt.Sprintf("HTTP %s", request.Method)
+		if route := ctx.FullPath(); route != "" {
+			spanName = fmt.Sprintf("%s %s", request.Method, route)
+		}
+
+		spanCtx, span := otel.Tracer(tracerName).Start(parent, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(request.Method),
+				semconv.HTTPRoute(ctx.FullPath()),
+				semconv.HTTPTarget(request.URL.Path),
+				semconv.HTTPClientIP(ctx.ClientIP()),
+				attribute.String("request_id", logger.RequestID(request.Context())),
+			),
+		)
+		defer span.End()
+
+		ctx.Request = request.WithContext(spanCtx)
+
+		ctx.Next()
+
+		statusCode := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(statusCode))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+	}
+}
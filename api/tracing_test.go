@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	// The caller's trace is continued
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	request, err := http.NewRequest(http.MethodGet, "/accounts/1", nil)
+	require.NoError(t, err)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "GET /accounts/:id", spans[0].Name())
+	require.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	require.True(t, spans[0].Parent().IsRemote())
+}
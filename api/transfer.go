@@ -1,13 +1,19 @@
 package api
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/apperr"
 	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/transfer"
+)
+
+const (
+	idempotencyKeyHeaderKey     = "Idempotency-Key"
+	idempotentReplayedHeaderKey = "Idempotent-Replayed"
+	maxIdempotencyKeyLength     = 255
 )
 
 // TransferTxParams contains the input parameters of the transfer transaction
@@ -25,69 +31,41 @@ func (s *Server) createTransfer(ctx *gin.Context) {
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
 		return
 	}
 
-	fromAccount, valid := s.validateUser(ctx, req.FromAccountID, req.Currency)
-	if !valid {
+	// Retries with the same idempotency key get the original result back
+	key := ctx.GetHeader(idempotencyKeyHeaderKey)
+	if len(key) > maxIdempotencyKeyLength {
+		message := fmt.Sprintf("must be at most %d characters long", maxIdempotencyKeyLength)
+		abortWithError(ctx, apperr.InvalidField(idempotencyKeyHeaderKey, message))
 		return
 	}
 
 	// Get the owner from the token
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
-	if fromAccount.Owner != authPayload.Username {
-		err := fmt.Errorf("from account doesn't belong to the authenticated user")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
-		return
-	}
 
-	_, valid = s.validateUser(ctx, req.ToAccountID, req.Currency)
-	if !valid {
+	result, err := s.transfers.Create(ctx, transfer.CreateParams{
+		Request: transfer.Request{
+			FromAccountID: req.FromAccountID,
+			ToAccountID:   req.ToAccountID,
+			Amount:        req.Amount,
+			Currency:      req.Currency,
+		},
+		Username:       authPayload.Username,
+		IdempotencyKey: key,
+		Audit:          auditParams(ctx, authPayload.Username),
+	})
+	if err != nil {
+		abortWithError(ctx, err)
 		return
 	}
 
-	arg := db.TransferTxParams{
-		FromAccountID: req.FromAccountID,
-		ToAccountID:   req.ToAccountID,
-		Amount:        req.Amount,
-	}
-
-	// Execute the transfer transaction
-	result, err := s.store.TransferTx(ctx, arg)
-
-	if err != nil {
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return
+	if result.Replayed {
+		ctx.Header(idempotentReplayedHeaderKey, "true")
 	}
 
 	// Insert success, return the account
 	ctx.JSON(http.StatusOK, result)
 }
-
-// validateUser validates the currency of the account
-func (s *Server) validateUser(ctx *gin.Context, accountID int64, currency string) (db.Account, bool) {
-	// Get the account
-	account, err := s.store.GetAccount(ctx, accountID)
-	if err != nil {
-
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-		}
-
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-
-		return account, false
-	}
-
-	// Validate the currency
-	if account.Currency != currency {
-
-		err := fmt.Errorf("accountID [%d] currency mismatch: %s vs %s", accountID, account.Currency, currency)
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-		return account, false
-	}
-
-	return account, true
-}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -10,9 +11,12 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pawpaw2022/simplebank/apperr"
 	mockdb "github.com/pawpaw2022/simplebank/db/mock"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
 	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/transfer"
 	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -29,14 +33,22 @@ func TestCreateTransferAPI(t *testing.T) {
 	account2 := randomAccount(user2.Username)
 	account3 := randomAccount(user3.Username)
 
+	// transfers to the same account are rejected
+	account2.ID = account1.ID + 1
+	account3.ID = account1.ID + 2
+
 	// set Currency
 	account1.Currency = util.USD
 	account2.Currency = util.USD
 	account3.Currency = util.EUR
 
+	ratesAsOf := time.Now().Truncate(time.Second)
+	rates := fx.NewStaticProvider(map[string]string{"USD/EUR": "0.92"}, ratesAsOf)
+
 	testCases := []struct {
 		name       string
 		body       gin.H
+		rates      fx.RateProvider // optional, cross-currency transfers are disabled without it
 		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
 		buildStubs func(store *mockdb.MockStore)
 		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
@@ -50,7 +62,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -61,6 +73,7 @@ func TestCreateTransferAPI(t *testing.T) {
 					FromAccountID: account1.ID,
 					ToAccountID:   account2.ID,
 					Amount:        amount,
+					Audit:         &db.AuditParams{Actor: user1.Username},
 				}
 				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
 			},
@@ -77,14 +90,16 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorizedUser", time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorizedUser", util.DepositorRole, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq("unauthorizedUser")).Times(1).Return(db.User{IsEmailVerified: true}, nil)
 				// GetAccount
 				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(account1, nil)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
 			},
 		},
 		{
@@ -114,7 +129,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -134,7 +149,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user3.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user3.Username, user3.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -143,11 +158,71 @@ func TestCreateTransferAPI(t *testing.T) {
 				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeCurrencyMismatch)
+			},
+		},
+		{
+			name: "Cross Currency",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account3.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			rates: rates,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				// GetAccount
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+
+				// 10 USD at a rate of 0.92, rounded to the smallest unit
+				arg := db.ExchangeTransferTxParams{
+					TransferTxParams: db.TransferTxParams{
+						FromAccountID: account1.ID,
+						ToAccountID:   account3.ID,
+						Amount:        amount,
+						Audit:         &db.AuditParams{Actor: user1.Username},
+					},
+					ToAmount:     9,
+					ExchangeRate: "0.92",
+					RateQuotedAt: ratesAsOf,
+				}
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Exchange Rate Not Found",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account3.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			rates: fx.NewStaticProvider(map[string]string{}, ratesAsOf),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				// GetAccount
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"code":"exchange_rate_not_found"`)
 			},
 		},
 		{
-			name: "ToAccount Currency Mismatch",
+			name: "No Rate Source",
 			body: gin.H{
 				"from_account_id": account1.ID,
 				"to_account_id":   account3.ID,
@@ -155,16 +230,59 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				// GetAccount
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "no rate source is configured")
+			},
+		},
+		{
+			name: "Amount Too Small To Convert",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account3.ID,
+				"amount":          1,
+				"currency":        util.USD,
+			},
+			rates: fx.NewStaticProvider(map[string]string{"USD/EUR": "0.1"}, ratesAsOf),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
 				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
 				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Same Account",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account1.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
 				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"field":"to_account_id"`)
 			},
 		},
 		{
@@ -176,7 +294,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        "invalid",
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -187,6 +305,50 @@ func TestCreateTransferAPI(t *testing.T) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name: "Email Not Verified",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account2.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				unverifiedUser := user1
+				unverifiedUser.IsEmailVerified = false
+
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user1.Username)).Times(1).Return(unverifiedUser, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeEmailNotVerified)
+			},
+		},
+		{
+			name: "Get Authenticated User Error",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account2.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user1.Username)).Times(1).Return(db.User{}, sql.ErrConnDone)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
 		{
 			name: "User Not Found",
 			body: gin.H{
@@ -196,11 +358,11 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
-				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, sql.ErrNoRows)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
 				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -216,7 +378,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -236,7 +398,7 @@ func TestCreateTransferAPI(t *testing.T) {
 				"currency":        util.USD,
 			},
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
-				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				// GetAccount
@@ -247,6 +409,7 @@ func TestCreateTransferAPI(t *testing.T) {
 					FromAccountID: account1.ID,
 					ToAccountID:   account2.ID,
 					Amount:        amount,
+					Audit:         &db.AuditParams{Actor: user1.Username},
 				}
 
 				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(db.TransferTxResult{}, sql.ErrConnDone)
@@ -255,6 +418,29 @@ func TestCreateTransferAPI(t *testing.T) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "Insufficient Funds",
+			body: gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account2.ID,
+				"amount":          amount,
+				"currency":        util.USD,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				// GetAccount
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrInsufficientFunds)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"code":"insufficient_funds"`)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -267,10 +453,15 @@ func TestCreateTransferAPI(t *testing.T) {
 			store := mockdb.NewMockStore(ctrl)
 
 			// Build stubs
+			// The GetUser stubs of a test case are defined first, so they take precedence over the verified users
 			tc.buildStubs(store)
+			stubVerifiedUsers(store, user1, user2, user3)
 
 			// Create a test server
 			server := newTestServer(t, store)
+			if tc.rates != nil {
+				server.transfers = transfer.NewService(store, tc.rates)
+			}
 			recorder := httptest.NewRecorder()
 
 			// Marshal body data to JSON
@@ -294,3 +485,185 @@ func TestCreateTransferAPI(t *testing.T) {
 	}
 
 }
+
+func TestCreateTransferIdempotencyAPI(t *testing.T) {
+	amount := int64(10)
+	idempotencyKey := util.RandomString(16)
+
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+
+	account1.Currency = util.USD
+	account2.Currency = util.USD
+
+	body := gin.H{
+		"from_account_id": account1.ID,
+		"to_account_id":   account2.ID,
+		"amount":          amount,
+		"currency":        util.USD,
+	}
+
+	requestHash, err := transfer.HashRequest(transfer.Request{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        amount,
+		Currency:      util.USD,
+	})
+	require.NoError(t, err)
+
+	stored := db.TransferTxResult{Transfer: db.Transfer{ID: 42, FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount}}
+	response, err := json.Marshal(stored)
+	require.NoError(t, err)
+
+	keyArg := db.GetIdempotencyKeyParams{Username: user1.Username, IdempotencyKey: idempotencyKey}
+
+	testCases := []struct {
+		name           string
+		idempotencyKey string
+		buildStubs     func(store *mockdb.MockStore)
+		checker        func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "FirstRequest",
+			idempotencyKey: idempotencyKey,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Eq(keyArg)).Times(1).Return(db.IdempotencyKey{}, db.ErrRecordNotFound)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				store.EXPECT().
+					TransferTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+						require.NotNil(t, arg.Idempotency)
+						require.Equal(t, user1.Username, arg.Idempotency.Username)
+						require.Equal(t, idempotencyKey, arg.Idempotency.Key)
+						require.NotEmpty(t, arg.Idempotency.RequestHash)
+						return db.TransferTxResult{}, nil
+					})
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(idempotentReplayedHeaderKey))
+			},
+		},
+		{
+			name:           "Replayed",
+			idempotencyKey: idempotencyKey,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), gomock.Eq(keyArg)).
+					Times(1).
+					Return(db.IdempotencyKey{Username: user1.Username, IdempotencyKey: idempotencyKey, RequestHash: requestHash, Response: response}, nil)
+
+				// the stored result is returned before the accounts are checked again
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeaderKey))
+
+				var rsp db.TransferTxResult
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&rsp))
+				require.Equal(t, stored.Transfer, rsp.Transfer)
+			},
+		},
+		{
+			name:           "ReplayedConcurrently",
+			idempotencyKey: idempotencyKey,
+			buildStubs: func(store *mockdb.MockStore) {
+				// the first request committed after the lookup, the transaction replays it
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Eq(keyArg)).Times(1).Return(db.IdempotencyKey{}, db.ErrRecordNotFound)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				store.EXPECT().
+					TransferTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.TransferTxResult{Replayed: true}, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeaderKey))
+			},
+		},
+		{
+			name:           "KeyReused",
+			idempotencyKey: idempotencyKey,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), gomock.Eq(keyArg)).
+					Times(1).
+					Return(db.IdempotencyKey{Username: user1.Username, IdempotencyKey: idempotencyKey, RequestHash: "other", Response: response}, nil)
+
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"code":"idempotency_key_reused"`)
+			},
+		},
+		{
+			name:           "KeyTooLong",
+			idempotencyKey: util.RandomString(maxIdempotencyKeyLength + 1),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+			stubVerifiedUsers(store, user1)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Marshal body data to JSON
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, "/transfer", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set(idempotencyKeyHeaderKey, tc.idempotencyKey)
+
+			// Setup authorization
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user1.Username, user1.Role, time.Minute)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+// stubVerifiedUsers lets the users pass the email verification check of createTransfer
+func stubVerifiedUsers(store *mockdb.MockStore, users ...db.User) {
+	for _, user := range users {
+		store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).AnyTimes().Return(user, nil)
+	}
+}
@@ -1,12 +1,22 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/auth"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
 	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
 )
 
 type CreateUserParams struct {
@@ -20,17 +30,34 @@ type UserResponse struct {
 	Username          string    `json:"username"`
 	FullName          string    `json:"full_name"`
 	Email             string    `json:"email"`
+	Role              string    `json:"role"`
+	IsFrozen          bool      `json:"is_frozen"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
 }
 
+// newUserResponse strips the hashed password from the user
+func newUserResponse(user db.User) UserResponse {
+	return UserResponse{
+		Username:          user.Username,
+		FullName:          user.FullName,
+		Email:             user.Email,
+		Role:              user.Role,
+		IsFrozen:          user.IsFrozen,
+		IsEmailVerified:   user.IsEmailVerified,
+		PasswordChangedAt: user.PasswordChangedAt,
+		CreatedAt:         user.CreatedAt,
+	}
+}
+
 func (server *Server) createUser(ctx *gin.Context) {
 	var req CreateUserParams
 
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
 		return
 	}
 
@@ -38,51 +65,172 @@ func (server *Server) createUser(ctx *gin.Context) {
 	hashedPassword, err := util.HashPassword(req.Password)
 	if err != nil {
 		// Hashing failed
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
+		return
+	}
+
+	secretCode, err := util.NewSecretCode()
+	if err != nil {
+		abortWithError(ctx, err)
 		return
 	}
 
 	// Create the user
-	user, err := server.store.CreateUser(ctx, db.CreateUserParams{
-		Username:       req.Username,
-		HashedPassword: hashedPassword,
-		FullName:       req.FullName,
-		Email:          req.Email,
+	// The new user is the actor of its own creation
+	// The user is only created if the verification email could be enqueued
+	result, err := server.store.CreateUserTx(ctx, db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       req.Username,
+			HashedPassword: hashedPassword,
+			FullName:       req.FullName,
+			Email:          req.Email,
+		},
+		SecretCode: secretCode,
+		Audit:      auditParams(ctx, req.Username),
+		AfterCreate: func(q db.Querier, user db.User, verifyEmail db.VerifyEmail) error {
+			return server.distributeVerifyEmail(ctx, q, verifyEmail)
+		},
 	})
 
 	if err != nil {
-
 		if db.ErrorCode(err) == db.UniqueViolation {
-			ctx.JSON(http.StatusForbidden, errorResponse(err))
-			return
+			err = apperr.Wrap(err, apperr.CodeAlreadyExists, "username or email already exists")
 		}
 
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
 	// Fill the response
-	res := UserResponse{
-		Username:          user.Username,
-		FullName:          user.FullName,
-		Email:             user.Email,
-		PasswordChangedAt: user.PasswordChangedAt,
-		CreatedAt:         user.CreatedAt,
-	}
+	res := newUserResponse(result.User)
 
 	// Insert success, return the account
 	ctx.JSON(http.StatusOK, res)
 }
 
+// distributeVerifyEmail enqueues the task sending the verification link to a user with q, the queries
+// of the user transaction, so the task is committed with the code it sends and dropped if the user is rolled back.
+func (server *Server) distributeVerifyEmail(ctx context.Context, q db.Querier, verifyEmail db.VerifyEmail) error {
+	payload := &worker.PayloadSendVerifyEmail{
+		VerifyEmailID: verifyEmail.ID,
+	}
+	return server.taskDistributor.DistributeTaskSendVerifyEmail(ctx, payload,
+		worker.Queue(worker.QueueCritical),
+		worker.Tx(q),
+	)
+}
+
+type VerifyEmailParams struct {
+	EmailID    int64  `form:"id" binding:"required,min=1"`
+	SecretCode string `form:"code" binding:"required,max=128"`
+}
+
+type VerifyEmailResponse struct {
+	IsVerified bool `json:"is_verified"`
+}
+
+// verifyEmail marks the email of a user as verified with the code sent to it.
+// A code can only be used once and before it expires.
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req VerifyEmailParams
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	_, err := server.store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{
+		EmailID:    req.EmailID,
+		SecretCode: req.SecretCode,
+		Audit:      auditParams(ctx, ""),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.InvalidField("code", "is invalid, already used or expired")
+		}
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, VerifyEmailResponse{IsVerified: true})
+}
+
+type ForgotPasswordParams struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword enqueues the task emailing a password reset token.
+// The response doesn't depend on the email being registered, so it can't be used to find the users.
+func (server *Server) forgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordParams
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	payload := &worker.PayloadSendResetPassword{
+		Email: req.Email,
+	}
+	err := server.taskDistributor.DistributeTaskSendResetPassword(ctx, payload, worker.Queue(worker.QueueCritical))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+type ResetPasswordParams struct {
+	Token       string `json:"token" binding:"required,max=128"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// resetPassword sets a new password with a token sent by forgotPassword.
+// A token can only be used once and before it expires.
+// Every session of the user is blocked and the access tokens issued before are revoked.
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req ResetPasswordParams
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	user, err := server.store.ResetPasswordTx(ctx, db.ResetPasswordTxParams{
+		TokenHash:      util.HashSecret(req.Token),
+		HashedPassword: hashedPassword,
+		Audit:          auditParams(ctx, ""),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.InvalidField("token", "is invalid, already used or expired")
+		}
+		abortWithError(ctx, err)
+		return
+	}
+
+	// The other server instances pick the change up on their next sync
+	server.revoker.RevokeIssuedBefore(user.Username, user.TokensRevokedAt)
+
+	ctx.Status(http.StatusNoContent)
+}
+
 type LoginParams struct {
 	Username string `json:"username" binding:"required,min=6,alphanum"` // alphanum: only allow alphanumeric characters
 	Password string `json:"password" binding:"required,min=6"`
 }
 
 type LoginResponse struct {
-	AccessToken string       `json:"access_token"`
-	User        UserResponse `json:"user"`
+	SessionID             uuid.UUID    `json:"session_id"`
+	AccessToken           string       `json:"access_token"`
+	AccessTokenExpiresAt  time.Time    `json:"access_token_expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time    `json:"refresh_token_expires_at"`
+	User                  UserResponse `json:"user"`
 }
 
 func (server *Server) login(ctx *gin.Context) {
@@ -91,51 +239,410 @@ func (server *Server) login(ctx *gin.Context) {
 	// Assign the request body to the req variable
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		// Invalid User Input
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	// Throttle the attempts on the username and from the client IP
+	attempt, wait, err := server.loginGuard.Reserve(ctx, req.Username, ctx.ClientIP())
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	if wait > 0 {
+		seconds := int64(math.Ceil(wait.Seconds()))
+		ctx.Header("Retry-After", strconv.FormatInt(seconds, 10))
+		server.loginFailed(ctx, req.Username, apperr.Newf(apperr.CodeTooManyAttempts, "too many failed login attempts, try again in %d seconds", seconds))
 		return
 	}
 
 	// Get the user
 	user, err := server.store.GetUser(ctx, req.Username)
 	if err != nil {
-		if err == db.ErrRecordNotFound {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		if errors.Is(err, db.ErrRecordNotFound) {
+			server.loginFailed(ctx, req.Username, apperr.Wrap(err, apperr.CodeNotFound, "user not found"))
 			return
 		}
 
-		// Database Error
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
 	// Check the password
 	if err := util.ComparePassword(user.HashedPassword, req.Password); err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		server.loginFailed(ctx, req.Username, apperr.Wrap(err, apperr.CodeUnauthenticated, "incorrect password"))
+		return
+	}
+
+	// Frozen users cannot log in, the right password doesn't count toward the lockout
+	if user.IsFrozen {
+		err = apperr.New(apperr.CodeForbidden, "user is frozen")
+		if releaseErr := server.loginGuard.Release(ctx, attempt); releaseErr != nil {
+			err = releaseErr
+		}
+
+		server.loginFailed(ctx, req.Username, err)
 		return
 	}
 
 	// Generate the access token
-	accessToken, err := server.tokenMaker.CreateToken(
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
 		user.Username,
+		user.Role,
+		token.TokenTypeAccessToken,
 		server.config.AccessTokenDuration,
 	)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
+		return
+	}
+
+	// Generate the refresh token, its payload ID doubles as the session ID
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		token.TokenTypeRefreshToken,
+		server.config.RefreshTokenDuration,
+	)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	// Persist the session so the refresh token can be validated and blocked later
+	session, err := server.store.CreateSessionTx(ctx, db.CreateSessionTxParams{
+		CreateSessionParams: db.CreateSessionParams{
+			ID:           refreshPayload.ID,
+			Username:     user.Username,
+			RefreshToken: refreshToken,
+			UserAgent:    ctx.Request.UserAgent(),
+			ClientIp:     ctx.ClientIP(),
+			IsBlocked:    false,
+			ExpiresAt:    refreshPayload.ExpireAt,
+		},
+		LoginAttemptID: attempt.ID,
+		Audit:          auditParams(ctx, user.Username),
+	})
+	if err != nil {
+		abortWithError(ctx, err)
 		return
 	}
 
 	// Fill the response
 	res := LoginResponse{
-		AccessToken: accessToken,
-		User: UserResponse{
-			Username:          user.Username,
-			FullName:          user.FullName,
-			Email:             user.Email,
-			PasswordChangedAt: user.PasswordChangedAt,
-			CreatedAt:         user.CreatedAt,
-		},
+		SessionID:             session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpireAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpireAt,
+		User:                  newUserResponse(user),
 	}
 
 	// Insert success, return the account
 	ctx.JSON(http.StatusOK, res)
 }
+
+// loginFailed records the failed login attempt in the audit log and aborts with err.
+// The username is recorded as sent, it may not exist.
+func (server *Server) loginFailed(ctx *gin.Context, username string, err error) {
+	_, auditErr := server.store.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Actor:      username,
+		Action:     db.AuditLoginFailed,
+		TargetType: db.AuditTargetUser,
+		TargetID:   username,
+		ClientIp:   ctx.ClientIP(),
+		UserAgent:  ctx.Request.UserAgent(),
+	})
+	if auditErr != nil {
+		err = auditErr
+	}
+
+	abortWithError(ctx, err)
+}
+
+type LogoutParams struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// logout revokes the access token used for this request.
+// If a refresh token is provided, its session is blocked as well.
+func (server *Server) logout(ctx *gin.Context) {
+	var req LogoutParams
+
+	// The body is optional, only bind it when one is sent
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			// Invalid User Input
+			abortWithError(ctx, apperr.Validation(err))
+			return
+		}
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	arg := db.LogoutTxParams{
+		Token: db.RevokeTokenParams{
+			ID:        authPayload.ID,
+			Username:  authPayload.Username,
+			ExpiresAt: authPayload.ExpireAt,
+		},
+		Audit: auditParams(ctx, authPayload.Username),
+	}
+
+	if req.RefreshToken != "" {
+		refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken, token.TokenTypeRefreshToken)
+		if err != nil {
+			abortWithError(ctx, apperr.Wrap(err, apperr.CodeUnauthenticated, err.Error()))
+			return
+		}
+
+		if refreshPayload.Username != authPayload.Username {
+			abortWithError(ctx, apperr.New(apperr.CodeUnauthenticated, "refresh token doesn't belong to the authenticated user"))
+			return
+		}
+
+		// Block the session so the refresh token can no longer renew access tokens
+		arg.SessionID = refreshPayload.ID
+	}
+
+	// Revoke the access token
+	if err := server.store.LogoutTx(ctx, arg); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	// The other server instances pick the revocation up on their next sync
+	server.revoker.Revoke(authPayload)
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// logoutAll blocks every session of the authenticated user and revokes every token issued to it until now,
+// including the access token used for this request.
+func (server *Server) logoutAll(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	tokensRevokedAt, err := server.store.LogoutAllTx(ctx, db.LogoutAllTxParams{
+		Username: authPayload.Username,
+		Audit:    auditParams(ctx, authPayload.Username),
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	// The other server instances pick the cutoff up on their next sync
+	server.revoker.RevokeIssuedBefore(authPayload.Username, tokensRevokedAt)
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type UpdateUserUri struct {
+	Username string `uri:"username" binding:"required,min=6,alphanum"`
+}
+
+// UpdateUserJSON only updates the fields that are sent
+type UpdateUserJSON struct {
+	FullName        *string `json:"full_name" binding:"omitempty,min=1,max=100"`
+	Email           *string `json:"email" binding:"omitempty,email"`
+	Password        *string `json:"password" binding:"omitempty,min=6"`
+	CurrentPassword *string `json:"current_password"` // required from users changing their own email or password
+}
+
+// Authorization: A logged-in user can only update himself, admins can update any user.
+// Users must send their current password to change their email or password, so a stolen token cannot take over the account.
+// A new email must be verified again, the verification link is sent in the background.
+// A new password signs the user out everywhere, including the token used for this request.
+func (server *Server) updateUser(ctx *gin.Context) {
+	var uri UpdateUserUri
+	var req UpdateUserJSON
+
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	if req.FullName == nil && req.Email == nil && req.Password == nil {
+		abortWithError(ctx, apperr.New(apperr.CodeValidationFailed, "at least one of full_name, email or password must be set"))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccess(ctx, uri.Username) {
+		abortWithError(ctx, apperr.New(apperr.CodeForbidden, "user doesn't match the authenticated user"))
+		return
+	}
+
+	if authorizationScope(ctx) != auth.ScopeAny && (req.Email != nil || req.Password != nil) {
+		if err := server.checkCurrentPassword(ctx, uri.Username, req.CurrentPassword); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+	}
+
+	arg := db.UpdateUserTxParams{
+		UpdateUserParams: db.UpdateUserParams{
+			Username: uri.Username,
+		},
+		Audit: auditParams(ctx, authPayload.Username),
+		AfterEmailChange: func(q db.Querier, user db.User, verifyEmail db.VerifyEmail) error {
+			return server.distributeVerifyEmail(ctx, q, verifyEmail)
+		},
+	}
+
+	if req.FullName != nil {
+		arg.FullName = pgtype.Text{String: *req.FullName, Valid: true}
+	}
+
+	if req.Email != nil {
+		secretCode, err := util.NewSecretCode()
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		arg.Email = pgtype.Text{String: *req.Email, Valid: true}
+		arg.SecretCode = secretCode
+	}
+
+	if req.Password != nil {
+		hashedPassword, err := util.HashPassword(*req.Password)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		arg.HashedPassword = pgtype.Text{String: hashedPassword, Valid: true}
+	}
+
+	user, err := server.store.UpdateUserTx(ctx, arg)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, "user not found")
+		} else if db.ErrorCode(err) == db.UniqueViolation {
+			err = apperr.Wrap(err, apperr.CodeAlreadyExists, "email already exists")
+		}
+
+		abortWithError(ctx, err)
+		return
+	}
+
+	if req.Password != nil {
+		// The other server instances pick the change up on their next sync
+		server.revoker.RevokeIssuedBefore(user.Username, user.TokensRevokedAt)
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// checkCurrentPassword fails unless currentPassword is the password of the user.
+func (server *Server) checkCurrentPassword(ctx context.Context, username string, currentPassword *string) error {
+	if currentPassword == nil || *currentPassword == "" {
+		return apperr.InvalidField("current_password", "is required to change the email or password")
+	}
+
+	user, err := server.store.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, "user not found")
+		}
+		return err
+	}
+
+	if err := util.ComparePassword(user.HashedPassword, *currentPassword); err != nil {
+		return apperr.InvalidField("current_password", "is incorrect")
+	}
+
+	return nil
+}
+
+type FreezeUserParams struct {
+	Username string `uri:"username" binding:"required,min=6,alphanum"`
+}
+
+// Authorization: only admins can freeze users.
+func (server *Server) freezeUser(ctx *gin.Context) {
+	server.setUserFrozen(ctx, true)
+}
+
+// Authorization: only admins can unfreeze users.
+func (server *Server) unfreezeUser(ctx *gin.Context) {
+	server.setUserFrozen(ctx, false)
+}
+
+// setUserFrozen updates the frozen flag of a user.
+// Freezing also blocks all sessions and revokes every token issued to the user,
+// so it can neither use nor renew the tokens it already has.
+func (server *Server) setUserFrozen(ctx *gin.Context, frozen bool) {
+	var req FreezeUserParams
+
+	// Assign the path parameters to the req variable
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		// Invalid User Input
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.SetUserFrozenTx(ctx, db.SetUserFrozenTxParams{
+		Username: req.Username,
+		IsFrozen: frozen,
+		Audit:    auditParams(ctx, authPayload.Username),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			// User not found
+			err = apperr.Wrap(err, apperr.CodeNotFound, "user not found")
+		}
+
+		abortWithError(ctx, err)
+		return
+	}
+
+	if frozen {
+		// The other server instances pick the cutoff up on their next sync
+		server.revoker.RevokeIssuedBefore(user.Username, user.TokensRevokedAt)
+	}
+
+	res := newUserResponse(user)
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+type UnlockUserParams struct {
+	Username string `uri:"username" binding:"required,min=6,alphanum"`
+}
+
+// Authorization: only admins can unlock users.
+// The failed login attempts of the user are cleared, the client IPs they came from stay locked out.
+func (server *Server) unlockUser(ctx *gin.Context) {
+	var req UnlockUserParams
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, apperr.Validation(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	err := server.store.UnlockLoginTx(ctx, db.UnlockLoginTxParams{
+		Username: req.Username,
+		Audit:    auditParams(ctx, authPayload.Username),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, "user not found")
+		}
+
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -2,19 +2,28 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pawpaw2022/simplebank/apperr"
 	mockdb "github.com/pawpaw2022/simplebank/db/mock"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
 	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
+	mockwk "github.com/pawpaw2022/simplebank/worker/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
@@ -25,11 +34,18 @@ type eqCreateUserParamsMatcher struct {
 }
 
 func (e eqCreateUserParamsMatcher) Matches(x interface{}) bool {
-	arg, ok := x.(db.CreateUserParams)
+	txArg, ok := x.(db.CreateUserTxParams)
 	if !ok {
 		return false
 	}
 
+	// The new user is the actor of its own creation
+	if txArg.Audit.Actor != e.arg.Username || txArg.SecretCode == "" || txArg.AfterCreate == nil {
+		return false
+	}
+
+	arg := txArg.CreateUserParams
+
 	err := util.ComparePassword(arg.HashedPassword, e.password)
 	if err != nil {
 		return false
@@ -47,13 +63,102 @@ func EqCreateUserParams(arg db.CreateUserParams, password string) gomock.Matcher
 	return eqCreateUserParamsMatcher{arg, password}
 }
 
+type eqLoginAuditMatcher struct {
+	username string
+}
+
+func (e eqLoginAuditMatcher) Matches(x interface{}) bool {
+	switch arg := x.(type) {
+	case db.CreateSessionTxParams:
+		return arg.Username == e.username && arg.Audit.Actor == e.username && arg.LoginAttemptID == reservedLoginAttempt.ID
+	case db.CreateAuditEventParams:
+		return arg.Action == db.AuditLoginFailed && arg.Actor == e.username && arg.TargetID == e.username
+	}
+	return false
+}
+
+func (e eqLoginAuditMatcher) String() string {
+	return fmt.Sprintf("login audited for %v", e.username)
+}
+
+// EqLoginAudit matches the session of a successful login, created for the reserved attempt,
+// or the audit event of a failed one, both with the user as actor
+func EqLoginAudit(username string) gomock.Matcher {
+	return eqLoginAuditMatcher{username}
+}
+
+type eqResetPasswordTxParamsMatcher struct {
+	token    string
+	password string
+}
+
+func (e eqResetPasswordTxParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.ResetPasswordTxParams)
+	if !ok {
+		return false
+	}
+
+	if arg.TokenHash != util.HashSecret(e.token) {
+		return false
+	}
+
+	return util.ComparePassword(arg.HashedPassword, e.password) == nil
+}
+
+func (e eqResetPasswordTxParamsMatcher) String() string {
+	return fmt.Sprintf("matches token %v and password %v", e.token, e.password)
+}
+
+// EqResetPasswordTxParams matches the hash of the token and of the new password
+func EqResetPasswordTxParams(token string, password string) gomock.Matcher {
+	return eqResetPasswordTxParamsMatcher{token, password}
+}
+
+type eqUpdateUserTxParamsMatcher struct {
+	arg      db.UpdateUserParams
+	password string
+	actor    string
+}
+
+func (e eqUpdateUserTxParamsMatcher) Matches(x interface{}) bool {
+	txArg, ok := x.(db.UpdateUserTxParams)
+	if !ok {
+		return false
+	}
+
+	// A code is only created for a new email
+	if txArg.Audit.Actor != e.actor || (txArg.SecretCode != "") != e.arg.Email.Valid {
+		return false
+	}
+
+	arg := txArg.UpdateUserParams
+
+	if e.password != "" {
+		if !arg.HashedPassword.Valid || util.ComparePassword(arg.HashedPassword.String, e.password) != nil {
+			return false
+		}
+		e.arg.HashedPassword = arg.HashedPassword
+	}
+
+	return reflect.DeepEqual(e.arg, arg)
+}
+
+func (e eqUpdateUserTxParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v, password %v and actor %v", e.arg, e.password, e.actor)
+}
+
+// EqUpdateUserTxParams matches the fields to update, the hash of the new password if any and the audit actor
+func EqUpdateUserTxParams(arg db.UpdateUserParams, password string, actor string) gomock.Matcher {
+	return eqUpdateUserTxParamsMatcher{arg, password, actor}
+}
+
 func TestCreateUserAPI(t *testing.T) {
 	user, password := randomUser(t)
 
 	testCases := []struct {
 		name       string
 		body       gin.H
-		buildStubs func(store *mockdb.MockStore)
+		buildStubs func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor)
 		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
@@ -64,7 +169,7 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     user.Email,
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 				args := db.CreateUserParams{
 					Username: user.Username,
 					FullName: user.FullName,
@@ -72,9 +177,25 @@ func TestCreateUserAPI(t *testing.T) {
 				}
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), EqCreateUserParams(args, password)).
+					CreateUserTx(gomock.Any(), EqCreateUserParams(args, password)).
 					Times(1).
-					Return(user, nil)
+					DoAndReturn(func(ctx context.Context, arg db.CreateUserTxParams) (db.CreateUserTxResult, error) {
+						verifyEmail := db.VerifyEmail{
+							ID:         1,
+							Username:   user.Username,
+							Email:      user.Email,
+							SecretCode: arg.SecretCode,
+						}
+						err := arg.AfterCreate(store, user, verifyEmail)
+						return db.CreateUserTxResult{User: user, VerifyEmail: verifyEmail}, err
+					})
+
+				// The verification link is sent in the background
+				payload := &worker.PayloadSendVerifyEmail{VerifyEmailID: 1}
+				taskDistributor.EXPECT().
+					DistributeTaskSendVerifyEmail(gomock.Any(), gomock.Eq(payload), gomock.Any()).
+					Times(1).
+					Return(nil)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				// Check the response
@@ -82,6 +203,32 @@ func TestCreateUserAPI(t *testing.T) {
 				requireBodyMatchUser(t, recorder.Body, user)
 			},
 		},
+		{
+			name: "Distribute Task Error",
+			body: gin.H{
+				"username":  user.Username,
+				"password":  password,
+				"full_name": user.FullName,
+				"email":     user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				// The user is rolled back when the task cannot be enqueued
+				store.EXPECT().
+					CreateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.CreateUserTxParams) (db.CreateUserTxResult, error) {
+						err := arg.AfterCreate(store, user, db.VerifyEmail{ID: 1})
+						return db.CreateUserTxResult{}, err
+					})
+				taskDistributor.EXPECT().
+					DistributeTaskSendVerifyEmail(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
 		{
 			name: "Invalid email",
 			body: gin.H{
@@ -90,11 +237,11 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     "invalid_email",
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), gomock.Any()).
+					CreateUserTx(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -110,10 +257,10 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     user.Email,
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), gomock.Any()).
+					CreateUserTx(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -129,11 +276,11 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     user.Email,
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), gomock.Any()).
+					CreateUserTx(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -149,7 +296,7 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     user.Email,
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 				args := db.CreateUserParams{
 					Username: user.Username,
 					FullName: user.FullName,
@@ -157,9 +304,9 @@ func TestCreateUserAPI(t *testing.T) {
 				}
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), EqCreateUserParams(args, password)).
+					CreateUserTx(gomock.Any(), EqCreateUserParams(args, password)).
 					Times(1).
-					Return(db.User{}, sql.ErrConnDone)
+					Return(db.CreateUserTxResult{}, sql.ErrConnDone)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				// Check the response
@@ -174,7 +321,7 @@ func TestCreateUserAPI(t *testing.T) {
 				"full_name": user.FullName,
 				"email":     user.Email,
 			},
-			buildStubs: func(store *mockdb.MockStore) {
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
 				args := db.CreateUserParams{
 					Username: user.Username,
 					FullName: user.FullName,
@@ -182,13 +329,14 @@ func TestCreateUserAPI(t *testing.T) {
 				}
 				// Build stubs
 				store.EXPECT().
-					CreateUser(gomock.Any(), EqCreateUserParams(args, password)).
+					CreateUserTx(gomock.Any(), EqCreateUserParams(args, password)).
 					Times(1).
-					Return(db.User{}, db.ErrUniqueViolation)
+					Return(db.CreateUserTxResult{}, db.ErrUniqueViolation)
 			},
 			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				// Check the response
-				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeAlreadyExists)
 			},
 		},
 	}
@@ -202,12 +350,14 @@ func TestCreateUserAPI(t *testing.T) {
 			defer ctrl.Finish()
 
 			store := mockdb.NewMockStore(ctrl)
+			taskDistributor := mockwk.NewMockTaskDistributor(ctrl)
 
 			// Build stubs
-			tc.buildStubs(store)
+			tc.buildStubs(store, taskDistributor)
 
 			// Create a test server
 			server := newTestServer(t, store)
+			server.taskDistributor = taskDistributor
 			recorder := httptest.NewRecorder()
 
 			// Marshal body data to JSON
@@ -228,16 +378,40 @@ func TestCreateUserAPI(t *testing.T) {
 
 }
 
+// reservedLoginAttempt is the attempt reserved for the logins let through by reserveLoginAttempt
+var reservedLoginAttempt = db.LoginAttempt{ID: 1}
+
+// reserveLoginAttempt mocks ReserveLoginAttemptTx with the recent failures,
+// the attempt is reserved if they let it through
+func reserveLoginAttempt(failures db.GetLoginFailuresRow) func(context.Context, db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+	return func(_ context.Context, arg db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+		if !arg.Admit(failures) {
+			return db.ReserveLoginAttemptTxResult{}, nil
+		}
+		return db.ReserveLoginAttemptTxResult{Admitted: true, Attempt: reservedLoginAttempt}, nil
+	}
+}
+
+// stubNoLoginFailures lets the login attempts through, cases expecting ReserveLoginAttemptTx define it first
+func stubNoLoginFailures(store *mockdb.MockStore) {
+	store.EXPECT().
+		ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(reserveLoginAttempt(db.GetLoginFailuresRow{}))
+}
+
 func randomUser(t *testing.T) (user db.User, password string) {
 	password = util.RandomString(6)
 	hashedPassword, err := util.HashPassword(password)
 	require.NoError(t, err)
 
 	user = db.User{
-		Username:       util.RandomOwner(),
-		FullName:       util.RandomOwner(),
-		Email:          util.RandomEmail(),
-		HashedPassword: hashedPassword,
+		Username:        util.RandomOwner(),
+		FullName:        util.RandomOwner(),
+		Email:           util.RandomEmail(),
+		HashedPassword:  hashedPassword,
+		Role:            util.DepositorRole,
+		IsEmailVerified: true,
 	}
 
 	return
@@ -256,3 +430,1590 @@ func requireBodyMatchUser(t *testing.T, body *bytes.Buffer, user db.User) {
 	require.Equal(t, user.Email, gotUser.Email)
 	require.Empty(t, gotUser.HashedPassword)
 }
+
+func TestLoginUserAPI(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		body       gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res LoginResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.NotEmpty(t, res.RefreshToken)
+				require.Equal(t, user.Username, res.User.Username)
+			},
+		},
+		{
+			name: "UserNotFound",
+			body: gin.H{
+				"username": "notfound",
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit("notfound")).
+					Times(1)
+				// the reserved attempt counts as failed
+				store.EXPECT().
+					DeleteLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "IncorrectPassword",
+			body: gin.H{
+				"username": user.Username,
+				"password": "incorrect",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+				store.EXPECT().
+					DeleteLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "FrozenUser",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozenUser := user
+				frozenUser.IsFrozen = true
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(frozenUser, nil)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+				// the password was right, the attempt doesn't count toward the lockout
+				store.EXPECT().
+					DeleteLoginAttempt(gomock.Any(), gomock.Eq(reservedLoginAttempt.ID)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "AuditEventError",
+			body: gin.H{
+				"username": user.Username,
+				"password": "incorrect",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1).
+					Return(db.AuditEvent{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				// the attempt must be audited, so the request fails
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "CreateSessionError",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1).
+					Return(db.Session{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "ReleaseAttemptError",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozenUser := user
+				frozenUser.IsFrozen = true
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(frozenUser, nil)
+				store.EXPECT().
+					DeleteLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "UsernameLockedOut",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failures := db.GetLoginFailuresRow{
+					UsernameFailures:    5,
+					UsernameLastFailure: time.Now(),
+				}
+				store.EXPECT().
+					ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(reserveLoginAttempt(failures))
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				// the rejected attempt is still audited
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeTooManyAttempts)
+				require.Equal(t, "900", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name: "ProgressiveDelay",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failures := db.GetLoginFailuresRow{
+					UsernameFailures:    3,
+					UsernameLastFailure: time.Now(),
+				}
+				store.EXPECT().
+					ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(reserveLoginAttempt(failures))
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "4", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name: "DelayElapsed",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failures := db.GetLoginFailuresRow{
+					UsernameFailures:    3,
+					UsernameLastFailure: time.Now().Add(-5 * time.Second),
+				}
+				store.EXPECT().
+					ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(reserveLoginAttempt(failures))
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSessionTx(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "ClientIPLockedOut",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failures := db.GetLoginFailuresRow{
+					ClientIpFailures:    20,
+					ClientIpLastFailure: time.Now(),
+				}
+				store.EXPECT().
+					ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(reserveLoginAttempt(failures))
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+					Times(1)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "ReserveLoginAttemptError",
+			body: gin.H{
+				"username": user.Username,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ReserveLoginAttemptTxResult{}, sql.ErrConnDone)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidUsername",
+			body: gin.H{
+				"username": "invalid-user#1",
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+			stubNoLoginFailures(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Marshal body data to JSON
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func TestLoginUserAPIClientIP(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name           string
+		trustedProxies []string
+		clientIP       string
+	}{
+		{
+			name:     "SpoofedForwardedFor",
+			clientIP: "10.1.2.3",
+		},
+		{
+			name:           "TrustedProxy",
+			trustedProxies: []string{"10.1.2.0/24"},
+			clientIP:       "203.0.113.7",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// the client IP is locked out, a forged header must not get around it
+			store.EXPECT().
+				ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(ctx context.Context, arg db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+					require.Equal(t, tc.clientIP, arg.ClientIp)
+					return reserveLoginAttempt(db.GetLoginFailuresRow{
+						ClientIpFailures:    20,
+						ClientIpLastFailure: time.Now(),
+					})(ctx, arg)
+				})
+			store.EXPECT().
+				GetUser(gomock.Any(), gomock.Any()).
+				Times(0)
+			store.EXPECT().
+				CreateAuditEvent(gomock.Any(), EqLoginAudit(user.Username)).
+				Times(1)
+
+			server := newTestServer(t, store)
+			server.config.TrustedProxies = tc.trustedProxies
+			require.NoError(t, server.setupRouter())
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(gin.H{
+				"username": user.Username,
+				"password": password,
+			})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.RemoteAddr = "10.1.2.3:41234"
+			request.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		})
+	}
+}
+
+func TestLogoutUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		path       string
+		body       func(t *testing.T, tokenMaker token.TokenMaker) gin.H
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server)
+	}{
+		{
+			name: "OK",
+			path: "/users/logout",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				return gin.H{}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					LogoutTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.LogoutTxParams) error {
+						require.Equal(t, user.Username, arg.Token.Username)
+						require.Equal(t, uuid.Nil, arg.SessionID)
+						require.Equal(t, user.Username, arg.Audit.Actor)
+						return nil
+					})
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "OKWithRefreshToken",
+			path: "/users/logout",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				refreshToken, _, err := tokenMaker.CreateToken(user.Username, user.Role, token.TokenTypeRefreshToken, time.Hour)
+				require.NoError(t, err)
+				return gin.H{"refresh_token": refreshToken}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					LogoutTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.LogoutTxParams) error {
+						require.NotEqual(t, uuid.Nil, arg.SessionID)
+						return nil
+					})
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "RefreshTokenOfOtherUser",
+			path: "/users/logout",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				refreshToken, _, err := tokenMaker.CreateToken("otheruser", util.DepositorRole, token.TokenTypeRefreshToken, time.Hour)
+				require.NoError(t, err)
+				return gin.H{"refresh_token": refreshToken}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					LogoutTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "NoAuthorization",
+			path: "/users/logout",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				return gin.H{}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				// Do nothing
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					LogoutTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			path: "/users/logout",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				return gin.H{}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					LogoutTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "LogoutAll",
+			path: "/users/logout_all",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				return gin.H{}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.LogoutAllTxParams{
+					Username: user.Username,
+					Audit:    db.AuditParams{Actor: user.Username},
+				}
+				store.EXPECT().
+					LogoutAllTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(time.Now(), nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+
+				// every token issued before is revoked, including the ones of the other sessions
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.True(t, server.revoker.IsRevoked(context.Background(), before))
+
+				after := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(time.Second)}
+				require.False(t, server.revoker.IsRevoked(context.Background(), after))
+			},
+		},
+		{
+			name: "LogoutAllInternalError",
+			path: "/users/logout_all",
+			body: func(t *testing.T, tokenMaker token.TokenMaker) gin.H {
+				return gin.H{}
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.LogoutAllTxParams{
+					Username: user.Username,
+					Audit:    db.AuditParams{Actor: user.Username},
+				}
+				store.EXPECT().
+					LogoutAllTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(time.Time{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.False(t, server.revoker.IsRevoked(context.Background(), before))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Marshal body data to JSON
+			data, err := json.Marshal(tc.body(t, server.tokenMaker))
+			require.NoError(t, err)
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, tc.path, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			// Setup authorization
+			tc.setupAuth(t, request, server.tokenMaker)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, recorder, server)
+		})
+	}
+}
+
+func TestFreezeUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		path       string
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Freeze",
+			path: fmt.Sprintf("/users/%s/freeze", user.Username),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozenUser := user
+				frozenUser.IsFrozen = true
+				frozenUser.TokensRevokedAt = time.Now()
+
+				arg := db.SetUserFrozenTxParams{
+					Username: user.Username,
+					IsFrozen: true,
+					Audit:    db.AuditParams{Actor: "admin"},
+				}
+				store.EXPECT().
+					SetUserFrozenTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(frozenUser, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"is_frozen":true`)
+
+				// the tokens the user already has are revoked
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.True(t, server.revoker.IsRevoked(context.Background(), before))
+			},
+		},
+		{
+			name: "Unfreeze",
+			path: fmt.Sprintf("/users/%s/unfreeze", user.Username),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.SetUserFrozenTxParams{
+					Username: user.Username,
+					IsFrozen: false,
+					Audit:    db.AuditParams{Actor: "admin"},
+				}
+				store.EXPECT().
+					SetUserFrozenTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(user, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.False(t, server.revoker.IsRevoked(context.Background(), before))
+			},
+		},
+		{
+			name: "BankerForbidden",
+			path: fmt.Sprintf("/users/%s/freeze", user.Username),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "banker", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetUserFrozenTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "UserNotFound",
+			path: fmt.Sprintf("/users/%s/freeze", user.Username),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetUserFrozenTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+
+			// Build stubs
+			tc.buildStubs(store)
+
+			// Create a test server
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			// Create a request
+			request, err := http.NewRequest(http.MethodPost, tc.path, nil)
+			require.NoError(t, err)
+
+			// Setup authorization
+			tc.setupAuth(t, request, server.tokenMaker)
+
+			// Send the request
+			server.router.ServeHTTP(recorder, request)
+
+			// Check the response
+			tc.checker(t, server, recorder)
+		})
+	}
+}
+
+func TestVerifyEmailAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	verifyEmail := db.VerifyEmail{
+		ID:         util.RandomInt(1, 1000),
+		Username:   user.Username,
+		Email:      user.Email,
+		SecretCode: util.RandomString(32),
+		IsUsed:     true,
+	}
+
+	testCases := []struct {
+		name       string
+		query      url.Values
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: url.Values{
+				"id":   []string{fmt.Sprint(verifyEmail.ID)},
+				"code": []string{verifyEmail.SecretCode},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.VerifyEmailTxParams{
+					EmailID:    verifyEmail.ID,
+					SecretCode: verifyEmail.SecretCode,
+				}
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.VerifyEmailTxResult{User: user, VerifyEmail: verifyEmail}, nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"is_verified":true}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "InvalidCode",
+			query: url.Values{
+				"id":   []string{fmt.Sprint(verifyEmail.ID)},
+				"code": []string{verifyEmail.SecretCode},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerifyEmailTxResult{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeValidationFailed)
+			},
+		},
+		{
+			name: "MissingCode",
+			query: url.Values{
+				"id": []string{fmt.Sprint(verifyEmail.ID)},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidID",
+			query: url.Values{
+				"id":   []string{"0"},
+				"code": []string{verifyEmail.SecretCode},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			query: url.Values{
+				"id":   []string{fmt.Sprint(verifyEmail.ID)},
+				"code": []string{verifyEmail.SecretCode},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerifyEmailTxResult{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/verify_email?"+tc.query.Encode(), nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func TestForgotPasswordAPI(t *testing.T) {
+	email := util.RandomEmail()
+
+	testCases := []struct {
+		name       string
+		body       gin.H
+		buildStubs func(taskDistributor *mockwk.MockTaskDistributor)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"email": email},
+			buildStubs: func(taskDistributor *mockwk.MockTaskDistributor) {
+				// The user is looked up in the background, unknown emails get the same response
+				payload := &worker.PayloadSendResetPassword{Email: email}
+				taskDistributor.EXPECT().
+					DistributeTaskSendResetPassword(gomock.Any(), gomock.Eq(payload), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				require.Empty(t, recorder.Body.String())
+			},
+		},
+		{
+			name: "InvalidEmail",
+			body: gin.H{"email": "invalid-email"},
+			buildStubs: func(taskDistributor *mockwk.MockTaskDistributor) {
+				taskDistributor.EXPECT().
+					DistributeTaskSendResetPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeValidationFailed)
+			},
+		},
+		{
+			name: "DistributeTaskError",
+			body: gin.H{"email": email},
+			buildStubs: func(taskDistributor *mockwk.MockTaskDistributor) {
+				taskDistributor.EXPECT().
+					DistributeTaskSendResetPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			taskDistributor := mockwk.NewMockTaskDistributor(ctrl)
+			tc.buildStubs(taskDistributor)
+
+			server := newTestServer(t, mockdb.NewMockStore(ctrl))
+			server.taskDistributor = taskDistributor
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/users/password/forgot", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
+
+func TestResetPasswordAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	resetToken := util.RandomString(32)
+	newPassword := util.RandomString(8)
+
+	testCases := []struct {
+		name       string
+		body       gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"token": resetToken, "new_password": newPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				updatedUser := user
+				updatedUser.PasswordChangedAt = time.Now()
+				updatedUser.TokensRevokedAt = updatedUser.PasswordChangedAt
+
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), EqResetPasswordTxParams(resetToken, newPassword)).
+					Times(1).
+					Return(updatedUser, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+
+				// tokens issued before the reset are revoked, later ones are not
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.True(t, server.revoker.IsRevoked(context.Background(), before))
+
+				after := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(time.Second)}
+				require.False(t, server.revoker.IsRevoked(context.Background(), after))
+			},
+		},
+		{
+			name: "InvalidToken",
+			body: gin.H{"token": resetToken, "new_password": newPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeValidationFailed)
+
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.False(t, server.revoker.IsRevoked(context.Background(), before))
+			},
+		},
+		{
+			name: "PasswordTooShort",
+			body: gin.H{"token": resetToken, "new_password": "123"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "MissingToken",
+			body: gin.H{"new_password": newPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"token": resetToken, "new_password": newPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/users/password/reset", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, server, recorder)
+		})
+	}
+}
+
+func TestUpdateUserAPI(t *testing.T) {
+	user, password := randomUser(t)
+	newFullName := util.RandomOwner()
+	newEmail := util.RandomEmail()
+	newPassword := util.RandomString(8)
+
+	testCases := []struct {
+		name       string
+		username   string
+		body       gin.H
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor)
+		checker    func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "FullName",
+			username: user.Username,
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				updatedUser := user
+				updatedUser.FullName = newFullName
+
+				arg := db.UpdateUserParams{
+					Username: user.Username,
+					FullName: pgtype.Text{String: newFullName, Valid: true},
+				}
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), EqUpdateUserTxParams(arg, "", user.Username)).
+					Times(1).
+					Return(updatedUser, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), newFullName)
+			},
+		},
+		{
+			name:     "Email",
+			username: user.Username,
+			body:     gin.H{"email": newEmail, "current_password": password},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				updatedUser := user
+				updatedUser.Email = newEmail
+				updatedUser.IsEmailVerified = false
+
+				arg := db.UpdateUserParams{
+					Username: user.Username,
+					Email:    pgtype.Text{String: newEmail, Valid: true},
+				}
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), EqUpdateUserTxParams(arg, "", user.Username)).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.UpdateUserTxParams) (db.User, error) {
+						verifyEmail := db.VerifyEmail{
+							ID:         2,
+							Username:   user.Username,
+							Email:      newEmail,
+							SecretCode: arg.SecretCode,
+						}
+						return updatedUser, arg.AfterEmailChange(store, updatedUser, verifyEmail)
+					})
+
+				// The new email must be verified again
+				payload := &worker.PayloadSendVerifyEmail{VerifyEmailID: 2}
+				taskDistributor.EXPECT().
+					DistributeTaskSendVerifyEmail(gomock.Any(), gomock.Eq(payload), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"is_email_verified":false`)
+			},
+		},
+		{
+			name:     "Password",
+			username: user.Username,
+			body:     gin.H{"password": newPassword, "current_password": password},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				updatedUser := user
+				updatedUser.PasswordChangedAt = time.Now()
+				updatedUser.TokensRevokedAt = updatedUser.PasswordChangedAt
+
+				arg := db.UpdateUserParams{
+					Username: user.Username,
+				}
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), EqUpdateUserTxParams(arg, newPassword, user.Username)).
+					Times(1).
+					Return(updatedUser, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "hashed_password")
+
+				// tokens issued before the change are revoked
+				before := &token.Payload{Username: user.Username, IssueAt: time.Now().Add(-time.Minute)}
+				require.True(t, server.revoker.IsRevoked(context.Background(), before))
+			},
+		},
+		{
+			name:     "AdminUpdatesOtherUser",
+			username: user.Username,
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				arg := db.UpdateUserParams{
+					Username: user.Username,
+					FullName: pgtype.Text{String: newFullName, Valid: true},
+				}
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), EqUpdateUserTxParams(arg, "", "admin")).
+					Times(1).
+					Return(user, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "AdminChangesPassword",
+			username: user.Username,
+			body:     gin.H{"password": newPassword},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				// admins don't know the password of the users they update
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), EqUpdateUserTxParams(db.UpdateUserParams{Username: user.Username}, newPassword, "admin")).
+					Times(1).
+					Return(user, nil)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "MissingCurrentPassword",
+			username: user.Username,
+			body:     gin.H{"password": newPassword},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "current_password")
+			},
+		},
+		{
+			name:     "IncorrectCurrentPassword",
+			username: user.Username,
+			body:     gin.H{"email": newEmail, "current_password": "incorrect"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "current_password")
+			},
+		},
+		{
+			name:     "OtherUser",
+			username: user.Username,
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "otheruser", util.BankerRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeForbidden)
+			},
+		},
+		{
+			name:     "NoAuthorization",
+			username: user.Username,
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "NoFields",
+			username: user.Username,
+			body:     gin.H{},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeValidationFailed)
+			},
+		},
+		{
+			name:     "InvalidEmail",
+			username: user.Username,
+			body:     gin.H{"email": "invalid-email"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "PasswordTooShort",
+			username: user.Username,
+			body:     gin.H{"password": "123"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "UserNotFound",
+			username: "unknownuser",
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:     "DuplicateEmail",
+			username: user.Username,
+			body:     gin.H{"email": newEmail, "current_password": password},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrUniqueViolation)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyErrorCode(t, recorder.Body, apperr.CodeAlreadyExists)
+			},
+		},
+		{
+			name:     "InternalError",
+			username: user.Username,
+			body:     gin.H{"full_name": newFullName},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, taskDistributor *mockwk.MockTaskDistributor) {
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			taskDistributor := mockwk.NewMockTaskDistributor(ctrl)
+			tc.buildStubs(store, taskDistributor)
+
+			server := newTestServer(t, store)
+			server.taskDistributor = taskDistributor
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPatch, "/users/"+tc.username, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, server, recorder)
+		})
+	}
+}
+
+func TestUnlockUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		username   string
+		setupAuth  func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker)
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			username: user.Username,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.UnlockLoginTxParams{
+					Username: user.Username,
+					Audit:    db.AuditParams{Actor: "admin"},
+				}
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(nil)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:     "DepositorForbidden",
+			username: user.Username,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.Username, util.DepositorRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "NoAuthorization",
+			username: user.Username,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:     "InvalidUsername",
+			username: "invalid-user",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "UserNotFound",
+			username: user.Username,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:     "InternalError",
+			username: user.Username,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "admin", util.AdminRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UnlockLoginTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/unlock", tc.username), nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checker(t, recorder)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/pawpaw2022/simplebank/util"
 )
@@ -12,3 +15,17 @@ var validCurrency validator.Func = func(fl validator.FieldLevel) bool {
 	}
 	return false
 }
+
+// fieldTagName names a field after its json, form or uri tag in validation errors, so clients see the names they send
+func fieldTagName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form", "uri"} {
+		name := strings.SplitN(field.Tag.Get(key), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
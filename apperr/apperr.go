@@ -0,0 +1,103 @@
+// Package apperr defines the errors returned to API clients.
+// Every error has a stable code clients can match on and a message that is safe to show,
+// the underlying cause is only logged.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+)
+
+// Code identifies the kind of error, unlike the message it never changes
+type Code string
+
+const (
+	CodeValidationFailed     Code = "validation_failed"
+	CodeUnauthenticated      Code = "unauthenticated"
+	CodeForbidden            Code = "forbidden"
+	CodeEmailNotVerified     Code = "email_not_verified"
+	CodeTooManyAttempts      Code = "too_many_attempts"
+	CodeNotFound             Code = "not_found"
+	CodeAlreadyExists        Code = "already_exists"
+	CodeInsufficientFunds    Code = "insufficient_funds"
+	CodeCurrencyMismatch     Code = "currency_mismatch"
+	CodeRateNotFound         Code = "exchange_rate_not_found"
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	CodeInternal             Code = "internal"
+)
+
+// internalMessage replaces the message of unexpected errors, which may hold database details
+const internalMessage = "internal server error"
+
+// FieldViolation describes why a request field is invalid
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error with a stable code and a message for clients
+type Error struct {
+	Code       Code
+	Message    string
+	Violations []FieldViolation // only set for CodeValidationFailed
+	Err        error            // the cause, never shown to clients
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an error without cause.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf creates an error without cause with a formatted message.
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap creates an error with the given code and message, keeping err as its cause.
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// From converts err into an *Error.
+// Errors that are already an *Error are returned as is, the errors of the store and the rate provider
+// get their own code, and anything else is an internal error with a generic message.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch {
+	case errors.Is(err, db.ErrRecordNotFound):
+		return Wrap(err, CodeNotFound, "record not found")
+	case errors.Is(err, db.ErrInsufficientFunds):
+		return Wrap(err, CodeInsufficientFunds, "insufficient funds")
+	case errors.Is(err, db.ErrIdempotencyKeyReused):
+		return Wrap(err, CodeIdempotencyKeyReused, "idempotency key was already used for a different request")
+	case errors.Is(err, fx.ErrRateNotFound):
+		return Wrap(err, CodeRateNotFound, "exchange rate not found")
+	}
+
+	switch db.ErrorCode(err) {
+	case db.UniqueViolation:
+		return Wrap(err, CodeAlreadyExists, "record already exists")
+	case db.ForeignKeyViolation:
+		return Wrap(err, CodeNotFound, "referenced record not found")
+	}
+
+	return Wrap(err, CodeInternal, internalMessage)
+}
@@ -0,0 +1,140 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgconn"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	forbidden := New(CodeForbidden, "account doesn't belong to the authenticated user")
+
+	testCases := []struct {
+		name    string
+		err     error
+		code    Code
+		message string
+	}{
+		{
+			name:    "AppError",
+			err:     forbidden,
+			code:    CodeForbidden,
+			message: forbidden.Message,
+		},
+		{
+			name:    "WrappedAppError",
+			err:     fmt.Errorf("get account: %w", forbidden),
+			code:    CodeForbidden,
+			message: forbidden.Message,
+		},
+		{
+			name:    "NotFound",
+			err:     db.ErrRecordNotFound,
+			code:    CodeNotFound,
+			message: "record not found",
+		},
+		{
+			name:    "InsufficientFunds",
+			err:     db.ErrInsufficientFunds,
+			code:    CodeInsufficientFunds,
+			message: "insufficient funds",
+		},
+		{
+			name:    "IdempotencyKeyReused",
+			err:     db.ErrIdempotencyKeyReused,
+			code:    CodeIdempotencyKeyReused,
+			message: "idempotency key was already used for a different request",
+		},
+		{
+			name:    "RateNotFound",
+			err:     fmt.Errorf("%w for USD/EUR", fx.ErrRateNotFound),
+			code:    CodeRateNotFound,
+			message: "exchange rate not found",
+		},
+		{
+			name:    "UniqueViolation",
+			err:     &pgconn.PgError{Code: db.UniqueViolation, Message: "duplicate key value violates unique constraint"},
+			code:    CodeAlreadyExists,
+			message: "record already exists",
+		},
+		{
+			name:    "ForeignKeyViolation",
+			err:     &pgconn.PgError{Code: db.ForeignKeyViolation},
+			code:    CodeNotFound,
+			message: "referenced record not found",
+		},
+		{
+			name:    "Internal",
+			err:     errors.New("connection refused"),
+			code:    CodeInternal,
+			message: internalMessage,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			appErr := From(tc.err)
+			require.Equal(t, tc.code, appErr.Code)
+			require.Equal(t, tc.message, appErr.Message)
+
+			// The cause of converted errors is kept for the logs
+			var target *Error
+			if !errors.As(tc.err, &target) {
+				require.ErrorIs(t, appErr, tc.err)
+			}
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	type request struct {
+		Username string `validate:"required,alphanum"`
+		Password string `validate:"required,min=6"`
+		Amount   int64  `validate:"gt=0"`
+	}
+
+	err := validator.New().Struct(request{Username: "john!", Password: "abc"})
+	require.Error(t, err)
+
+	appErr := Validation(err)
+	require.Equal(t, CodeValidationFailed, appErr.Code)
+	require.Equal(t, validationMessage, appErr.Message)
+	require.Equal(t, []FieldViolation{
+		{Field: "Username", Message: "must contain only letters and digits"},
+		{Field: "Password", Message: "must be at least 6 characters long"},
+		{Field: "Amount", Message: "must be greater than 0"},
+	}, appErr.Violations)
+}
+
+func TestValidationJSON(t *testing.T) {
+	var req struct {
+		Amount int64 `json:"amount"`
+	}
+
+	err := json.Unmarshal([]byte(`{"amount": "ten"}`), &req)
+	appErr := Validation(err)
+	require.Equal(t, CodeValidationFailed, appErr.Code)
+	require.Equal(t, []FieldViolation{{Field: "amount", Message: "must be an integer"}}, appErr.Violations)
+
+	err = json.Unmarshal([]byte(`{"amount": `), &req)
+	appErr = Validation(err)
+	require.Equal(t, CodeValidationFailed, appErr.Code)
+	require.Equal(t, "request body is not valid JSON", appErr.Message)
+	require.Empty(t, appErr.Violations)
+}
+
+func TestInvalidField(t *testing.T) {
+	appErr := InvalidField("cursor", "invalid cursor")
+	require.Equal(t, CodeValidationFailed, appErr.Code)
+	require.Equal(t, []FieldViolation{{Field: "cursor", Message: "invalid cursor"}}, appErr.Violations)
+	require.Equal(t, validationMessage, appErr.Error())
+}
@@ -0,0 +1,100 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validationMessage is the message of every validation error, the violations tell what is wrong
+const validationMessage = "invalid request parameters"
+
+// Validation converts an error returned while binding a request into a validation error,
+// with one violation per invalid field when the fields are known.
+func Validation(err error) *Error {
+	appErr := Wrap(err, CodeValidationFailed, validationMessage)
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fieldErr := range validationErrs {
+			appErr.Violations = append(appErr.Violations, FieldViolation{
+				Field:   fieldErr.Field(),
+				Message: ruleMessage(fieldErr),
+			})
+		}
+	case errors.As(err, &typeErr):
+		appErr.Violations = []FieldViolation{{
+			Field:   typeErr.Field,
+			Message: typeMessage(typeErr.Type),
+		}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		appErr.Message = "request body is not valid JSON"
+	}
+
+	return appErr
+}
+
+// InvalidField creates a validation error for a single field checked outside the validator.
+func InvalidField(field string, message string) *Error {
+	return &Error{
+		Code:       CodeValidationFailed,
+		Message:    validationMessage,
+		Violations: []FieldViolation{{Field: field, Message: message}},
+	}
+}
+
+// ruleMessage describes the validation rule a field failed
+func ruleMessage(fieldErr validator.FieldError) string {
+	unit := ""
+	if fieldErr.Kind() == reflect.String {
+		unit = " characters long"
+	}
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fieldErr.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fieldErr.Param(), unit)
+	case "gt", "gtfield":
+		return fmt.Sprintf("must be greater than %s", fieldErr.Param())
+	case "gtefield":
+		return fmt.Sprintf("must be greater than or equal to %s", fieldErr.Param())
+	case "email":
+		return "must be a valid email address"
+	case "alphanum":
+		return "must contain only letters and digits"
+	case "currency":
+		return "must be a supported currency"
+	case "excluded_with":
+		return fmt.Sprintf("cannot be used with %s", fieldErr.Param())
+	}
+
+	return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+}
+
+// typeMessage describes the JSON type a field must have
+func typeMessage(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be an integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Bool:
+		return "must be a boolean"
+	}
+
+	return "has an invalid type"
+}
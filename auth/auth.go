@@ -0,0 +1,42 @@
+// Package auth authenticates the requests of the HTTP and gRPC APIs.
+// Both check the bearer token the same way with Authenticate, against the same Revoker.
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/token"
+)
+
+const AuthorizationTypeBearer = "bearer"
+
+// Authenticate verifies the access token of an authorization header, as in "Bearer <token>",
+// and rejects the tokens revoked before their expiry.
+func Authenticate(ctx context.Context, tokenMaker token.TokenMaker, revoker *Revoker, authorization string) (*token.Payload, error) {
+	if len(authorization) == 0 {
+		return nil, apperr.New(apperr.CodeUnauthenticated, "authorization header is not provided")
+	}
+
+	fields := strings.Fields(authorization)
+	if len(fields) != 2 {
+		return nil, apperr.New(apperr.CodeUnauthenticated, "invalid authorization header format")
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != AuthorizationTypeBearer {
+		return nil, apperr.Newf(apperr.CodeUnauthenticated, "unsupported authorization type %s, only %s is supported", authorizationType, AuthorizationTypeBearer)
+	}
+
+	payload, err := tokenMaker.VerifyToken(fields[1], token.TokenTypeAccessToken)
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeUnauthenticated, err.Error())
+	}
+
+	if revoker.IsRevoked(ctx, payload) {
+		return nil, apperr.New(apperr.CodeUnauthenticated, "token has been revoked")
+	}
+
+	return payload, nil
+}
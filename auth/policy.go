@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"github.com/pawpaw2022/simplebank/apperr"
+)
+
+// Scope is how far the access of a role to a route reaches.
+type Scope int
+
+const (
+	// ScopeOwn only reaches the resources of the authenticated user.
+	ScopeOwn Scope = iota + 1
+	// ScopeAny reaches the resources of every user.
+	ScopeAny
+)
+
+// Policy lists the roles allowed on each authenticated route and the scope of their access.
+// It is deny by default: routes missing from the policy, and roles missing from a route, are denied.
+type Policy map[string]map[string]Scope
+
+// Authorize returns the scope of the role on the route, or a forbidden error if the role is not allowed on it.
+func (policy Policy) Authorize(route string, role string) (Scope, error) {
+	scope, ok := policy[route][role]
+	if !ok {
+		return 0, apperr.Newf(apperr.CodeForbidden, "role %q is not allowed to access %s", role, route)
+	}
+	return scope, nil
+}
+
+// Allows reports whether the scope lets the user access a resource of the owner.
+func (scope Scope) Allows(username string, owner string) bool {
+	return scope == ScopeAny || username == owner
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyAuthorize(t *testing.T) {
+	policy := Policy{
+		"GET /accounts/:id": {util.DepositorRole: ScopeOwn, util.BankerRole: ScopeAny},
+	}
+
+	scope, err := policy.Authorize("GET /accounts/:id", util.DepositorRole)
+	require.NoError(t, err)
+	require.Equal(t, ScopeOwn, scope)
+
+	scope, err = policy.Authorize("GET /accounts/:id", util.BankerRole)
+	require.NoError(t, err)
+	require.Equal(t, ScopeAny, scope)
+
+	// deny by default
+	_, err = policy.Authorize("GET /accounts/:id", util.AdminRole)
+	require.Equal(t, apperr.CodeForbidden, apperr.From(err).Code)
+
+	_, err = policy.Authorize("GET /unlisted", util.BankerRole)
+	require.Equal(t, apperr.CodeForbidden, apperr.From(err).Code)
+}
+
+func TestScopeAllows(t *testing.T) {
+	require.True(t, ScopeOwn.Allows("alice", "alice"))
+	require.False(t, ScopeOwn.Allows("alice", "bob"))
+	require.True(t, ScopeAny.Allows("alice", "bob"))
+
+	// an unauthorized request has no scope
+	require.False(t, Scope(0).Allows("alice", "bob"))
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/rs/zerolog/log"
+)
+
+// RevocationSyncInterval is how often the in-process cache is reloaded from the database,
+// so tokens revoked through another server instance are picked up.
+const RevocationSyncInterval = 30 * time.Second
+
+// Revoker keeps track of tokens revoked before their expiry.
+// The revoked_tokens table is the source of truth, the in-process cache answers every request
+// while its last sync succeeded. After a failed sync the database is checked instead until the next one succeeds.
+// Changing a password, logging out from all sessions or being frozen revokes every token issued to the user
+// before its tokens_revoked_at cutoff.
+// A single Revoker is shared by the HTTP and gRPC servers, so a revocation through one applies to the other at once.
+type Revoker struct {
+	store         db.Store
+	tokenDuration time.Duration // longest lifetime of the checked tokens, older cutoffs can't revoke any
+
+	mu            sync.RWMutex
+	stale         bool                    // the last sync failed, the cache may miss revocations
+	revoked       map[uuid.UUID]time.Time // token ID -> token expiry
+	revokedBefore map[string]time.Time    // username -> tokens_revoked_at
+}
+
+// NewRevoker creates a new Revoker with an empty cache, Sync must fill it before the servers accept requests.
+// The token duration must be the one of the longest lived tokens, the refresh tokens.
+func NewRevoker(store db.Store, tokenDuration time.Duration) *Revoker {
+	return &Revoker{
+		store:         store,
+		tokenDuration: tokenDuration,
+		revoked:       make(map[uuid.UUID]time.Time),
+		revokedBefore: make(map[string]time.Time),
+	}
+}
+
+// Revoke revokes the token.
+// The token ID is already stored in revoked_tokens by the logout transaction, only the cache is updated.
+func (r *Revoker) Revoke(payload *token.Payload) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[payload.ID] = payload.ExpireAt
+}
+
+// RevokeIssuedBefore revokes the tokens issued to the user before the cutoff.
+// The cutoff is already stored in the tokens_revoked_at of the user, only the cache is updated.
+func (r *Revoker) RevokeIssuedBefore(username string, tokensRevokedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tokensRevokedAt.After(r.revokedBefore[username]) {
+		r.revokedBefore[username] = tokensRevokedAt
+	}
+}
+
+// IsRevoked reports whether the token has been revoked,
+// or was issued before the cutoff of its user.
+// While the cache is stale the database is checked, and the token is reported as revoked if that fails too.
+func (r *Revoker) IsRevoked(ctx context.Context, payload *token.Payload) bool {
+	r.mu.RLock()
+	revoked := r.isCached(payload)
+	stale := r.stale
+	r.mu.RUnlock()
+
+	if revoked || !stale {
+		return revoked
+	}
+
+	revoked, err := r.isStored(ctx, payload)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot check revoked token")
+		return true
+	}
+
+	return revoked
+}
+
+// isCached checks the token against the cache, the caller must hold the lock
+func (r *Revoker) isCached(payload *token.Payload) bool {
+	if _, ok := r.revoked[payload.ID]; ok {
+		return true
+	}
+
+	cutoff, ok := r.revokedBefore[payload.Username]
+	return ok && payload.IssueAt.Before(cutoff)
+}
+
+// isStored checks the token against the database
+func (r *Revoker) isStored(ctx context.Context, payload *token.Payload) (bool, error) {
+	_, err := r.store.GetRevokedToken(ctx, payload.ID)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, db.ErrRecordNotFound) {
+		return false, err
+	}
+
+	user, err := r.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return payload.IssueAt.Before(user.TokensRevokedAt), nil
+}
+
+// Sync reloads the cache from the database.
+// A failed sync marks the cache as stale, IsRevoked checks the database until a sync succeeds.
+func (r *Revoker) Sync(ctx context.Context) error {
+	err := r.sync(ctx)
+	if err != nil {
+		r.mu.Lock()
+		r.stale = true
+		r.mu.Unlock()
+	}
+
+	return err
+}
+
+// sync loads the revoked tokens that have not expired yet and the recent cutoffs,
+// and drops the entries that can no longer match a valid token from the cache.
+func (r *Revoker) sync(ctx context.Context) error {
+	tokens, err := r.store.ListActiveRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	since := now.Add(-r.tokenDuration)
+
+	cutoffs, err := r.store.ListTokenRevocationsSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stale = false
+
+	for _, t := range tokens {
+		r.revoked[t.ID] = t.ExpiresAt
+	}
+
+	// Revocation is permanent, so entries are only removed once the token would be rejected anyway
+	for id, expireAt := range r.revoked {
+		if expireAt.Before(now) {
+			delete(r.revoked, id)
+		}
+	}
+
+	for _, c := range cutoffs {
+		if c.TokensRevokedAt.After(r.revokedBefore[c.Username]) {
+			r.revokedBefore[c.Username] = c.TokensRevokedAt
+		}
+	}
+
+	// Every token issued before an older cutoff has expired
+	for username, cutoff := range r.revokedBefore {
+		if cutoff.Before(since) {
+			delete(r.revokedBefore, username)
+		}
+	}
+
+	return nil
+}
+
+// Run reloads the cache every interval until the context is cancelled.
+// The first sync is expected to be done already, see Sync.
+func (r *Revoker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Sync(ctx); err != nil {
+			log.Error().Err(err).Msg("cannot sync revoked tokens")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func randomPayload(t *testing.T, username string) *token.Payload {
+	payload, err := token.NewPayload(username, util.DepositorRole, token.TokenTypeAccessToken, time.Minute)
+	require.NoError(t, err)
+	return payload
+}
+
+func TestRevoke(t *testing.T) {
+	revoker := NewRevoker(nil, time.Minute)
+
+	payload := randomPayload(t, util.RandomOwner())
+	other := randomPayload(t, payload.Username)
+
+	revoker.Revoke(payload)
+	require.True(t, revoker.IsRevoked(context.Background(), payload))
+	require.False(t, revoker.IsRevoked(context.Background(), other))
+}
+
+func TestRevokeIssuedBefore(t *testing.T) {
+	revoker := NewRevoker(nil, time.Minute)
+
+	before := randomPayload(t, util.RandomOwner())
+	revoker.RevokeIssuedBefore(before.Username, time.Now())
+	after := randomPayload(t, before.Username)
+
+	require.True(t, revoker.IsRevoked(context.Background(), before))
+	require.False(t, revoker.IsRevoked(context.Background(), after))
+	require.False(t, revoker.IsRevoked(context.Background(), randomPayload(t, util.RandomOwner())))
+
+	// An older cutoff doesn't move it back
+	revoker.RevokeIssuedBefore(before.Username, time.Now().Add(-time.Hour))
+	require.True(t, revoker.IsRevoked(context.Background(), before))
+}
+
+func TestRevokerSync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	revoker := NewRevoker(store, time.Hour)
+
+	payload := randomPayload(t, util.RandomOwner())
+	expired := uuid.New()
+	revoker.revoked[expired] = time.Now().Add(-time.Second)
+
+	// The tokens and cutoffs were revoked through another server instance
+	tokens := []db.RevokedToken{
+		{ID: payload.ID, Username: payload.Username, ExpiresAt: payload.ExpireAt},
+	}
+	changes := []db.ListTokenRevocationsSinceRow{
+		{Username: "user", TokensRevokedAt: time.Now()},
+		{Username: "recent", TokensRevokedAt: time.Now().Add(-2 * time.Minute)},
+		{Username: "other", TokensRevokedAt: time.Now().Add(-2 * time.Hour)},
+	}
+	store.EXPECT().ListActiveRevokedTokens(gomock.Any()).Times(1).Return(tokens, nil)
+	store.EXPECT().ListTokenRevocationsSince(gomock.Any(), gomock.Any()).Times(1).Return(changes, nil)
+	require.NoError(t, revoker.Sync(context.Background()))
+
+	require.True(t, revoker.IsRevoked(context.Background(), payload))
+	require.Contains(t, revoker.revokedBefore, "user")
+	require.Contains(t, revoker.revokedBefore, "recent")
+
+	// entries that can't match a valid token anymore are dropped
+	require.NotContains(t, revoker.revoked, expired)
+	require.NotContains(t, revoker.revokedBefore, "other")
+}
+
+func TestRevokerStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	revoker := NewRevoker(store, time.Hour)
+
+	revokedToken := randomPayload(t, util.RandomOwner())
+	issuedBefore := randomPayload(t, util.RandomOwner())
+	valid := randomPayload(t, util.RandomOwner())
+	unchecked := randomPayload(t, util.RandomOwner())
+
+	// A failed sync leaves the cache stale
+	store.EXPECT().ListActiveRevokedTokens(gomock.Any()).Times(1).Return(nil, sql.ErrConnDone)
+	require.Error(t, revoker.Sync(context.Background()))
+
+	// The database is checked instead of the cache
+	store.EXPECT().GetRevokedToken(gomock.Any(), gomock.Eq(revokedToken.ID)).Times(1).Return(db.RevokedToken{ID: revokedToken.ID}, nil)
+	require.True(t, revoker.IsRevoked(context.Background(), revokedToken))
+
+	store.EXPECT().GetRevokedToken(gomock.Any(), gomock.Eq(issuedBefore.ID)).Times(1).Return(db.RevokedToken{}, db.ErrRecordNotFound)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(issuedBefore.Username)).Times(1).Return(db.User{Username: issuedBefore.Username, TokensRevokedAt: time.Now()}, nil)
+	require.True(t, revoker.IsRevoked(context.Background(), issuedBefore))
+
+	store.EXPECT().GetRevokedToken(gomock.Any(), gomock.Eq(valid.ID)).Times(1).Return(db.RevokedToken{}, db.ErrRecordNotFound)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(valid.Username)).Times(1).Return(db.User{Username: valid.Username}, nil)
+	require.False(t, revoker.IsRevoked(context.Background(), valid))
+
+	// Tokens that can't be checked are rejected
+	store.EXPECT().GetRevokedToken(gomock.Any(), gomock.Eq(unchecked.ID)).Times(1).Return(db.RevokedToken{}, sql.ErrConnDone)
+	require.True(t, revoker.IsRevoked(context.Background(), unchecked))
+
+	// The cache answers again once a sync succeeds
+	store.EXPECT().ListActiveRevokedTokens(gomock.Any()).Times(1).Return(nil, nil)
+	store.EXPECT().ListTokenRevocationsSince(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	require.NoError(t, revoker.Sync(context.Background()))
+
+	store.EXPECT().GetRevokedToken(gomock.Any(), gomock.Any()).Times(0)
+	require.False(t, revoker.IsRevoked(context.Background(), unchecked))
+}
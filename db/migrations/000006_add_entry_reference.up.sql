@@ -0,0 +1,3 @@
+ALTER TABLE "entries" ADD COLUMN "reference" varchar NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "entries"."reference" IS 'external reference of a deposit or withdrawal';
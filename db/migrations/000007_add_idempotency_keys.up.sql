@@ -0,0 +1,12 @@
+CREATE TABLE "idempotency_keys" (
+  "username" varchar NOT NULL,
+  "idempotency_key" varchar NOT NULL,
+  "request_hash" varchar NOT NULL,
+  "response" jsonb NOT NULL DEFAULT '{}',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("username", "idempotency_key")
+);
+
+COMMENT ON COLUMN "idempotency_keys"."response" IS 'result returned to the first request, replayed on retries';
+
+ALTER TABLE "idempotency_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
@@ -0,0 +1,5 @@
+COMMENT ON COLUMN "transfers"."amount" IS 'must be positive';
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "rate_quoted_at";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "exchange_rate";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "to_amount";
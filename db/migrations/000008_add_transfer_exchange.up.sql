@@ -0,0 +1,12 @@
+ALTER TABLE "transfers" ADD COLUMN "to_amount" bigint;
+ALTER TABLE "transfers" ADD COLUMN "exchange_rate" numeric NOT NULL DEFAULT 1;
+ALTER TABLE "transfers" ADD COLUMN "rate_quoted_at" timestamptz NOT NULL DEFAULT (now());
+
+-- existing transfers were all between accounts of the same currency
+UPDATE "transfers" SET "to_amount" = "amount", "rate_quoted_at" = "created_at";
+
+ALTER TABLE "transfers" ALTER COLUMN "to_amount" SET NOT NULL;
+
+COMMENT ON COLUMN "transfers"."amount" IS 'must be positive, in the currency of the from account';
+COMMENT ON COLUMN "transfers"."to_amount" IS 'must be positive, in the currency of the to account';
+COMMENT ON COLUMN "transfers"."exchange_rate" IS 'rate applied to convert amount into to_amount';
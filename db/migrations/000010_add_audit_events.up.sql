@@ -0,0 +1,26 @@
+CREATE TABLE "audit_events" (
+  "id" bigserial PRIMARY KEY,
+  "actor" varchar NOT NULL,
+  "action" varchar NOT NULL,
+  "target_type" varchar NOT NULL,
+  "target_id" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "user_agent" varchar NOT NULL,
+  "before" jsonb,
+  "after" jsonb,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+-- no foreign key on the actor, failed logins record usernames that may not exist
+COMMENT ON COLUMN "audit_events"."actor" IS 'username of the user performing the action';
+
+COMMENT ON COLUMN "audit_events"."before" IS 'state of the target before the action, null if the action created it';
+
+COMMENT ON COLUMN "audit_events"."after" IS 'state of the target after the action, null if the action failed';
+
+-- the admin endpoint filters by actor or target and pages in (created_at, id) order
+CREATE INDEX "audit_events_created_at_id_idx" ON "audit_events" ("created_at", "id");
+
+CREATE INDEX "audit_events_actor_created_at_id_idx" ON "audit_events" ("actor", "created_at", "id");
+
+CREATE INDEX "audit_events_target_type_target_id_created_at_id_idx" ON "audit_events" ("target_type", "target_id", "created_at", "id");
@@ -0,0 +1,18 @@
+ALTER TABLE "users" ADD COLUMN "is_email_verified" boolean NOT NULL DEFAULT false;
+
+-- users created before the verification existed keep access to transfers
+UPDATE "users" SET "is_email_verified" = true;
+
+CREATE TABLE "verify_emails" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "secret_code" varchar NOT NULL,
+  "is_used" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expired_at" timestamptz NOT NULL DEFAULT (now() + interval '24 hours')
+);
+
+COMMENT ON COLUMN "verify_emails"."email" IS 'address the code was sent to, the user is only verified if it is still the user email';
+
+ALTER TABLE "verify_emails" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
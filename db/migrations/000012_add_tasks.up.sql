@@ -0,0 +1,23 @@
+CREATE TABLE "tasks" (
+  "id" bigserial PRIMARY KEY,
+  "type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "queue" varchar NOT NULL,
+  "priority" int NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "attempts" int NOT NULL DEFAULT 0,
+  "max_attempts" int NOT NULL,
+  "last_error" varchar NOT NULL DEFAULT '',
+  "run_at" timestamptz NOT NULL DEFAULT (now()),
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "tasks"."priority" IS 'priority of the queue, tasks of higher priority queues are claimed first';
+
+COMMENT ON COLUMN "tasks"."status" IS 'pending, running, done or dead';
+
+COMMENT ON COLUMN "tasks"."run_at" IS 'when a pending task is due, or when the lock of a running task expires';
+
+-- workers claim the due tasks by priority, done and dead tasks are left out of the index
+CREATE INDEX "tasks_claim_idx" ON "tasks" ("priority" DESC, "run_at", "id") WHERE "status" IN ('pending', 'running');
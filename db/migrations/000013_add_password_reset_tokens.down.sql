@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "password_reset_tokens";
+
+DROP INDEX IF EXISTS "users_password_changed_at_idx";
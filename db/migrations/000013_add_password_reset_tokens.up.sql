@@ -0,0 +1,17 @@
+CREATE TABLE "password_reset_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "is_used" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expired_at" timestamptz NOT NULL DEFAULT (now() + interval '1 hour')
+);
+
+COMMENT ON COLUMN "password_reset_tokens"."token_hash" IS 'sha256 of the token sent by email, the token itself is never stored';
+
+CREATE INDEX ON "password_reset_tokens" ("username");
+
+ALTER TABLE "password_reset_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+-- the token revoker loads the recent password changes
+CREATE INDEX ON "users" ("password_changed_at");
@@ -0,0 +1,16 @@
+CREATE TABLE "login_attempts" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "succeeded" boolean NOT NULL,
+  "is_cleared" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "login_attempts"."username" IS 'as sent by the client, the user may not exist';
+
+COMMENT ON COLUMN "login_attempts"."is_cleared" IS 'cleared failures no longer count toward the lockout of the username, set by a successful login or an admin unlock';
+
+CREATE INDEX ON "login_attempts" ("username", "created_at");
+
+CREATE INDEX ON "login_attempts" ("client_ip", "created_at");
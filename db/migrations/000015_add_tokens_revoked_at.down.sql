@@ -0,0 +1,3 @@
+ALTER TABLE "users" DROP COLUMN IF EXISTS "tokens_revoked_at";
+
+CREATE INDEX ON "users" ("password_changed_at");
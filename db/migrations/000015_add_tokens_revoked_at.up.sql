@@ -0,0 +1,10 @@
+ALTER TABLE "users" ADD COLUMN "tokens_revoked_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+COMMENT ON COLUMN "users"."tokens_revoked_at" IS 'tokens issued before are rejected, moved by password changes, logouts from all sessions and freezes';
+
+-- the tokens issued before the last password change stay revoked
+UPDATE "users" SET "tokens_revoked_at" = "password_changed_at";
+
+-- the token revoker loads the recent cutoffs instead of the password changes
+DROP INDEX IF EXISTS "users_password_changed_at_idx";
+CREATE INDEX ON "users" ("tokens_revoked_at");
@@ -0,0 +1,17 @@
+ALTER TABLE "entries" ADD COLUMN "balance_after" bigint;
+
+COMMENT ON COLUMN "entries"."balance_after" IS 'account balance right after the entry';
+
+-- derived from the current balance, so money the account was created with is counted
+UPDATE "entries" e
+SET "balance_after" = s."balance_after"
+FROM (
+  SELECT e.id,
+    a.balance - SUM(e.amount) OVER (PARTITION BY e.account_id)
+      + SUM(e.amount) OVER (PARTITION BY e.account_id ORDER BY e.created_at, e.id) AS "balance_after"
+  FROM "entries" e
+  JOIN "accounts" a ON a.id = e.account_id
+) s
+WHERE e.id = s.id;
+
+ALTER TABLE "entries" ALTER COLUMN "balance_after" SET NOT NULL;
@@ -0,0 +1,89 @@
+// Package migrations embeds the SQL migrations in the binary and applies them with golang-migrate.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres" // postgres:// and postgresql:// database URLs
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// New returns a migrate instance applying the embedded migrations to the database at dbSource.
+// The caller must Close it.
+func New(dbSource string) (*migrate.Migrate, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read embedded migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, dbSource)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create migrate instance: %w", err)
+	}
+
+	m.Log = migrateLogger{}
+	return m, nil
+}
+
+// Up applies every migration not applied yet. Having nothing to apply is not an error.
+func Up(dbSource string) error {
+	m, err := New(dbSource)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// LatestVersion returns the version of the newest embedded migration,
+// which is the version the database must be at for this build.
+func LatestVersion() (uint, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		migration, err := source.DefaultParse(entry.Name())
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %s: %w", entry.Name(), err)
+		}
+
+		if migration.Version > latest {
+			latest = migration.Version
+		}
+	}
+
+	return latest, nil
+}
+
+// migrateLogger writes the golang-migrate output to the structured logger
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...interface{}) {
+	log.Info().Msgf(strings.TrimSpace(format), v...)
+}
+
+func (migrateLogger) Verbose() bool {
+	return true
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestVersion(t *testing.T) {
+	entries, err := fs.Glob(files, "*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+
+	// Every migration has both directions and versions have no gaps, so the latest is the number of up files
+	downs, err := fs.Glob(files, "*.down.sql")
+	require.NoError(t, err)
+	require.Len(t, downs, len(entries))
+
+	version, err := LatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint(len(entries)), version)
+}
@@ -7,7 +7,9 @@ package mockdb
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	uuid "github.com/google/uuid"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -35,6 +37,77 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// BlockSession mocks base method.
+func (m *MockStore) BlockSession(arg0 context.Context, arg1 db.BlockSessionParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BlockSession indicates an expected call of BlockSession.
+func (mr *MockStoreMockRecorder) BlockSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockSession", reflect.TypeOf((*MockStore)(nil).BlockSession), arg0, arg1)
+}
+
+// BlockUserSessions mocks base method.
+func (m *MockStore) BlockUserSessions(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockUserSessions", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BlockUserSessions indicates an expected call of BlockUserSessions.
+func (mr *MockStoreMockRecorder) BlockUserSessions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockUserSessions", reflect.TypeOf((*MockStore)(nil).BlockUserSessions), arg0, arg1)
+}
+
+// ClaimTask mocks base method.
+func (m *MockStore) ClaimTask(arg0 context.Context, arg1 time.Time) (db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimTask", arg0, arg1)
+	ret0, _ := ret[0].(db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimTask indicates an expected call of ClaimTask.
+func (mr *MockStoreMockRecorder) ClaimTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimTask", reflect.TypeOf((*MockStore)(nil).ClaimTask), arg0, arg1)
+}
+
+// ClearLoginFailures mocks base method.
+func (m *MockStore) ClearLoginFailures(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearLoginFailures", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearLoginFailures indicates an expected call of ClearLoginFailures.
+func (mr *MockStoreMockRecorder) ClearLoginFailures(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearLoginFailures", reflect.TypeOf((*MockStore)(nil).ClearLoginFailures), arg0, arg1)
+}
+
+// CompleteTask mocks base method.
+func (m *MockStore) CompleteTask(arg0 context.Context, arg1 db.CompleteTaskParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteTask", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteTask indicates an expected call of CompleteTask.
+func (mr *MockStoreMockRecorder) CompleteTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteTask", reflect.TypeOf((*MockStore)(nil).CompleteTask), arg0, arg1)
+}
+
 // CreateAccount mocks base method.
 func (m *MockStore) CreateAccount(arg0 context.Context, arg1 db.CreateAccountParams) (db.Account, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +123,36 @@ func (mr *MockStoreMockRecorder) CreateAccount(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockStore)(nil).CreateAccount), arg0, arg1)
 }
 
+// CreateAccountTx mocks base method.
+func (m *MockStore) CreateAccountTx(arg0 context.Context, arg1 db.CreateAccountTxParams) (db.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccountTx", arg0, arg1)
+	ret0, _ := ret[0].(db.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAccountTx indicates an expected call of CreateAccountTx.
+func (mr *MockStoreMockRecorder) CreateAccountTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccountTx", reflect.TypeOf((*MockStore)(nil).CreateAccountTx), arg0, arg1)
+}
+
+// CreateAuditEvent mocks base method.
+func (m *MockStore) CreateAuditEvent(arg0 context.Context, arg1 db.CreateAuditEventParams) (db.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuditEvent", arg0, arg1)
+	ret0, _ := ret[0].(db.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAuditEvent indicates an expected call of CreateAuditEvent.
+func (mr *MockStoreMockRecorder) CreateAuditEvent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuditEvent", reflect.TypeOf((*MockStore)(nil).CreateAuditEvent), arg0, arg1)
+}
+
 // CreateEntry mocks base method.
 func (m *MockStore) CreateEntry(arg0 context.Context, arg1 db.CreateEntryParams) (db.Entry, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +168,96 @@ func (mr *MockStoreMockRecorder) CreateEntry(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateEntry", reflect.TypeOf((*MockStore)(nil).CreateEntry), arg0, arg1)
 }
 
+// CreateIdempotencyKey mocks base method.
+func (m *MockStore) CreateIdempotencyKey(arg0 context.Context, arg1 db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(db.IdempotencyKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateIdempotencyKey indicates an expected call of CreateIdempotencyKey.
+func (mr *MockStoreMockRecorder) CreateIdempotencyKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIdempotencyKey", reflect.TypeOf((*MockStore)(nil).CreateIdempotencyKey), arg0, arg1)
+}
+
+// CreateLoginAttempt mocks base method.
+func (m *MockStore) CreateLoginAttempt(arg0 context.Context, arg1 db.CreateLoginAttemptParams) (db.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginAttempt", arg0, arg1)
+	ret0, _ := ret[0].(db.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLoginAttempt indicates an expected call of CreateLoginAttempt.
+func (mr *MockStoreMockRecorder) CreateLoginAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginAttempt", reflect.TypeOf((*MockStore)(nil).CreateLoginAttempt), arg0, arg1)
+}
+
+// CreatePasswordResetToken mocks base method.
+func (m *MockStore) CreatePasswordResetToken(arg0 context.Context, arg1 db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", arg0, arg1)
+	ret0, _ := ret[0].(db.PasswordResetToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockStoreMockRecorder) CreatePasswordResetToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockStore)(nil).CreatePasswordResetToken), arg0, arg1)
+}
+
+// CreateSession mocks base method.
+func (m *MockStore) CreateSession(arg0 context.Context, arg1 db.CreateSessionParams) (db.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1)
+	ret0, _ := ret[0].(db.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockStoreMockRecorder) CreateSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockStore)(nil).CreateSession), arg0, arg1)
+}
+
+// CreateSessionTx mocks base method.
+func (m *MockStore) CreateSessionTx(arg0 context.Context, arg1 db.CreateSessionTxParams) (db.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSessionTx", arg0, arg1)
+	ret0, _ := ret[0].(db.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSessionTx indicates an expected call of CreateSessionTx.
+func (mr *MockStoreMockRecorder) CreateSessionTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSessionTx", reflect.TypeOf((*MockStore)(nil).CreateSessionTx), arg0, arg1)
+}
+
+// CreateTask mocks base method.
+func (m *MockStore) CreateTask(arg0 context.Context, arg1 db.CreateTaskParams) (db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTask", arg0, arg1)
+	ret0, _ := ret[0].(db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTask indicates an expected call of CreateTask.
+func (mr *MockStoreMockRecorder) CreateTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockStore)(nil).CreateTask), arg0, arg1)
+}
+
 // CreateTransfer mocks base method.
 func (m *MockStore) CreateTransfer(arg0 context.Context, arg1 db.CreateTransferParams) (db.Transfer, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +288,80 @@ func (mr *MockStoreMockRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStore)(nil).CreateUser), arg0, arg1)
 }
 
+// CreateUserTx mocks base method.
+func (m *MockStore) CreateUserTx(arg0 context.Context, arg1 db.CreateUserTxParams) (db.CreateUserTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserTx", arg0, arg1)
+	ret0, _ := ret[0].(db.CreateUserTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUserTx indicates an expected call of CreateUserTx.
+func (mr *MockStoreMockRecorder) CreateUserTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserTx", reflect.TypeOf((*MockStore)(nil).CreateUserTx), arg0, arg1)
+}
+
+// CreateVerifyEmail mocks base method.
+func (m *MockStore) CreateVerifyEmail(arg0 context.Context, arg1 db.CreateVerifyEmailParams) (db.VerifyEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateVerifyEmail", arg0, arg1)
+	ret0, _ := ret[0].(db.VerifyEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateVerifyEmail indicates an expected call of CreateVerifyEmail.
+func (mr *MockStoreMockRecorder) CreateVerifyEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVerifyEmail", reflect.TypeOf((*MockStore)(nil).CreateVerifyEmail), arg0, arg1)
+}
+
+// DeadLetterExpiredTasks mocks base method.
+func (m *MockStore) DeadLetterExpiredTasks(arg0 context.Context) ([]db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetterExpiredTasks", arg0)
+	ret0, _ := ret[0].([]db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetterExpiredTasks indicates an expected call of DeadLetterExpiredTasks.
+func (mr *MockStoreMockRecorder) DeadLetterExpiredTasks(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetterExpiredTasks", reflect.TypeOf((*MockStore)(nil).DeadLetterExpiredTasks), arg0)
+}
+
+// DeadLetterTask mocks base method.
+func (m *MockStore) DeadLetterTask(arg0 context.Context, arg1 db.DeadLetterTaskParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetterTask", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeadLetterTask indicates an expected call of DeadLetterTask.
+func (mr *MockStoreMockRecorder) DeadLetterTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetterTask", reflect.TypeOf((*MockStore)(nil).DeadLetterTask), arg0, arg1)
+}
+
+// DebitAccountBalance mocks base method.
+func (m *MockStore) DebitAccountBalance(arg0 context.Context, arg1 db.DebitAccountBalanceParams) (db.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DebitAccountBalance", arg0, arg1)
+	ret0, _ := ret[0].(db.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DebitAccountBalance indicates an expected call of DebitAccountBalance.
+func (mr *MockStoreMockRecorder) DebitAccountBalance(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebitAccountBalance", reflect.TypeOf((*MockStore)(nil).DebitAccountBalance), arg0, arg1)
+}
+
 // DeleteAccount mocks base method.
 func (m *MockStore) DeleteAccount(arg0 context.Context, arg1 int64) error {
 	m.ctrl.T.Helper()
@@ -109,6 +376,50 @@ func (mr *MockStoreMockRecorder) DeleteAccount(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccount", reflect.TypeOf((*MockStore)(nil).DeleteAccount), arg0, arg1)
 }
 
+// DeleteLoginAttempt mocks base method.
+func (m *MockStore) DeleteLoginAttempt(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoginAttempt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLoginAttempt indicates an expected call of DeleteLoginAttempt.
+func (mr *MockStoreMockRecorder) DeleteLoginAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoginAttempt", reflect.TypeOf((*MockStore)(nil).DeleteLoginAttempt), arg0, arg1)
+}
+
+// DepositTx mocks base method.
+func (m *MockStore) DepositTx(arg0 context.Context, arg1 db.CashTxParams) (db.CashTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DepositTx", arg0, arg1)
+	ret0, _ := ret[0].(db.CashTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DepositTx indicates an expected call of DepositTx.
+func (mr *MockStoreMockRecorder) DepositTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DepositTx", reflect.TypeOf((*MockStore)(nil).DepositTx), arg0, arg1)
+}
+
+// ExchangeTransferTx mocks base method.
+func (m *MockStore) ExchangeTransferTx(arg0 context.Context, arg1 db.ExchangeTransferTxParams) (db.TransferTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExchangeTransferTx", arg0, arg1)
+	ret0, _ := ret[0].(db.TransferTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExchangeTransferTx indicates an expected call of ExchangeTransferTx.
+func (mr *MockStoreMockRecorder) ExchangeTransferTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExchangeTransferTx", reflect.TypeOf((*MockStore)(nil).ExchangeTransferTx), arg0, arg1)
+}
+
 // GetAccount mocks base method.
 func (m *MockStore) GetAccount(arg0 context.Context, arg1 int64) (db.Account, error) {
 	m.ctrl.T.Helper()
@@ -154,6 +465,97 @@ func (mr *MockStoreMockRecorder) GetEntry(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntry", reflect.TypeOf((*MockStore)(nil).GetEntry), arg0, arg1)
 }
 
+// GetIdempotencyKey mocks base method.
+func (m *MockStore) GetIdempotencyKey(arg0 context.Context, arg1 db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(db.IdempotencyKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdempotencyKey indicates an expected call of GetIdempotencyKey.
+func (mr *MockStoreMockRecorder) GetIdempotencyKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotencyKey", reflect.TypeOf((*MockStore)(nil).GetIdempotencyKey), arg0, arg1)
+}
+
+// GetLoginFailures mocks base method.
+func (m *MockStore) GetLoginFailures(arg0 context.Context, arg1 db.GetLoginFailuresParams) (db.GetLoginFailuresRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginFailures", arg0, arg1)
+	ret0, _ := ret[0].(db.GetLoginFailuresRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginFailures indicates an expected call of GetLoginFailures.
+func (mr *MockStoreMockRecorder) GetLoginFailures(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginFailures", reflect.TypeOf((*MockStore)(nil).GetLoginFailures), arg0, arg1)
+}
+
+// GetRevokedToken mocks base method.
+func (m *MockStore) GetRevokedToken(arg0 context.Context, arg1 uuid.UUID) (db.RevokedToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevokedToken", arg0, arg1)
+	ret0, _ := ret[0].(db.RevokedToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevokedToken indicates an expected call of GetRevokedToken.
+func (mr *MockStoreMockRecorder) GetRevokedToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevokedToken", reflect.TypeOf((*MockStore)(nil).GetRevokedToken), arg0, arg1)
+}
+
+// GetSchemaVersion mocks base method.
+func (m *MockStore) GetSchemaVersion(arg0 context.Context) (int64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchemaVersion", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSchemaVersion indicates an expected call of GetSchemaVersion.
+func (mr *MockStoreMockRecorder) GetSchemaVersion(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchemaVersion", reflect.TypeOf((*MockStore)(nil).GetSchemaVersion), arg0)
+}
+
+// GetSession mocks base method.
+func (m *MockStore) GetSession(arg0 context.Context, arg1 uuid.UUID) (db.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", arg0, arg1)
+	ret0, _ := ret[0].(db.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockStoreMockRecorder) GetSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockStore)(nil).GetSession), arg0, arg1)
+}
+
+// GetTask mocks base method.
+func (m *MockStore) GetTask(arg0 context.Context, arg1 int64) (db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTask", arg0, arg1)
+	ret0, _ := ret[0].(db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTask indicates an expected call of GetTask.
+func (mr *MockStoreMockRecorder) GetTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockStore)(nil).GetTask), arg0, arg1)
+}
+
 // GetTransfer mocks base method.
 func (m *MockStore) GetTransfer(arg0 context.Context, arg1 int64) (db.Transfer, error) {
 	m.ctrl.T.Helper()
@@ -184,6 +586,125 @@ func (mr *MockStoreMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), arg0, arg1)
 }
 
+// GetUserByEmail mocks base method.
+func (m *MockStore) GetUserByEmail(arg0 context.Context, arg1 string) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockStoreMockRecorder) GetUserByEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockStore)(nil).GetUserByEmail), arg0, arg1)
+}
+
+// GetUserForUpdate mocks base method.
+func (m *MockStore) GetUserForUpdate(arg0 context.Context, arg1 string) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserForUpdate", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserForUpdate indicates an expected call of GetUserForUpdate.
+func (mr *MockStoreMockRecorder) GetUserForUpdate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserForUpdate", reflect.TypeOf((*MockStore)(nil).GetUserForUpdate), arg0, arg1)
+}
+
+// GetVerifyEmail mocks base method.
+func (m *MockStore) GetVerifyEmail(arg0 context.Context, arg1 int64) (db.VerifyEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVerifyEmail", arg0, arg1)
+	ret0, _ := ret[0].(db.VerifyEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVerifyEmail indicates an expected call of GetVerifyEmail.
+func (mr *MockStoreMockRecorder) GetVerifyEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVerifyEmail", reflect.TypeOf((*MockStore)(nil).GetVerifyEmail), arg0, arg1)
+}
+
+// InvalidatePasswordResetTokens mocks base method.
+func (m *MockStore) InvalidatePasswordResetTokens(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidatePasswordResetTokens", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidatePasswordResetTokens indicates an expected call of InvalidatePasswordResetTokens.
+func (mr *MockStoreMockRecorder) InvalidatePasswordResetTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidatePasswordResetTokens", reflect.TypeOf((*MockStore)(nil).InvalidatePasswordResetTokens), arg0, arg1)
+}
+
+// ListAccountEntries mocks base method.
+func (m *MockStore) ListAccountEntries(arg0 context.Context, arg1 db.ListAccountEntriesParams) ([]db.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccountEntries", arg0, arg1)
+	ret0, _ := ret[0].([]db.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccountEntries indicates an expected call of ListAccountEntries.
+func (mr *MockStoreMockRecorder) ListAccountEntries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccountEntries", reflect.TypeOf((*MockStore)(nil).ListAccountEntries), arg0, arg1)
+}
+
+// ListAccountEntriesAfter mocks base method.
+func (m *MockStore) ListAccountEntriesAfter(arg0 context.Context, arg1 db.ListAccountEntriesAfterParams) ([]db.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccountEntriesAfter", arg0, arg1)
+	ret0, _ := ret[0].([]db.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccountEntriesAfter indicates an expected call of ListAccountEntriesAfter.
+func (mr *MockStoreMockRecorder) ListAccountEntriesAfter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccountEntriesAfter", reflect.TypeOf((*MockStore)(nil).ListAccountEntriesAfter), arg0, arg1)
+}
+
+// ListAccountTransfers mocks base method.
+func (m *MockStore) ListAccountTransfers(arg0 context.Context, arg1 db.ListAccountTransfersParams) ([]db.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccountTransfers", arg0, arg1)
+	ret0, _ := ret[0].([]db.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccountTransfers indicates an expected call of ListAccountTransfers.
+func (mr *MockStoreMockRecorder) ListAccountTransfers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccountTransfers", reflect.TypeOf((*MockStore)(nil).ListAccountTransfers), arg0, arg1)
+}
+
+// ListAccountTransfersAfter mocks base method.
+func (m *MockStore) ListAccountTransfersAfter(arg0 context.Context, arg1 db.ListAccountTransfersAfterParams) ([]db.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccountTransfersAfter", arg0, arg1)
+	ret0, _ := ret[0].([]db.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccountTransfersAfter indicates an expected call of ListAccountTransfersAfter.
+func (mr *MockStoreMockRecorder) ListAccountTransfersAfter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccountTransfersAfter", reflect.TypeOf((*MockStore)(nil).ListAccountTransfersAfter), arg0, arg1)
+}
+
 // ListAccounts mocks base method.
 func (m *MockStore) ListAccounts(arg0 context.Context, arg1 db.ListAccountsParams) ([]db.Account, error) {
 	m.ctrl.T.Helper()
@@ -199,6 +720,51 @@ func (mr *MockStoreMockRecorder) ListAccounts(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccounts", reflect.TypeOf((*MockStore)(nil).ListAccounts), arg0, arg1)
 }
 
+// ListAccountsAfter mocks base method.
+func (m *MockStore) ListAccountsAfter(arg0 context.Context, arg1 db.ListAccountsAfterParams) ([]db.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccountsAfter", arg0, arg1)
+	ret0, _ := ret[0].([]db.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccountsAfter indicates an expected call of ListAccountsAfter.
+func (mr *MockStoreMockRecorder) ListAccountsAfter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccountsAfter", reflect.TypeOf((*MockStore)(nil).ListAccountsAfter), arg0, arg1)
+}
+
+// ListActiveRevokedTokens mocks base method.
+func (m *MockStore) ListActiveRevokedTokens(arg0 context.Context) ([]db.RevokedToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListActiveRevokedTokens", arg0)
+	ret0, _ := ret[0].([]db.RevokedToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListActiveRevokedTokens indicates an expected call of ListActiveRevokedTokens.
+func (mr *MockStoreMockRecorder) ListActiveRevokedTokens(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListActiveRevokedTokens", reflect.TypeOf((*MockStore)(nil).ListActiveRevokedTokens), arg0)
+}
+
+// ListAuditEvents mocks base method.
+func (m *MockStore) ListAuditEvents(arg0 context.Context, arg1 db.ListAuditEventsParams) ([]db.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAuditEvents", arg0, arg1)
+	ret0, _ := ret[0].([]db.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAuditEvents indicates an expected call of ListAuditEvents.
+func (mr *MockStoreMockRecorder) ListAuditEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAuditEvents", reflect.TypeOf((*MockStore)(nil).ListAuditEvents), arg0, arg1)
+}
+
 // ListEntries mocks base method.
 func (m *MockStore) ListEntries(arg0 context.Context, arg1 db.ListEntriesParams) ([]db.Entry, error) {
 	m.ctrl.T.Helper()
@@ -214,6 +780,21 @@ func (mr *MockStoreMockRecorder) ListEntries(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEntries", reflect.TypeOf((*MockStore)(nil).ListEntries), arg0, arg1)
 }
 
+// ListTokenRevocationsSince mocks base method.
+func (m *MockStore) ListTokenRevocationsSince(arg0 context.Context, arg1 time.Time) ([]db.ListTokenRevocationsSinceRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTokenRevocationsSince", arg0, arg1)
+	ret0, _ := ret[0].([]db.ListTokenRevocationsSinceRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTokenRevocationsSince indicates an expected call of ListTokenRevocationsSince.
+func (mr *MockStoreMockRecorder) ListTokenRevocationsSince(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTokenRevocationsSince", reflect.TypeOf((*MockStore)(nil).ListTokenRevocationsSince), arg0, arg1)
+}
+
 // ListTransfers mocks base method.
 func (m *MockStore) ListTransfers(arg0 context.Context, arg1 db.ListTransfersParams) ([]db.Transfer, error) {
 	m.ctrl.T.Helper()
@@ -229,6 +810,165 @@ func (mr *MockStoreMockRecorder) ListTransfers(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockStore)(nil).ListTransfers), arg0, arg1)
 }
 
+// LockLoginAttempts mocks base method.
+func (m *MockStore) LockLoginAttempts(arg0 context.Context, arg1 db.LockLoginAttemptsParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLoginAttempts", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLoginAttempts indicates an expected call of LockLoginAttempts.
+func (mr *MockStoreMockRecorder) LockLoginAttempts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLoginAttempts", reflect.TypeOf((*MockStore)(nil).LockLoginAttempts), arg0, arg1)
+}
+
+// LogoutAllTx mocks base method.
+func (m *MockStore) LogoutAllTx(arg0 context.Context, arg1 db.LogoutAllTxParams) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutAllTx", arg0, arg1)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LogoutAllTx indicates an expected call of LogoutAllTx.
+func (mr *MockStoreMockRecorder) LogoutAllTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutAllTx", reflect.TypeOf((*MockStore)(nil).LogoutAllTx), arg0, arg1)
+}
+
+// LogoutTx mocks base method.
+func (m *MockStore) LogoutTx(arg0 context.Context, arg1 db.LogoutTxParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutTx", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogoutTx indicates an expected call of LogoutTx.
+func (mr *MockStoreMockRecorder) LogoutTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutTx", reflect.TypeOf((*MockStore)(nil).LogoutTx), arg0, arg1)
+}
+
+// Ping mocks base method.
+func (m *MockStore) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockStoreMockRecorder) Ping(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping), arg0)
+}
+
+// ReserveLoginAttemptTx mocks base method.
+func (m *MockStore) ReserveLoginAttemptTx(arg0 context.Context, arg1 db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveLoginAttemptTx", arg0, arg1)
+	ret0, _ := ret[0].(db.ReserveLoginAttemptTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveLoginAttemptTx indicates an expected call of ReserveLoginAttemptTx.
+func (mr *MockStoreMockRecorder) ReserveLoginAttemptTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveLoginAttemptTx", reflect.TypeOf((*MockStore)(nil).ReserveLoginAttemptTx), arg0, arg1)
+}
+
+// ResetPasswordTx mocks base method.
+func (m *MockStore) ResetPasswordTx(arg0 context.Context, arg1 db.ResetPasswordTxParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPasswordTx", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPasswordTx indicates an expected call of ResetPasswordTx.
+func (mr *MockStoreMockRecorder) ResetPasswordTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPasswordTx", reflect.TypeOf((*MockStore)(nil).ResetPasswordTx), arg0, arg1)
+}
+
+// RetryTask mocks base method.
+func (m *MockStore) RetryTask(arg0 context.Context, arg1 db.RetryTaskParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTask", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryTask indicates an expected call of RetryTask.
+func (mr *MockStoreMockRecorder) RetryTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTask", reflect.TypeOf((*MockStore)(nil).RetryTask), arg0, arg1)
+}
+
+// RevokeToken mocks base method.
+func (m *MockStore) RevokeToken(arg0 context.Context, arg1 db.RevokeTokenParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockStoreMockRecorder) RevokeToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockStore)(nil).RevokeToken), arg0, arg1)
+}
+
+// RevokeUserTokens mocks base method.
+func (m *MockStore) RevokeUserTokens(arg0 context.Context, arg1 db.RevokeUserTokensParams) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserTokens", arg0, arg1)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeUserTokens indicates an expected call of RevokeUserTokens.
+func (mr *MockStoreMockRecorder) RevokeUserTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserTokens", reflect.TypeOf((*MockStore)(nil).RevokeUserTokens), arg0, arg1)
+}
+
+// SetUserFrozenTx mocks base method.
+func (m *MockStore) SetUserFrozenTx(arg0 context.Context, arg1 db.SetUserFrozenTxParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserFrozenTx", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetUserFrozenTx indicates an expected call of SetUserFrozenTx.
+func (mr *MockStoreMockRecorder) SetUserFrozenTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserFrozenTx", reflect.TypeOf((*MockStore)(nil).SetUserFrozenTx), arg0, arg1)
+}
+
+// SucceedLoginAttempt mocks base method.
+func (m *MockStore) SucceedLoginAttempt(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SucceedLoginAttempt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SucceedLoginAttempt indicates an expected call of SucceedLoginAttempt.
+func (mr *MockStoreMockRecorder) SucceedLoginAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SucceedLoginAttempt", reflect.TypeOf((*MockStore)(nil).SucceedLoginAttempt), arg0, arg1)
+}
+
 // TransferTx mocks base method.
 func (m *MockStore) TransferTx(arg0 context.Context, arg1 db.TransferTxParams) (db.TransferTxResult, error) {
 	m.ctrl.T.Helper()
@@ -244,6 +984,20 @@ func (mr *MockStoreMockRecorder) TransferTx(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferTx", reflect.TypeOf((*MockStore)(nil).TransferTx), arg0, arg1)
 }
 
+// UnlockLoginTx mocks base method.
+func (m *MockStore) UnlockLoginTx(arg0 context.Context, arg1 db.UnlockLoginTxParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlockLoginTx", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlockLoginTx indicates an expected call of UnlockLoginTx.
+func (mr *MockStoreMockRecorder) UnlockLoginTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockLoginTx", reflect.TypeOf((*MockStore)(nil).UnlockLoginTx), arg0, arg1)
+}
+
 // UpdateAccount mocks base method.
 func (m *MockStore) UpdateAccount(arg0 context.Context, arg1 db.UpdateAccountParams) (db.Account, error) {
 	m.ctrl.T.Helper()
@@ -273,3 +1027,152 @@ func (mr *MockStoreMockRecorder) UpdateAccountBalance(arg0, arg1 interface{}) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAccountBalance", reflect.TypeOf((*MockStore)(nil).UpdateAccountBalance), arg0, arg1)
 }
+
+// UpdateIdempotencyKeyResponse mocks base method.
+func (m *MockStore) UpdateIdempotencyKeyResponse(arg0 context.Context, arg1 db.UpdateIdempotencyKeyResponseParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateIdempotencyKeyResponse", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateIdempotencyKeyResponse indicates an expected call of UpdateIdempotencyKeyResponse.
+func (mr *MockStoreMockRecorder) UpdateIdempotencyKeyResponse(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateIdempotencyKeyResponse", reflect.TypeOf((*MockStore)(nil).UpdateIdempotencyKeyResponse), arg0, arg1)
+}
+
+// UpdateUser mocks base method.
+func (m *MockStore) UpdateUser(arg0 context.Context, arg1 db.UpdateUserParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockStoreMockRecorder) UpdateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockStore)(nil).UpdateUser), arg0, arg1)
+}
+
+// UpdateUserFrozen mocks base method.
+func (m *MockStore) UpdateUserFrozen(arg0 context.Context, arg1 db.UpdateUserFrozenParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserFrozen", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserFrozen indicates an expected call of UpdateUserFrozen.
+func (mr *MockStoreMockRecorder) UpdateUserFrozen(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserFrozen", reflect.TypeOf((*MockStore)(nil).UpdateUserFrozen), arg0, arg1)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockStore) UpdateUserPassword(arg0 context.Context, arg1 db.UpdateUserPasswordParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockStoreMockRecorder) UpdateUserPassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockStore)(nil).UpdateUserPassword), arg0, arg1)
+}
+
+// UpdateUserTx mocks base method.
+func (m *MockStore) UpdateUserTx(arg0 context.Context, arg1 db.UpdateUserTxParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserTx", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserTx indicates an expected call of UpdateUserTx.
+func (mr *MockStoreMockRecorder) UpdateUserTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserTx", reflect.TypeOf((*MockStore)(nil).UpdateUserTx), arg0, arg1)
+}
+
+// UsePasswordResetToken mocks base method.
+func (m *MockStore) UsePasswordResetToken(arg0 context.Context, arg1 string) (db.PasswordResetToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UsePasswordResetToken", arg0, arg1)
+	ret0, _ := ret[0].(db.PasswordResetToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UsePasswordResetToken indicates an expected call of UsePasswordResetToken.
+func (mr *MockStoreMockRecorder) UsePasswordResetToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UsePasswordResetToken", reflect.TypeOf((*MockStore)(nil).UsePasswordResetToken), arg0, arg1)
+}
+
+// UseVerifyEmail mocks base method.
+func (m *MockStore) UseVerifyEmail(arg0 context.Context, arg1 db.UseVerifyEmailParams) (db.VerifyEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseVerifyEmail", arg0, arg1)
+	ret0, _ := ret[0].(db.VerifyEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseVerifyEmail indicates an expected call of UseVerifyEmail.
+func (mr *MockStoreMockRecorder) UseVerifyEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseVerifyEmail", reflect.TypeOf((*MockStore)(nil).UseVerifyEmail), arg0, arg1)
+}
+
+// VerifyEmailTx mocks base method.
+func (m *MockStore) VerifyEmailTx(arg0 context.Context, arg1 db.VerifyEmailTxParams) (db.VerifyEmailTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmailTx", arg0, arg1)
+	ret0, _ := ret[0].(db.VerifyEmailTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyEmailTx indicates an expected call of VerifyEmailTx.
+func (mr *MockStoreMockRecorder) VerifyEmailTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmailTx", reflect.TypeOf((*MockStore)(nil).VerifyEmailTx), arg0, arg1)
+}
+
+// VerifyUserEmail mocks base method.
+func (m *MockStore) VerifyUserEmail(arg0 context.Context, arg1 db.VerifyUserEmailParams) (db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyUserEmail", arg0, arg1)
+	ret0, _ := ret[0].(db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyUserEmail indicates an expected call of VerifyUserEmail.
+func (mr *MockStoreMockRecorder) VerifyUserEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyUserEmail", reflect.TypeOf((*MockStore)(nil).VerifyUserEmail), arg0, arg1)
+}
+
+// WithdrawTx mocks base method.
+func (m *MockStore) WithdrawTx(arg0 context.Context, arg1 db.CashTxParams) (db.CashTxResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithdrawTx", arg0, arg1)
+	ret0, _ := ret[0].(db.CashTxResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WithdrawTx indicates an expected call of WithdrawTx.
+func (mr *MockStoreMockRecorder) WithdrawTx(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithdrawTx", reflect.TypeOf((*MockStore)(nil).WithdrawTx), arg0, arg1)
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"testing"
 	"time"
 
@@ -84,7 +83,7 @@ func TestDeleteAccount(t *testing.T) {
 	account2, err := testQueries.GetAccount(context.Background(), account1.ID)
 
 	require.Error(t, err)
-	require.EqualError(t, err, sql.ErrNoRows.Error())
+	require.ErrorIs(t, err, ErrRecordNotFound)
 	require.Empty(t, account2)
 }
 
@@ -109,3 +108,55 @@ func TestListAccount(t *testing.T) {
 		require.Equal(t, lastAccount.Owner, account.Owner)
 	}
 }
+
+func TestListAccountsAfter(t *testing.T) {
+	user := CreateRandomUser(t)
+
+	var created []Account
+	for _, currency := range []string{util.USD, util.EUR, util.CAD} {
+		account, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+			Owner:    user.Username,
+			Currency: currency,
+		})
+		require.NoError(t, err)
+		created = append(created, account)
+	}
+
+	// first page
+	accounts, err := testQueries.ListAccountsAfter(context.Background(), ListAccountsAfterParams{
+		Owner: user.Username,
+		Limit: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, created[0].ID, accounts[0].ID)
+	require.Equal(t, created[1].ID, accounts[1].ID)
+
+	// the next page starts right after the last account of the first one
+	accounts, err = testQueries.ListAccountsAfter(context.Background(), ListAccountsAfterParams{
+		Owner:          user.Username,
+		AfterCreatedAt: accounts[1].CreatedAt,
+		AfterID:        accounts[1].ID,
+		Limit:          2,
+	})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, created[2].ID, accounts[0].ID)
+}
+
+func TestDebitAccountBalance(t *testing.T) {
+	account1 := createRandomAccount(t)
+
+	account2, err := testQueries.DebitAccountBalance(context.Background(), DebitAccountBalanceParams{
+		ID:     account1.ID,
+		Amount: account1.Balance,
+	})
+	require.NoError(t, err)
+	require.Zero(t, account2.Balance)
+
+	_, err = testQueries.DebitAccountBalance(context.Background(), DebitAccountBalanceParams{
+		ID:     account1.ID,
+		Amount: 1,
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+)
+
+// CreateAccountTxParams contains the input parameters of the create account transaction
+type CreateAccountTxParams struct {
+	CreateAccountParams
+	Audit AuditParams
+}
+
+// CreateAccountTx creates an account and records it in the audit log within a single database transaction.
+func (store *SQLStore) CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (Account, error) {
+	ctx, span := startTx(ctx, "CreateAccountTx")
+
+	var account Account
+
+	err := store.execTx(ctx, "CreateAccountTx", func(q *Queries) error {
+
+		var err error
+
+		account, err = q.CreateAccount(ctx, arg.CreateAccountParams)
+		if err != nil {
+			return err
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditAccountCreated,
+			TargetType: AuditTargetAccount,
+			TargetID:   auditID(account.ID),
+			After:      account,
+		})
+	})
+
+	endTx(span, err)
+	return account, err
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditUserCreated       = "user.created"
+	AuditEmailVerified     = "user.email_verified"
+	AuditPasswordReset     = "user.password_reset"
+	AuditUserUpdated       = "user.updated"
+	AuditUserFrozen        = "user.frozen"
+	AuditUserUnfrozen      = "user.unfrozen"
+	AuditAccountCreated    = "account.created"
+	AuditDepositCreated    = "deposit.created"
+	AuditWithdrawalCreated = "withdrawal.created"
+	AuditTransferCreated   = "transfer.created"
+	AuditLoginSucceeded    = "login.succeeded"
+	AuditLoginFailed       = "login.failed"
+	AuditLoginUnlocked     = "login.unlocked"
+	AuditLogout            = "logout"
+	AuditLogoutAll         = "logout.all"
+)
+
+// Types of the audit event targets
+const (
+	AuditTargetUser     = "user"
+	AuditTargetAccount  = "account"
+	AuditTargetTransfer = "transfer"
+	AuditTargetSession  = "session"
+)
+
+// AuditParams describes who performs a state-changing operation.
+// It is recorded in the audit log within the transaction of the operation.
+type AuditParams struct {
+	Actor     string
+	ClientIP  string
+	UserAgent string
+}
+
+// auditEvent is an audit log entry, Before and After are stored as JSON and left null when nil
+type auditEvent struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// recordAuditEvent writes the audit log entry of an operation with the queries of its transaction
+func recordAuditEvent(ctx context.Context, q *Queries, audit AuditParams, event auditEvent) error {
+	before, err := auditState(event.Before)
+	if err != nil {
+		return err
+	}
+
+	after, err := auditState(event.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateAuditEvent(ctx, CreateAuditEventParams{
+		Actor:      audit.Actor,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		ClientIp:   audit.ClientIP,
+		UserAgent:  audit.UserAgent,
+		Before:     before,
+		After:      after,
+	})
+	return err
+}
+
+// auditState encodes the state of an audit target, nil is stored as null
+func auditState(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode audit state: %w", err)
+	}
+
+	return data, nil
+}
+
+// auditID formats the ID of an audit target
+func auditID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// userState is the audited state of a user, without the hashed password
+type userState struct {
+	Username        string `json:"username"`
+	FullName        string `json:"full_name"`
+	Email           string `json:"email"`
+	Role            string `json:"role"`
+	IsFrozen        bool   `json:"is_frozen"`
+	IsEmailVerified bool   `json:"is_email_verified"`
+}
+
+func newUserState(user User) userState {
+	return userState{
+		Username:        user.Username,
+		FullName:        user.FullName,
+		Email:           user.Email,
+		Role:            user.Role,
+		IsFrozen:        user.IsFrozen,
+		IsEmailVerified: user.IsEmailVerified,
+	}
+}
+
+// sessionState is the audited state of a session, without the refresh token
+type sessionState struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newSessionState(session Session) sessionState {
+	return sessionState{
+		ID:        session.ID.String(),
+		Username:  session.Username,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+// transferState is the audited state of a transfer: the balances of both accounts and the transfer once created
+type transferState struct {
+	Transfer           *Transfer `json:"transfer,omitempty"`
+	FromAccountBalance int64     `json:"from_account_balance"`
+	ToAccountBalance   int64     `json:"to_account_balance"`
+}
+
+// cashState is the audited state of a deposit or withdrawal: the account balance and the entry once created
+type cashState struct {
+	Entry   *Entry `json:"entry,omitempty"`
+	Balance int64  `json:"balance"`
+}
+
+// logoutState is the audited state of a logout: the revoked access token and the blocked session if any
+type logoutState struct {
+	TokenID   string `json:"token_id"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// revocationState is the audited state of a logout from all sessions
+type revocationState struct {
+	TokensRevokedAt time.Time `json:"tokens_revoked_at"`
+}
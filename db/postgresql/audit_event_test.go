@@ -0,0 +1,329 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+// auditEventsOf lists every audit event of the actor
+func auditEventsOf(t *testing.T, actor string) []AuditEvent {
+	events, err := testQueries.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		Actor:   actor,
+		EndTime: time.Now().Add(time.Hour),
+		Limit:   100,
+	})
+	require.NoError(t, err)
+	return events
+}
+
+func TestListAuditEvents(t *testing.T) {
+	actor := util.RandomOwner()
+
+	var created []AuditEvent
+	for _, action := range []string{AuditLoginFailed, AuditLoginFailed, AuditLoginSucceeded} {
+		event, err := testQueries.CreateAuditEvent(context.Background(), CreateAuditEventParams{
+			Actor:      actor,
+			Action:     action,
+			TargetType: AuditTargetUser,
+			TargetID:   actor,
+			ClientIp:   "127.0.0.1",
+			UserAgent:  "test",
+		})
+		require.NoError(t, err)
+		require.Nil(t, event.Before)
+		require.Nil(t, event.After)
+		created = append(created, event)
+	}
+
+	arg := ListAuditEventsParams{
+		Actor:   actor,
+		Action:  AuditLoginFailed,
+		EndTime: time.Now().Add(time.Hour),
+		Limit:   1,
+	}
+
+	// first page
+	events, err := testQueries.ListAuditEvents(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, created[0].ID, events[0].ID)
+
+	// the next page starts right after the last event of the first one
+	arg.AfterCreatedAt = events[0].CreatedAt
+	arg.AfterID = events[0].ID
+	events, err = testQueries.ListAuditEvents(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, created[1].ID, events[0].ID)
+
+	// empty filters match every event
+	require.Len(t, auditEventsOf(t, actor), 3)
+}
+
+func TestCreateUserTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	arg := CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	}
+
+	result, err := store.CreateUserTx(context.Background(), CreateUserTxParams{
+		CreateUserParams: arg,
+		SecretCode:       util.RandomString(32),
+		Audit:            AuditParams{Actor: arg.Username, ClientIP: "127.0.0.1", UserAgent: "test"},
+	})
+	require.NoError(t, err)
+	user := result.User
+	require.Equal(t, arg.Username, user.Username)
+
+	events := auditEventsOf(t, arg.Username)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditUserCreated, events[0].Action)
+	require.Equal(t, AuditTargetUser, events[0].TargetType)
+	require.Equal(t, user.Username, events[0].TargetID)
+	require.Equal(t, "127.0.0.1", events[0].ClientIp)
+	require.Nil(t, events[0].Before)
+
+	// the hashed password is not recorded
+	var after map[string]interface{}
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.Equal(t, user.Email, after["email"])
+	require.NotContains(t, after, "hashed_password")
+
+	// a failed creation is rolled back with its audit event
+	_, err = store.CreateUserTx(context.Background(), CreateUserTxParams{
+		CreateUserParams: arg,
+		SecretCode:       util.RandomString(32),
+		Audit:            AuditParams{Actor: arg.Username},
+	})
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+	require.Len(t, auditEventsOf(t, arg.Username), 1)
+}
+
+func TestCreateAccountTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+	user := CreateRandomUser(t)
+
+	account, err := store.CreateAccountTx(context.Background(), CreateAccountTxParams{
+		CreateAccountParams: CreateAccountParams{
+			Owner:    user.Username,
+			Currency: util.USD,
+		},
+		Audit: AuditParams{Actor: user.Username},
+	})
+	require.NoError(t, err)
+
+	events := auditEventsOf(t, user.Username)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditAccountCreated, events[0].Action)
+	require.Equal(t, AuditTargetAccount, events[0].TargetType)
+	require.Equal(t, auditID(account.ID), events[0].TargetID)
+}
+
+func TestTransferTxAudit(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	amount := int64(10)
+	account1 := createRandomAccountWithBalance(t, amount)
+	account2 := createRandomAccount(t)
+
+	arg := TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        amount,
+		Audit:         &AuditParams{Actor: account1.Owner},
+		Idempotency: &IdempotencyParams{
+			Username:    account1.Owner,
+			Key:         util.RandomString(16),
+			RequestHash: util.RandomString(16),
+		},
+	}
+
+	result, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	// a replay is not recorded again
+	_, err = store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	events := auditEventsOf(t, account1.Owner)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditTransferCreated, events[0].Action)
+	require.Equal(t, auditID(result.Transfer.ID), events[0].TargetID)
+
+	var before, after transferState
+	require.NoError(t, json.Unmarshal(events[0].Before, &before))
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+
+	require.Nil(t, before.Transfer)
+	require.Equal(t, account1.Balance, before.FromAccountBalance)
+	require.Equal(t, account2.Balance, before.ToAccountBalance)
+
+	require.Equal(t, result.Transfer.ID, after.Transfer.ID)
+	require.Equal(t, account1.Balance-amount, after.FromAccountBalance)
+	require.Equal(t, account2.Balance+amount, after.ToAccountBalance)
+}
+
+func TestCashTxAudit(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	amount := int64(10)
+	account := createRandomAccount(t)
+	actor := util.RandomOwner()
+
+	deposit, err := store.DepositTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    amount,
+		Reference: util.RandomString(12),
+		Audit:     AuditParams{Actor: actor},
+	})
+	require.NoError(t, err)
+
+	withdrawal, err := store.WithdrawTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    amount,
+		Reference: util.RandomString(12),
+		Audit:     AuditParams{Actor: actor},
+	})
+	require.NoError(t, err)
+
+	// a failed withdrawal is rolled back with its audit event
+	_, err = store.WithdrawTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    account.Balance + 1,
+		Reference: util.RandomString(12),
+		Audit:     AuditParams{Actor: actor},
+	})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	events := auditEventsOf(t, actor)
+	require.Len(t, events, 2)
+
+	require.Equal(t, AuditDepositCreated, events[0].Action)
+	require.Equal(t, AuditWithdrawalCreated, events[1].Action)
+
+	for i, entry := range []Entry{deposit.Entry, withdrawal.Entry} {
+		require.Equal(t, AuditTargetAccount, events[i].TargetType)
+		require.Equal(t, auditID(account.ID), events[i].TargetID)
+
+		var after cashState
+		require.NoError(t, json.Unmarshal(events[i].After, &after))
+		require.Equal(t, entry.ID, after.Entry.ID)
+	}
+
+	var before, after cashState
+	require.NoError(t, json.Unmarshal(events[0].Before, &before))
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.Equal(t, account.Balance, before.Balance)
+	require.Equal(t, account.Balance+amount, after.Balance)
+}
+
+func TestSetUserFrozenTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+	session := createRandomSession(t)
+	actor := util.RandomOwner()
+
+	user, err := store.SetUserFrozenTx(context.Background(), SetUserFrozenTxParams{
+		Username: session.Username,
+		IsFrozen: true,
+		Audit:    AuditParams{Actor: actor},
+	})
+	require.NoError(t, err)
+	require.True(t, user.IsFrozen)
+	require.WithinDuration(t, time.Now(), user.TokensRevokedAt, time.Second)
+
+	// freezing blocks the sessions
+	blocked, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	user, err = store.SetUserFrozenTx(context.Background(), SetUserFrozenTxParams{
+		Username: session.Username,
+		IsFrozen: false,
+		Audit:    AuditParams{Actor: actor},
+	})
+	require.NoError(t, err)
+	require.False(t, user.IsFrozen)
+
+	events := auditEventsOf(t, actor)
+	require.Len(t, events, 2)
+	require.Equal(t, AuditUserFrozen, events[0].Action)
+	require.Equal(t, AuditUserUnfrozen, events[1].Action)
+	require.Equal(t, session.Username, events[0].TargetID)
+
+	var before, after userState
+	require.NoError(t, json.Unmarshal(events[0].Before, &before))
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.False(t, before.IsFrozen)
+	require.True(t, after.IsFrozen)
+
+	_, err = store.SetUserFrozenTx(context.Background(), SetUserFrozenTxParams{
+		Username: util.RandomOwner(),
+		IsFrozen: true,
+		Audit:    AuditParams{Actor: actor},
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestLogoutTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+	session := createRandomSession(t)
+
+	arg := LogoutTxParams{
+		Token: RevokeTokenParams{
+			ID:        uuid.New(),
+			Username:  session.Username,
+			ExpiresAt: time.Now().Add(time.Minute),
+		},
+		SessionID: session.ID,
+		Audit:     AuditParams{Actor: session.Username},
+	}
+	require.NoError(t, store.LogoutTx(context.Background(), arg))
+
+	revoked, err := testQueries.GetRevokedToken(context.Background(), arg.Token.ID)
+	require.NoError(t, err)
+	require.Equal(t, session.Username, revoked.Username)
+
+	blocked, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	events := auditEventsOf(t, session.Username)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditLogout, events[0].Action)
+
+	var after logoutState
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.Equal(t, arg.Token.ID.String(), after.TokenID)
+	require.Equal(t, session.ID.String(), after.SessionID)
+}
+
+func TestLogoutAllTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+	session := createRandomSession(t)
+
+	tokensRevokedAt, err := store.LogoutAllTx(context.Background(), LogoutAllTxParams{
+		Username: session.Username,
+		Audit:    AuditParams{Actor: session.Username},
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), tokensRevokedAt, time.Second)
+
+	blocked, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	events := auditEventsOf(t, session.Username)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditLogoutAll, events[0].Action)
+	require.Equal(t, session.Username, events[0].TargetID)
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+)
+
+// CashTxParams contains the input parameters of a deposit or withdrawal transaction
+type CashTxParams struct {
+	AccountID int64       `json:"account_id"`
+	Amount    int64       `json:"amount"`
+	Reference string      `json:"reference"`
+	Audit     AuditParams `json:"-"`
+}
+
+// CashTxResult is the output result of a deposit or withdrawal transaction
+type CashTxResult struct {
+	Account Account `json:"account"`
+	Entry   Entry   `json:"entry"`
+}
+
+// DepositTx adds external cash to an account.
+// It updates the account balance, creates the account entry and records the deposit in the audit log
+// within a single database transaction.
+func (store *SQLStore) DepositTx(ctx context.Context, arg CashTxParams) (CashTxResult, error) {
+	ctx, span := startTx(ctx, "DepositTx")
+
+	var result CashTxResult
+
+	err := store.execTx(ctx, "DepositTx", func(q *Queries) error {
+
+		var err error
+
+		result.Account, err = q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
+			ID:     arg.AccountID,
+			Amount: arg.Amount,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Entry, err = q.CreateEntry(ctx, CreateEntryParams{
+			AccountID:    arg.AccountID,
+			Amount:       arg.Amount,
+			Reference:    arg.Reference,
+			BalanceAfter: result.Account.Balance,
+		})
+		if err != nil {
+			return err
+		}
+
+		return recordCashEvent(ctx, q, arg.Audit, AuditDepositCreated, result, arg.Amount)
+	})
+
+	endTx(span, err)
+	return result, err
+}
+
+// WithdrawTx takes cash out of an account.
+// The account row is locked while the balance is checked, so concurrent withdrawals cannot overdraw it.
+// It returns ErrInsufficientFunds if the balance is lower than the amount.
+// The withdrawal is recorded in the audit log within the same transaction.
+func (store *SQLStore) WithdrawTx(ctx context.Context, arg CashTxParams) (CashTxResult, error) {
+	ctx, span := startTx(ctx, "WithdrawTx")
+
+	var result CashTxResult
+
+	err := store.execTx(ctx, "WithdrawTx", func(q *Queries) error {
+
+		account, err := q.GetAccountForUpdate(ctx, arg.AccountID)
+		if err != nil {
+			return err
+		}
+
+		if account.Balance < arg.Amount {
+			return ErrInsufficientFunds
+		}
+
+		result.Account, err = q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
+			ID:     arg.AccountID,
+			Amount: -arg.Amount,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Entry, err = q.CreateEntry(ctx, CreateEntryParams{
+			AccountID:    arg.AccountID,
+			Amount:       -arg.Amount,
+			Reference:    arg.Reference,
+			BalanceAfter: result.Account.Balance,
+		})
+		if err != nil {
+			return err
+		}
+
+		return recordCashEvent(ctx, q, arg.Audit, AuditWithdrawalCreated, result, -arg.Amount)
+	})
+
+	endTx(span, err)
+	return result, err
+}
+
+// recordCashEvent records a deposit or withdrawal of amount, negative for a withdrawal, in the audit log
+func recordCashEvent(ctx context.Context, q *Queries, audit AuditParams, action string, result CashTxResult, amount int64) error {
+	return recordAuditEvent(ctx, q, audit, auditEvent{
+		Action:     action,
+		TargetType: AuditTargetAccount,
+		TargetID:   auditID(result.Account.ID),
+		Before: cashState{
+			Balance: result.Account.Balance - amount,
+		},
+		After: cashState{
+			Entry:   &result.Entry,
+			Balance: result.Account.Balance,
+		},
+	})
+}
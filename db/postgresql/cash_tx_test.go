@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepositTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	account := createRandomAccount(t)
+	amount := int64(10)
+	reference := util.RandomString(12)
+
+	result, err := store.DepositTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    amount,
+		Reference: reference,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, account.ID, result.Entry.AccountID)
+	require.Equal(t, amount, result.Entry.Amount)
+	require.Equal(t, reference, result.Entry.Reference)
+
+	require.Equal(t, account.ID, result.Account.ID)
+	require.Equal(t, account.Balance+amount, result.Account.Balance)
+}
+
+func TestWithdrawTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	account := createRandomAccount(t)
+	reference := util.RandomString(12)
+
+	result, err := store.WithdrawTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    account.Balance,
+		Reference: reference,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, -account.Balance, result.Entry.Amount)
+	require.Equal(t, reference, result.Entry.Reference)
+	require.Zero(t, result.Account.Balance)
+
+	// the account is empty now
+	_, err = store.WithdrawTx(context.Background(), CashTxParams{
+		AccountID: account.ID,
+		Amount:    1,
+		Reference: reference,
+	})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	updatedAccount, err := testQueries.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Zero(t, updatedAccount.Balance)
+}
@@ -10,10 +10,17 @@ import (
 const (
 	ForeignKeyViolation = "23503"
 	UniqueViolation     = "23505"
+	DeadlockDetected    = "40P01"
 )
 
 var ErrRecordNotFound = pgx.ErrNoRows
 
+// ErrInsufficientFunds is returned when a debit would make the account balance negative
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
 var ErrUniqueViolation = &pgconn.PgError{
 	Code: UniqueViolation,
 }
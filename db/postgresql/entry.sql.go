@@ -7,52 +7,179 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 const createEntry = `-- name: CreateEntry :one
 INSERT INTO entries (
-  amount, account_id
+  amount, account_id, reference, balance_after, created_at
 ) VALUES (
-  $1, $2
-)RETURNING id, account_id, amount, created_at
+  $1, $2, $3, $4, clock_timestamp()
+)RETURNING id, account_id, amount, created_at, reference, balance_after
 `
 
 type CreateEntryParams struct {
-	Amount    int64 `json:"amount"`
-	AccountID int64 `json:"account_id"`
+	Amount       int64  `json:"amount"`
+	AccountID    int64  `json:"account_id"`
+	Reference    string `json:"reference"`
+	BalanceAfter int64  `json:"balance_after"`
 }
 
+// the entry is created once the account balance is updated, created_at is taken after the account row is locked
+// so the entries of an account are in the order of their balance_after
 func (q *Queries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, createEntry, arg.Amount, arg.AccountID)
+	row := q.db.QueryRow(ctx, createEntry,
+		arg.Amount,
+		arg.AccountID,
+		arg.Reference,
+		arg.BalanceAfter,
+	)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Reference,
+		&i.BalanceAfter,
 	)
 	return i, err
 }
 
 const getEntry = `-- name: GetEntry :one
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, reference, balance_after FROM entries
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetEntry(ctx context.Context, id int64) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, getEntry, id)
+	row := q.db.QueryRow(ctx, getEntry, id)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Reference,
+		&i.BalanceAfter,
 	)
 	return i, err
 }
 
+const listAccountEntries = `-- name: ListAccountEntries :many
+SELECT id, account_id, amount, created_at, reference, balance_after FROM entries
+WHERE account_id = $1
+  AND created_at >= $2 AND created_at < $3
+  AND abs(amount) BETWEEN $4::bigint AND $5::bigint
+ORDER BY created_at, id
+LIMIT $6
+OFFSET $7
+`
+
+type ListAccountEntriesParams struct {
+	AccountID int64     `json:"account_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	MinAmount int64     `json:"min_amount"`
+	MaxAmount int64     `json:"max_amount"`
+	Limit     int32     `json:"limit"`
+	Offset    int32     `json:"offset"`
+}
+
+func (q *Queries) ListAccountEntries(ctx context.Context, arg ListAccountEntriesParams) ([]Entry, error) {
+	rows, err := q.db.Query(ctx, listAccountEntries,
+		arg.AccountID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Reference,
+			&i.BalanceAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountEntriesAfter = `-- name: ListAccountEntriesAfter :many
+SELECT id, account_id, amount, created_at, reference, balance_after FROM entries
+WHERE account_id = $1
+  AND (created_at, id) > ($2::timestamptz, $3::bigint)
+  AND created_at >= $4 AND created_at < $5
+  AND abs(amount) BETWEEN $6::bigint AND $7::bigint
+ORDER BY created_at, id
+LIMIT $8
+`
+
+type ListAccountEntriesAfterParams struct {
+	AccountID      int64     `json:"account_id"`
+	AfterCreatedAt time.Time `json:"after_created_at"`
+	AfterID        int64     `json:"after_id"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	MinAmount      int64     `json:"min_amount"`
+	MaxAmount      int64     `json:"max_amount"`
+	Limit          int32     `json:"limit"`
+}
+
+// keyset pagination variant of ListAccountEntries, returns the entries after the (created_at, id) cursor
+func (q *Queries) ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]Entry, error) {
+	rows, err := q.db.Query(ctx, listAccountEntriesAfter,
+		arg.AccountID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Reference,
+			&i.BalanceAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listEntries = `-- name: ListEntries :many
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, reference, balance_after FROM entries
 WHERE account_id = $1
 ORDER BY id
 LIMIT $2
@@ -66,7 +193,7 @@ type ListEntriesParams struct {
 }
 
 func (q *Queries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error) {
-	rows, err := q.db.QueryContext(ctx, listEntries, arg.AccountID, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listEntries, arg.AccountID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -79,14 +206,13 @@ func (q *Queries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Ent
 			&i.AccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.Reference,
+			&i.BalanceAfter,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
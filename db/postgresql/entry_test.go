@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -10,8 +12,9 @@ import (
 func createRandomEntry(t *testing.T, account Account) Entry {
 
 	arg := CreateEntryParams{
-		AccountID: account.ID,
-		Amount:    100,
+		AccountID:    account.ID,
+		Amount:       100,
+		BalanceAfter: account.Balance,
 	}
 
 	entry, err := testQueries.CreateEntry(context.Background(), arg)
@@ -21,6 +24,7 @@ func createRandomEntry(t *testing.T, account Account) Entry {
 
 	require.Equal(t, arg.AccountID, entry.AccountID)
 	require.Equal(t, arg.Amount, entry.Amount)
+	require.Equal(t, arg.BalanceAfter, entry.BalanceAfter)
 
 	require.NotZero(t, entry.ID)
 	require.NotZero(t, entry.CreatedAt)
@@ -46,6 +50,7 @@ func TestGetEntry(t *testing.T) {
 	require.Equal(t, entry1.ID, entry2.ID)
 	require.Equal(t, entry1.AccountID, entry2.AccountID)
 	require.Equal(t, entry1.Amount, entry2.Amount)
+	require.Equal(t, entry1.BalanceAfter, entry2.BalanceAfter)
 	require.WithinDuration(t, entry1.CreatedAt, entry2.CreatedAt, 0)
 }
 
@@ -72,3 +77,61 @@ func TestListEntry(t *testing.T) {
 		require.NotEmpty(t, entry)
 	}
 }
+
+func TestListAccountEntries(t *testing.T) {
+	account := createRandomAccount(t)
+
+	var created []Entry
+	for i := 0; i < 5; i++ {
+		created = append(created, createRandomEntry(t, account))
+	}
+
+	arg := ListAccountEntriesParams{
+		AccountID: account.ID,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Minute),
+		MinAmount: 0,
+		MaxAmount: math.MaxInt64,
+		Limit:     5,
+		Offset:    0,
+	}
+
+	entries, err := testQueries.ListAccountEntries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, created, entries)
+
+	arg.Offset = 4
+	entries, err = testQueries.ListAccountEntries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, created[4:], entries)
+
+	arg.Offset = 0
+	arg.MinAmount = 101
+	entries, err = testQueries.ListAccountEntries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestListAccountEntriesAfter(t *testing.T) {
+	account := createRandomAccount(t)
+
+	var created []Entry
+	for i := 0; i < 3; i++ {
+		created = append(created, createRandomEntry(t, account))
+	}
+
+	arg := ListAccountEntriesAfterParams{
+		AccountID:      account.ID,
+		AfterCreatedAt: created[0].CreatedAt,
+		AfterID:        created[0].ID,
+		StartTime:      time.Now().Add(-time.Minute),
+		EndTime:        time.Now().Add(time.Minute),
+		MinAmount:      0,
+		MaxAmount:      math.MaxInt64,
+		Limit:          5,
+	}
+
+	entries, err := testQueries.ListAccountEntriesAfter(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, created[1:], entries)
+}
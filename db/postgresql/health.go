@@ -0,0 +1,22 @@
+package db
+
+import "context"
+
+// schema_migrations is maintained by golang-migrate, so it is not part of the sqlc schema
+const getSchemaVersion = `-- name: GetSchemaVersion :one
+SELECT version, dirty FROM schema_migrations LIMIT 1
+`
+
+// Ping verifies the database can be reached.
+func (store *SQLStore) Ping(ctx context.Context) error {
+	return store.connPool.Ping(ctx)
+}
+
+// GetSchemaVersion returns the version of the last applied migration,
+// dirty is true if that migration failed half way.
+// It returns ErrRecordNotFound if no migration was ever applied.
+func (store *SQLStore) GetSchemaVersion(ctx context.Context) (version int64, dirty bool, err error) {
+	row := store.Queries.db.QueryRow(ctx, getSchemaVersion)
+	err = row.Scan(&version, &dirty)
+	return
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pawpaw2022/simplebank/db/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	err := store.Ping(context.Background())
+	require.NoError(t, err)
+}
+
+func TestGetSchemaVersion(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	latest, err := migrations.LatestVersion()
+	require.NoError(t, err)
+
+	// The tests run against a fully migrated database
+	version, dirty, err := store.GetSchemaVersion(context.Background())
+	require.NoError(t, err)
+	require.False(t, dirty)
+	require.Equal(t, int64(latest), version)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pawpaw2022/simplebank/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/pawpaw2022/simplebank/db"
+
+// instrumentedDB traces every statement and logs it at debug level with the request logger carried by the context,
+// so the queries of a request share its trace and request ID. Arguments are never recorded.
+type instrumentedDB struct {
+	db DBTX
+}
+
+func (i instrumentedDB) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span, start := startQuery(ctx, query)
+	tag, err := i.db.Exec(ctx, query, args...)
+	endQuery(ctx, span, query, start, err)
+	return tag, err
+}
+
+func (i instrumentedDB) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span, start := startQuery(ctx, query)
+	rows, err := i.db.Query(ctx, query, args...)
+	endQuery(ctx, span, query, start, err)
+	return rows, err
+}
+
+func (i instrumentedDB) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	ctx, span, start := startQuery(ctx, query)
+	row := i.db.QueryRow(ctx, query, args...)
+
+	// The error of a single row query is only known once it is scanned
+	return instrumentedRow{row: row, ctx: ctx, span: span, query: query, start: start}
+}
+
+// instrumentedRow ends the span of a single row query when the row is scanned
+type instrumentedRow struct {
+	row   pgx.Row
+	ctx   context.Context
+	span  trace.Span
+	query string
+	start time.Time
+}
+
+func (r instrumentedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	endQuery(r.ctx, r.span, r.query, r.start, err)
+	return err
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span, time.Time) {
+	name := queryName(query)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(name)),
+	)
+	return ctx, span, time.Now()
+}
+
+func endQuery(ctx context.Context, span trace.Span, query string, start time.Time, err error) {
+	// No rows is an expected outcome, not a failed query
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	logger.FromContext(ctx).Debug().
+		Str("query", queryName(query)).
+		Dur("duration", time.Since(start)).
+		Err(err).
+		Msg("executed query")
+}
+
+// startTx starts the span of a store transaction, the spans of its queries become its children
+func startTx(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(semconv.DBSystemPostgreSQL))
+}
+
+// endTx ends the span of a store transaction
+func endTx(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryName returns the name sqlc puts in the first line of every query, e.g. "-- name: GetAccount :one"
+func queryName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) >= 3 && fields[0] == "--" && fields[1] == "name:" {
+		return fields[2]
+	}
+	return "unnamed"
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomLoginAttempt(t *testing.T, username string, clientIP string, succeeded bool) LoginAttempt {
+	arg := CreateLoginAttemptParams{
+		Username:  username,
+		ClientIp:  clientIP,
+		Succeeded: succeeded,
+	}
+
+	attempt, err := testQueries.CreateLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, attempt.ID)
+	require.Equal(t, arg.Username, attempt.Username)
+	require.Equal(t, arg.ClientIp, attempt.ClientIp)
+	require.Equal(t, arg.Succeeded, attempt.Succeeded)
+	require.False(t, attempt.IsCleared)
+	require.WithinDuration(t, time.Now(), attempt.CreatedAt, time.Second)
+
+	return attempt
+}
+
+func TestGetLoginFailures(t *testing.T) {
+	username := util.RandomOwner()
+	clientIP := util.RandomString(12)
+
+	arg := GetLoginFailuresParams{
+		Username: username,
+		ClientIp: clientIP,
+		Since:    time.Now().Add(-time.Minute),
+	}
+
+	failures, err := testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, failures.UsernameFailures)
+	require.True(t, failures.UsernameLastFailure.IsZero())
+	require.Zero(t, failures.ClientIpFailures)
+	require.True(t, failures.ClientIpLastFailure.IsZero())
+
+	createRandomLoginAttempt(t, username, clientIP, false)
+	createRandomLoginAttempt(t, username, util.RandomString(12), false)
+	createRandomLoginAttempt(t, util.RandomOwner(), clientIP, false)
+	last := createRandomLoginAttempt(t, util.RandomOwner(), clientIP, false)
+	createRandomLoginAttempt(t, username, clientIP, true)
+
+	failures, err = testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), failures.UsernameFailures)
+	require.Equal(t, int32(3), failures.ClientIpFailures)
+	require.WithinDuration(t, last.CreatedAt, failures.ClientIpLastFailure, time.Millisecond)
+
+	// clearing the failures of the username leaves those of the client IP
+	err = testQueries.ClearLoginFailures(context.Background(), username)
+	require.NoError(t, err)
+
+	failures, err = testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, failures.UsernameFailures)
+	require.True(t, failures.UsernameLastFailure.IsZero())
+	require.Equal(t, int32(3), failures.ClientIpFailures)
+
+	// failures before the given time are not counted
+	arg.Since = time.Now().Add(time.Minute)
+	failures, err = testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, failures.ClientIpFailures)
+}
+
+func TestUnlockLoginTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	err := store.UnlockLoginTx(context.Background(), UnlockLoginTxParams{
+		Username: util.RandomOwner(),
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	user := CreateRandomUser(t)
+	admin := util.RandomOwner()
+	createRandomLoginAttempt(t, user.Username, util.RandomString(12), false)
+
+	err = store.UnlockLoginTx(context.Background(), UnlockLoginTxParams{
+		Username: user.Username,
+		Audit:    AuditParams{Actor: admin},
+	})
+	require.NoError(t, err)
+
+	failures, err := testQueries.GetLoginFailures(context.Background(), GetLoginFailuresParams{
+		Username: user.Username,
+		Since:    time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	require.Zero(t, failures.UsernameFailures)
+
+	events := auditEventsOf(t, admin)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditLoginUnlocked, events[0].Action)
+	require.Equal(t, user.Username, events[0].TargetID)
+}
+
+func TestReserveLoginAttemptTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	username := util.RandomOwner()
+	clientIP := util.RandomString(12)
+	since := time.Now().Add(-time.Minute)
+
+	// only the first of the concurrent attempts is admitted, the others see its reservation
+	n := 5
+	errs := make(chan error)
+	results := make(chan ReserveLoginAttemptTxResult)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := store.ReserveLoginAttemptTx(context.Background(), ReserveLoginAttemptTxParams{
+				Username: username,
+				ClientIp: clientIP,
+				Since:    since,
+				Admit: func(failures GetLoginFailuresRow) bool {
+					return failures.UsernameFailures == 0
+				},
+			})
+			errs <- err
+			results <- result
+		}()
+	}
+
+	var reserved LoginAttempt
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+
+		result := <-results
+		if !result.Admitted {
+			require.Zero(t, result.Attempt.ID)
+			continue
+		}
+
+		require.Zero(t, reserved.ID, "more than one attempt admitted")
+		reserved = result.Attempt
+	}
+
+	require.NotZero(t, reserved.ID)
+	require.Equal(t, username, reserved.Username)
+	require.Equal(t, clientIP, reserved.ClientIp)
+	require.False(t, reserved.Succeeded)
+
+	// the reservation counts as a failure, the rejected attempts don't
+	arg := GetLoginFailuresParams{
+		Username: username,
+		ClientIp: clientIP,
+		Since:    since,
+	}
+	failures, err := testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), failures.UsernameFailures)
+	require.Equal(t, int32(1), failures.ClientIpFailures)
+
+	// a released attempt no longer counts
+	err = testQueries.DeleteLoginAttempt(context.Background(), reserved.ID)
+	require.NoError(t, err)
+
+	failures, err = testQueries.GetLoginFailures(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, failures.UsernameFailures)
+	require.Zero(t, failures.ClientIpFailures)
+}
+
+func TestCreateSessionTxSucceedsAttempt(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	user := CreateRandomUser(t)
+	clientIP := util.RandomString(12)
+	since := time.Now().Add(-time.Minute)
+	createRandomLoginAttempt(t, user.Username, clientIP, false)
+
+	result, err := store.ReserveLoginAttemptTx(context.Background(), ReserveLoginAttemptTxParams{
+		Username: user.Username,
+		ClientIp: clientIP,
+		Since:    since,
+		Admit: func(failures GetLoginFailuresRow) bool {
+			require.Equal(t, int32(1), failures.UsernameFailures)
+			return true
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Admitted)
+
+	_, err = store.CreateSessionTx(context.Background(), CreateSessionTxParams{
+		CreateSessionParams: CreateSessionParams{
+			ID:           uuid.New(),
+			Username:     user.Username,
+			RefreshToken: util.RandomString(32),
+			UserAgent:    "go-test",
+			ClientIp:     clientIP,
+			ExpiresAt:    time.Now().Add(time.Hour),
+		},
+		LoginAttemptID: result.Attempt.ID,
+		Audit:          AuditParams{Actor: user.Username},
+	})
+	require.NoError(t, err)
+
+	// the reserved attempt succeeded and the failures of the username are cleared,
+	// those of the client IP still count
+	failures, err := testQueries.GetLoginFailures(context.Background(), GetLoginFailuresParams{
+		Username: user.Username,
+		ClientIp: clientIP,
+		Since:    since,
+	})
+	require.NoError(t, err)
+	require.Zero(t, failures.UsernameFailures)
+	require.Equal(t, int32(1), failures.ClientIpFailures)
+}
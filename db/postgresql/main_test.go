@@ -1,17 +1,17 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"log"
 	"os"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pawpaw2022/simplebank/util"
 )
 
 var testQueries *Queries
-var testDB *sql.DB
+var testDB *pgxpool.Pool
 
 func TestMain(m *testing.M) {
 
@@ -23,7 +23,7 @@ func TestMain(m *testing.M) {
 		log.Fatal("cannot load config: %w", err)
 	}
 
-	testDB, err = sql.Open(config.DBDriver, config.DBSource)
+	testDB, err = pgxpool.New(context.Background(), config.DBSource)
 	if err != nil {
 		log.Fatal("cannot connect to db: %w", err)
 	}
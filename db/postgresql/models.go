@@ -6,6 +6,8 @@ package db
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Account struct {
@@ -17,21 +19,113 @@ type Account struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type AuditEvent struct {
+	ID int64 `json:"id"`
+	// username of the user performing the action
+	Actor      string `json:"actor"`
+	Action     string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	ClientIp   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent"`
+	// state of the target before the action, null if the action created it
+	Before []byte `json:"before"`
+	// state of the target after the action, null if the action failed
+	After     []byte    `json:"after"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Entry struct {
 	ID        int64 `json:"id"`
 	AccountID int64 `json:"account_id"`
 	// can be negative or positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// external reference of a deposit or withdrawal
+	Reference string `json:"reference"`
+	// account balance right after the entry
+	BalanceAfter int64 `json:"balance_after"`
+}
+
+type IdempotencyKey struct {
+	Username       string `json:"username"`
+	IdempotencyKey string `json:"idempotency_key"`
+	RequestHash    string `json:"request_hash"`
+	// result returned to the first request, replayed on retries
+	Response  []byte    `json:"response"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	ID int64 `json:"id"`
+	// as sent by the client, the user may not exist
+	Username  string `json:"username"`
+	ClientIp  string `json:"client_ip"`
+	Succeeded bool   `json:"succeeded"`
+	// cleared failures no longer count toward the lockout of the username, set by a successful login or an admin unlock
+	IsCleared bool      `json:"is_cleared"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// sha256 of the token sent by email, the token itself is never stored
+	TokenHash string    `json:"token_hash"`
+	IsUsed    bool      `json:"is_used"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+type RevokedToken struct {
+	// token payload id
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type Session struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	RefreshToken string    `json:"refresh_token"`
+	UserAgent    string    `json:"user_agent"`
+	ClientIp     string    `json:"client_ip"`
+	IsBlocked    bool      `json:"is_blocked"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Task struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type"`
+	Payload []byte `json:"payload"`
+	Queue   string `json:"queue"`
+	// priority of the queue, tasks of higher priority queues are claimed first
+	Priority int32 `json:"priority"`
+	// pending, running, done or dead
+	Status      string `json:"status"`
+	Attempts    int32  `json:"attempts"`
+	MaxAttempts int32  `json:"max_attempts"`
+	LastError   string `json:"last_error"`
+	// when a pending task is due, or when the lock of a running task expires
+	RunAt     time.Time `json:"run_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Transfer struct {
 	ID            int64 `json:"id"`
 	FromAccountID int64 `json:"from_account_id"`
 	ToAccountID   int64 `json:"to_account_id"`
-	// must be positive
+	// must be positive, in the currency of the from account
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// must be positive, in the currency of the to account
+	ToAmount int64 `json:"to_amount"`
+	// rate applied to convert amount into to_amount
+	ExchangeRate string    `json:"exchange_rate"`
+	RateQuotedAt time.Time `json:"rate_quoted_at"`
 }
 
 type User struct {
@@ -41,4 +135,21 @@ type User struct {
 	Email             string    `json:"email"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
+	// depositor, banker or admin
+	Role            string `json:"role"`
+	IsFrozen        bool   `json:"is_frozen"`
+	IsEmailVerified bool   `json:"is_email_verified"`
+	// tokens issued before are rejected, moved by password changes, logouts from all sessions and freezes
+	TokensRevokedAt time.Time `json:"tokens_revoked_at"`
+}
+
+type VerifyEmail struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// address the code was sent to, the user is only verified if it is still the user email
+	Email      string    `json:"email"`
+	SecretCode string    `json:"secret_code"`
+	IsUsed     bool      `json:"is_used"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiredAt  time.Time `json:"expired_at"`
 }
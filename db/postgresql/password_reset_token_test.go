@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomPasswordResetToken(t *testing.T, username string) (PasswordResetToken, string) {
+	token := util.RandomString(32)
+
+	resetToken, err := testQueries.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		Username:  username,
+		TokenHash: util.HashSecret(token),
+	})
+	require.NoError(t, err)
+	require.Equal(t, username, resetToken.Username)
+	require.False(t, resetToken.IsUsed)
+	require.True(t, resetToken.ExpiredAt.After(resetToken.CreatedAt))
+
+	return resetToken, token
+}
+
+func TestResetPasswordTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	session := createRandomSession(t)
+	_, token := createRandomPasswordResetToken(t, session.Username)
+	other, _ := createRandomPasswordResetToken(t, session.Username)
+
+	// wrong token
+	_, err := store.ResetPasswordTx(context.Background(), ResetPasswordTxParams{
+		TokenHash:      util.HashSecret(util.RandomString(32)),
+		HashedPassword: util.RandomString(32),
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	arg := ResetPasswordTxParams{
+		TokenHash:      util.HashSecret(token),
+		HashedPassword: util.RandomString(32),
+	}
+
+	user, err := store.ResetPasswordTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, session.Username, user.Username)
+	require.Equal(t, arg.HashedPassword, user.HashedPassword)
+	require.WithinDuration(t, time.Now(), user.PasswordChangedAt, time.Second)
+	require.WithinDuration(t, time.Now(), user.TokensRevokedAt, time.Second)
+
+	blocked, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	events := auditEventsOf(t, user.Username)
+	require.Equal(t, AuditPasswordReset, events[len(events)-1].Action)
+
+	cutoffs, err := testQueries.ListTokenRevocationsSince(context.Background(), time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	var revoked bool
+	for _, c := range cutoffs {
+		revoked = revoked || c.Username == user.Username
+	}
+	require.True(t, revoked)
+
+	// the token can only be used once, and the other tokens of the user are invalidated
+	_, err = store.ResetPasswordTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	_, err = testQueries.UsePasswordResetToken(context.Background(), other.TokenHash)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -6,24 +6,98 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
+	BlockSession(ctx context.Context, arg BlockSessionParams) error
+	BlockUserSessions(ctx context.Context, username string) error
+	// locks the next due task until locked_until, workers skip the tasks locked by the others.
+	// A running task whose lock expired was abandoned by its worker and is claimed again,
+	// unless it used up its attempts, see DeadLetterExpiredTasks.
+	ClaimTask(ctx context.Context, lockedUntil time.Time) (Task, error)
+	ClearLoginFailures(ctx context.Context, username string) error
+	// the attempt must match, so a worker whose lock expired cannot overwrite a later attempt
+	CompleteTask(ctx context.Context, arg CompleteTaskParams) error
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error)
+	// the entry is created once the account balance is updated, created_at is taken after the account row is locked
+	// so the entries of an account are in the order of their balance_after
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error)
+	CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) (LoginAttempt, error)
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateTask(ctx context.Context, arg CreateTaskParams) (Task, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error)
+	// a running task whose lock expired on its last attempt was abandoned by its worker and is not claimed again
+	DeadLetterExpiredTasks(ctx context.Context) ([]Task, error)
+	// the task is kept with its last error but never claimed again
+	DeadLetterTask(ctx context.Context, arg DeadLetterTaskParams) error
+	DebitAccountBalance(ctx context.Context, arg DebitAccountBalanceParams) (Account, error)
 	DeleteAccount(ctx context.Context, id int64) error
+	DeleteLoginAttempt(ctx context.Context, id int64) error
 	GetAccount(ctx context.Context, id int64) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error)
+	// failed attempts since the given time counting toward the lockout of the username and of the client IP,
+	// the last failure times are the zero time without failures
+	GetLoginFailures(ctx context.Context, arg GetLoginFailuresParams) (GetLoginFailuresRow, error)
+	GetRevokedToken(ctx context.Context, id uuid.UUID) (RevokedToken, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
+	GetTask(ctx context.Context, id int64) (Task, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserForUpdate(ctx context.Context, username string) (User, error)
+	GetVerifyEmail(ctx context.Context, id int64) (VerifyEmail, error)
+	// marks the other tokens of the user as used once the password is reset
+	InvalidatePasswordResetTokens(ctx context.Context, username string) error
+	ListAccountEntries(ctx context.Context, arg ListAccountEntriesParams) ([]Entry, error)
+	// keyset pagination variant of ListAccountEntries, returns the entries after the (created_at, id) cursor
+	ListAccountEntriesAfter(ctx context.Context, arg ListAccountEntriesAfterParams) ([]Entry, error)
+	// the amount filter applies to the amount in the currency of the given account
+	ListAccountTransfers(ctx context.Context, arg ListAccountTransfersParams) ([]Transfer, error)
+	// keyset pagination variant of ListAccountTransfers, returns the transfers after the (created_at, id) cursor
+	ListAccountTransfersAfter(ctx context.Context, arg ListAccountTransfersAfterParams) ([]Transfer, error)
 	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
+	// keyset pagination: returns the accounts created after the (created_at, id) cursor
+	ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error)
+	ListActiveRevokedTokens(ctx context.Context) ([]RevokedToken, error)
+	// empty filters match every event, returns the events after the (created_at, id) cursor
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	// tokens issued to these users before tokens_revoked_at are no longer valid
+	ListTokenRevocationsSince(ctx context.Context, since time.Time) ([]ListTokenRevocationsSinceRow, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	// serializes the attempts on the username and from the client IP until the transaction ends,
+	// the username is always locked first so concurrent attempts cannot deadlock
+	LockLoginAttempts(ctx context.Context, arg LockLoginAttemptsParams) error
+	RetryTask(ctx context.Context, arg RetryTaskParams) error
+	RevokeToken(ctx context.Context, arg RevokeTokenParams) error
+	// revokes every token issued to the user before tokens_revoked_at, which is taken from the clock that issues the tokens.
+	// The cutoff never moves back.
+	RevokeUserTokens(ctx context.Context, arg RevokeUserTokensParams) (time.Time, error)
+	SucceedLoginAttempt(ctx context.Context, id int64) error
 	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
 	UpdateAccountBalance(ctx context.Context, arg UpdateAccountBalanceParams) (Account, error)
+	UpdateIdempotencyKeyResponse(ctx context.Context, arg UpdateIdempotencyKeyResponseParams) error
+	// null fields are left unchanged, a new password moves password_changed_at
+	// and a new email has to be verified again
+	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserFrozen(ctx context.Context, arg UpdateUserFrozenParams) (User, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error)
+	// marks the token as used, only succeeds once and before it expires
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	// marks the code as used, only succeeds once and before it expires
+	UseVerifyEmail(ctx context.Context, arg UseVerifyEmailParams) (VerifyEmail, error)
+	// only verifies the address the code was sent to, a code sent before an email change doesn't verify the new one
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"time"
+)
+
+// Retry defaults, used for the RetryConfig fields left at zero
+const (
+	defaultTxMaxRetries    = 3
+	defaultTxRetryDelay    = 20 * time.Millisecond
+	defaultTxRetryMaxDelay = 500 * time.Millisecond
+)
+
+// RetryConfig bounds how often a transaction is run again after a deadlock
+type RetryConfig struct {
+	MaxRetries int           // retries after the first attempt, a negative value disables retries
+	Delay      time.Duration // base delay, doubled on every retry
+	MaxDelay   time.Duration // upper bound of the delay
+}
+
+// withDefaults fills the fields left at zero with the defaults
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = defaultTxMaxRetries
+	}
+	if c.Delay <= 0 {
+		c.Delay = defaultTxRetryDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = defaultTxRetryMaxDelay
+	}
+	return c
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+// Half of the delay is random, so transactions that failed against each other do not retry in lockstep.
+// jitter returns a random number in [0, n), such as rand.Int63n.
+func (c RetryConfig) backoff(retry int, jitter func(n int64) int64) time.Duration {
+	delay := c.Delay
+	for i := 1; i < retry && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(jitter(int64(half)+1))
+}
+
+// isRetryable reports whether the transaction failed only because of concurrent transactions,
+// in which case running it again can succeed
+func isRetryable(err error) bool {
+	switch ErrorCode(err) {
+	case DeadlockDetected:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "DeadlockDetected",
+			err:  &pgconn.PgError{Code: DeadlockDetected},
+			want: true,
+		},
+		{
+			name: "Wrapped",
+			err:  fmt.Errorf("tx err: %w, rb err: %v", &pgconn.PgError{Code: DeadlockDetected}, errors.New("conn closed")),
+			want: true,
+		},
+		{
+			name: "UniqueViolation",
+			err:  &pgconn.PgError{Code: UniqueViolation},
+			want: false,
+		},
+		{
+			name: "InsufficientFunds",
+			err:  ErrInsufficientFunds,
+			want: false,
+		},
+		{
+			name: "NotFound",
+			err:  ErrRecordNotFound,
+			want: false,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, isRetryable(tc.err))
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	config := RetryConfig{
+		Delay:    10 * time.Millisecond,
+		MaxDelay: 50 * time.Millisecond,
+	}
+	rnd := rand.New(rand.NewSource(1))
+
+	testCases := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 10 * time.Millisecond},
+		{retry: 2, max: 20 * time.Millisecond},
+		{retry: 3, max: 40 * time.Millisecond},
+		{retry: 4, max: 50 * time.Millisecond},
+		{retry: 10, max: 50 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		for i := 0; i < 100; i++ {
+			delay := config.backoff(tc.retry, rnd.Int63n)
+			require.GreaterOrEqual(t, delay, tc.max/2)
+			require.LessOrEqual(t, delay, tc.max)
+		}
+	}
+}
+
+func TestRetryConfigDefaults(t *testing.T) {
+	config := RetryConfig{}.withDefaults()
+	require.Equal(t, defaultTxMaxRetries, config.MaxRetries)
+	require.Equal(t, defaultTxRetryDelay, config.Delay)
+	require.Equal(t, defaultTxRetryMaxDelay, config.MaxDelay)
+
+	// Retries can be turned off
+	config = RetryConfig{MaxRetries: -1}.withDefaults()
+	require.Equal(t, -1, config.MaxRetries)
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeToken(t *testing.T) {
+	user := CreateRandomUser(t)
+
+	arg := RevokeTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	err := testQueries.RevokeToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	// revoking twice is a no-op
+	err = testQueries.RevokeToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	revoked, err := testQueries.GetRevokedToken(context.Background(), arg.ID)
+	require.NoError(t, err)
+	require.Equal(t, arg.ID, revoked.ID)
+	require.Equal(t, arg.Username, revoked.Username)
+	require.WithinDuration(t, arg.ExpiresAt, revoked.ExpiresAt, time.Second)
+	require.NotZero(t, revoked.RevokedAt)
+
+	tokens, err := testQueries.ListActiveRevokedTokens(context.Background())
+	require.NoError(t, err)
+
+	found := false
+	for _, token := range tokens {
+		require.True(t, token.ExpiresAt.After(time.Now()))
+		if token.ID == arg.ID {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestBlockUserSessions(t *testing.T) {
+	session1 := createRandomSession(t)
+
+	err := testQueries.BlockUserSessions(context.Background(), session1.Username)
+	require.NoError(t, err)
+
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.True(t, session2.IsBlocked)
+}
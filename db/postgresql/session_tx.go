@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogoutTxParams contains the input parameters of the logout transaction
+type LogoutTxParams struct {
+	Token     RevokeTokenParams // access token used for the logout
+	SessionID uuid.UUID         // optional, session of the refresh token sent with the logout
+	Audit     AuditParams
+}
+
+// LogoutTx revokes the access token, blocks the session if one is given,
+// and records the logout in the audit log within a single database transaction.
+func (store *SQLStore) LogoutTx(ctx context.Context, arg LogoutTxParams) error {
+	ctx, span := startTx(ctx, "LogoutTx")
+
+	err := store.execTx(ctx, "LogoutTx", func(q *Queries) error {
+
+		state := logoutState{
+			TokenID: arg.Token.ID.String(),
+		}
+
+		if arg.SessionID != uuid.Nil {
+			err := q.BlockSession(ctx, BlockSessionParams{
+				ID:       arg.SessionID,
+				Username: arg.Token.Username,
+			})
+			if err != nil {
+				return err
+			}
+
+			state.SessionID = arg.SessionID.String()
+		}
+
+		if err := q.RevokeToken(ctx, arg.Token); err != nil {
+			return err
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditLogout,
+			TargetType: AuditTargetUser,
+			TargetID:   arg.Token.Username,
+			After:      state,
+		})
+	})
+
+	endTx(span, err)
+	return err
+}
+
+// LogoutAllTxParams contains the input parameters of the logout all transaction
+type LogoutAllTxParams struct {
+	Username string
+	Audit    AuditParams
+}
+
+// LogoutAllTx blocks every session of the user, revokes every token issued to it until now,
+// and records the logout in the audit log within a single database transaction.
+// It returns the new tokens_revoked_at of the user.
+func (store *SQLStore) LogoutAllTx(ctx context.Context, arg LogoutAllTxParams) (time.Time, error) {
+	ctx, span := startTx(ctx, "LogoutAllTx")
+
+	var user User
+
+	err := store.execTx(ctx, "LogoutAllTx", func(q *Queries) error {
+
+		user = User{Username: arg.Username}
+
+		if err := signOutEverywhere(ctx, q, &user); err != nil {
+			return err
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditLogoutAll,
+			TargetType: AuditTargetUser,
+			TargetID:   arg.Username,
+			After:      revocationState{TokensRevokedAt: user.TokensRevokedAt},
+		})
+	})
+
+	endTx(span, err)
+	return user.TokensRevokedAt, err
+}
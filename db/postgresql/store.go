@@ -2,55 +2,136 @@ package db
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/pawpaw2022/simplebank/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Querier is the interface that groups all query and transaction related methods.
 type Store interface {
 	Querier
+	CreateUserTx(ctx context.Context, arg CreateUserTxParams) (CreateUserTxResult, error)
+	VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (User, error)
+	UpdateUserTx(ctx context.Context, arg UpdateUserTxParams) (User, error)
+	ReserveLoginAttemptTx(ctx context.Context, arg ReserveLoginAttemptTxParams) (ReserveLoginAttemptTxResult, error)
+	CreateSessionTx(ctx context.Context, arg CreateSessionTxParams) (Session, error)
+	UnlockLoginTx(ctx context.Context, arg UnlockLoginTxParams) error
+	SetUserFrozenTx(ctx context.Context, arg SetUserFrozenTxParams) (User, error)
+	LogoutTx(ctx context.Context, arg LogoutTxParams) error
+	LogoutAllTx(ctx context.Context, arg LogoutAllTxParams) (time.Time, error)
+	CreateAccountTx(ctx context.Context, arg CreateAccountTxParams) (Account, error)
 	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	ExchangeTransferTx(ctx context.Context, arg ExchangeTransferTxParams) (TransferTxResult, error)
+	DepositTx(ctx context.Context, arg CashTxParams) (CashTxResult, error)
+	WithdrawTx(ctx context.Context, arg CashTxParams) (CashTxResult, error)
+	Ping(ctx context.Context) error
+	GetSchemaVersion(ctx context.Context) (version int64, dirty bool, err error)
 }
 
 // Store provides all functions to execute db queries and transactions
 type SQLStore struct {
-	db *sql.DB
+	connPool *pgxpool.Pool
+	retry    RetryConfig
 	*Queries
 }
 
-// NewStore creates a new Store
-func NewStore(db *sql.DB) Store {
+// NewStore creates a new Store.
+// The fields of retry left at zero are set to the defaults.
+func NewStore(connPool *pgxpool.Pool, retry RetryConfig) Store {
 	return &SQLStore{
-		Queries: New(db),
-		db:      db,
+		Queries:  New(instrumentedDB{connPool}),
+		connPool: connPool,
+		retry:    retry.withDefaults(),
+	}
+}
+
+// execTx executes a function within a read committed database transaction.
+// The transactions guard their invariants with conditional updates and row locks taken in a consistent order,
+// which read committed is enough for.
+// The transaction is run again after a deadlock, so fn must not keep state between calls.
+// name identifies the transaction in the retry metrics and logs.
+func (s *SQLStore) execTx(ctx context.Context, name string, fn func(*Queries) error) error {
+	for retry := 1; ; retry++ {
+		err := s.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) || retry > s.retry.MaxRetries {
+			return err
+		}
+
+		delay := s.retry.backoff(retry, rand.Int63n)
+
+		metrics.TxRetriesTotal.WithLabelValues(name).Inc()
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("retry", retry)))
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Str("tx", name).
+			Int("retry", retry).
+			Dur("delay", delay).
+			Msg("retrying transaction")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
 	}
 }
 
-// execTx executes a function within a database transaction
-func (s *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+// runTx runs fn once within a database transaction
+func (s *SQLStore) runTx(ctx context.Context, fn func(*Queries) error) error {
+	tx, err := s.connPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
 	if err != nil {
 		return err
 	}
 
-	q := New(tx)
+	q := New(instrumentedDB{tx})
 	err = fn(q)
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		logger.FromContext(ctx).Debug().Err(err).Msg("rolling back transaction")
+
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rb err: %v", err, rbErr)
 		}
 
 		return err
 	}
 
-	return tx.Commit()
+	return tx.Commit(ctx)
+}
+
+// IdempotencyParams identifies a client request that must be applied at most once
+type IdempotencyParams struct {
+	Username    string
+	Key         string
+	RequestHash string // hash of the request body, a key reused with a different body is rejected
 }
 
 // TransferTxParams contains the input parameters of the transfer transaction
 type TransferTxParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Amount        int64 `json:"amount"`
+	FromAccountID int64              `json:"from_account_id"`
+	ToAccountID   int64              `json:"to_account_id"`
+	Amount        int64              `json:"amount"`
+	Idempotency   *IdempotencyParams `json:"-"` // optional
+	Audit         *AuditParams       `json:"-"` // optional, the transfer is recorded in the audit log if set
+}
+
+// ExchangeTransferTxParams contains the input parameters of a transfer between accounts of different currencies.
+// Amount is debited in the from account currency and ToAmount is credited in the to account currency.
+type ExchangeTransferTxParams struct {
+	TransferTxParams
+	ToAmount     int64     `json:"to_amount"`
+	ExchangeRate string    `json:"exchange_rate"` // decimal rate used to convert Amount into ToAmount
+	RateQuotedAt time.Time `json:"rate_quoted_at"`
 }
 
 // TransferTxResult is the output result of the transfer transaction
@@ -60,68 +141,185 @@ type TransferTxResult struct {
 	ToAccount   Account  `json:"to_account"`
 	FromEntry   Entry    `json:"from_entry"`
 	ToEntry     Entry    `json:"to_entry"`
+	Replayed    bool     `json:"-"` // true if the result was stored by an earlier request with the same idempotency key
 }
 
 // TransferTx performs a money transfer from one account to the other.
 // It creates the transfer record, add account entries, and update accounts' balance within a single database transaction.
+// It returns ErrInsufficientFunds if the from account balance is lower than the amount.
+//
+// If an idempotency key is given, it is stored with the result in the same transaction.
+// A retry with the same key gets the stored result back instead of moving the money again,
+// and ErrIdempotencyKeyReused is returned if the key was used for a different request.
+// Replays are not recorded in the audit log again.
 func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+	return store.ExchangeTransferTx(ctx, ExchangeTransferTxParams{
+		TransferTxParams: arg,
+		ToAmount:         arg.Amount,
+		ExchangeRate:     "1",
+		RateQuotedAt:     time.Now(),
+	})
+}
+
+// ExchangeTransferTx performs a money transfer between accounts of different currencies.
+// It works like TransferTx, except that the to account is credited with ToAmount,
+// and the applied rate and quote time are stored on the transfer record.
+func (store *SQLStore) ExchangeTransferTx(ctx context.Context, arg ExchangeTransferTxParams) (TransferTxResult, error) {
+	ctx, span := startTx(ctx, "ExchangeTransferTx")
+	timer := prometheus.NewTimer(metrics.TransferTxDuration)
+	defer timer.ObserveDuration()
 
 	var result TransferTxResult
 
-	err := store.execTx(ctx, func(q *Queries) error {
+	// The debit is a conditional update and the balances are updated in a consistent order,
+	// which prevents overdrafts and lost updates
+	err := store.execTx(ctx, "ExchangeTransferTx", func(q *Queries) error {
+
+		// start over if the transaction is retried
+		result = TransferTxResult{}
 
 		var err error
 
+		if arg.Idempotency != nil {
+			var replayed bool
+			replayed, err = claimIdempotencyKey(ctx, q, *arg.Idempotency, &result)
+			if err != nil || replayed {
+				return err
+			}
+		}
+
 		// create the transfer record
 		result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
 			FromAccountID: arg.FromAccountID,
 			ToAccountID:   arg.ToAccountID,
 			Amount:        arg.Amount,
+			ToAmount:      arg.ToAmount,
+			ExchangeRate:  arg.ExchangeRate,
+			RateQuotedAt:  arg.RateQuotedAt,
 		})
 		if err != nil {
 			return err
 		}
 
-		// create the entry records for the accounts
+		// update the balances in a consistent order to avoid deadlocks
+		if arg.FromAccountID < arg.ToAccountID {
+
+			result.FromAccount, result.ToAccount, err = transferMoney(ctx, q, arg.FromAccountID, arg.ToAccountID, -arg.Amount, arg.ToAmount)
+
+			if err != nil {
+				return err
+			}
+		} else {
+
+			result.ToAccount, result.FromAccount, err = transferMoney(ctx, q, arg.ToAccountID, arg.FromAccountID, arg.ToAmount, -arg.Amount)
+
+			if err != nil {
+				return err
+			}
+
+		}
+
+		// create the entry records for the accounts, once both rows are locked
 		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.FromAccountID,
-			Amount:    -arg.Amount,
+			AccountID:    arg.FromAccountID,
+			Amount:       -arg.Amount,
+			BalanceAfter: result.FromAccount.Balance,
 		})
 		if err != nil {
 			return err
 		}
 
 		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.ToAccountID,
-			Amount:    arg.Amount,
+			AccountID:    arg.ToAccountID,
+			Amount:       arg.ToAmount,
+			BalanceAfter: result.ToAccount.Balance,
 		})
 		if err != nil {
 			return err
 		}
 
-		if arg.FromAccountID < arg.ToAccountID {
-
-			result.FromAccount, result.ToAccount, err = transferMoney(ctx, q, arg.FromAccountID, arg.ToAccountID, arg.Amount, -arg.Amount)
-
-			if err != nil {
-				return err
-			}
-		} else {
-
-			result.ToAccount, result.FromAccount, err = transferMoney(ctx, q, arg.ToAccountID, arg.FromAccountID, -arg.Amount, arg.Amount)
-
+		if arg.Audit != nil {
+			err = recordAuditEvent(ctx, q, *arg.Audit, auditEvent{
+				Action:     AuditTransferCreated,
+				TargetType: AuditTargetTransfer,
+				TargetID:   auditID(result.Transfer.ID),
+				Before: transferState{
+					FromAccountBalance: result.FromAccount.Balance + arg.Amount,
+					ToAccountBalance:   result.ToAccount.Balance - arg.ToAmount,
+				},
+				After: transferState{
+					Transfer:           &result.Transfer,
+					FromAccountBalance: result.FromAccount.Balance,
+					ToAccountBalance:   result.ToAccount.Balance,
+				},
+			})
 			if err != nil {
 				return err
 			}
+		}
 
+		if arg.Idempotency != nil {
+			return saveIdempotentResponse(ctx, q, *arg.Idempotency, result)
 		}
 
 		return nil
 	})
 
+	endTx(span, err)
 	return result, err
 }
 
+// claimIdempotencyKey stores the key for this request.
+// If the key already exists, the stored response is decoded into result and replayed is true.
+// A concurrent request with the same key waits here until the first one commits or rolls back.
+func claimIdempotencyKey(ctx context.Context, q *Queries, arg IdempotencyParams, result *TransferTxResult) (replayed bool, err error) {
+	_, err = q.CreateIdempotencyKey(ctx, CreateIdempotencyKeyParams{
+		Username:       arg.Username,
+		IdempotencyKey: arg.Key,
+		RequestHash:    arg.RequestHash,
+	})
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		return false, err
+	}
+
+	// the key exists already
+	stored, err := q.GetIdempotencyKey(ctx, GetIdempotencyKeyParams{
+		Username:       arg.Username,
+		IdempotencyKey: arg.Key,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if stored.RequestHash != arg.RequestHash {
+		return false, ErrIdempotencyKeyReused
+	}
+
+	if err := json.Unmarshal(stored.Response, result); err != nil {
+		return false, fmt.Errorf("cannot decode stored response: %w", err)
+	}
+	result.Replayed = true
+
+	return true, nil
+}
+
+// saveIdempotentResponse stores the result so retries with the same key can replay it.
+func saveIdempotentResponse(ctx context.Context, q *Queries, arg IdempotencyParams, result TransferTxResult) error {
+	response, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return q.UpdateIdempotencyKeyResponse(ctx, UpdateIdempotencyKeyResponseParams{
+		Username:       arg.Username,
+		IdempotencyKey: arg.Key,
+		Response:       response,
+	})
+}
+
 func transferMoney(
 	ctx context.Context,
 	q *Queries,
@@ -130,23 +328,44 @@ func transferMoney(
 	amount1 int64,
 	amount2 int64,
 ) (account1 Account, account2 Account, err error) {
-	// subtract amount from account 1
-	account1, err = q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
-		ID:     accountID1,
-		Amount: amount1,
-	})
+	// apply amount 1 to account 1
+	account1, err = addMoney(ctx, q, accountID1, amount1)
 	if err != nil {
 		return
 	}
 
-	// add amount to account 2
-	account2, err = q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
-		ID:     accountID2,
-		Amount: amount2,
-	})
+	// apply amount 2 to account 2
+	account2, err = addMoney(ctx, q, accountID2, amount2)
 	if err != nil {
 		return
 	}
 
 	return
 }
+
+// addMoney adds a positive or negative amount to the account balance.
+// A debit only succeeds if the balance covers it, otherwise ErrInsufficientFunds is returned.
+// ErrRecordNotFound is returned if the account doesn't exist.
+func addMoney(ctx context.Context, q *Queries, accountID int64, amount int64) (Account, error) {
+	if amount >= 0 {
+		return q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
+			ID:     accountID,
+			Amount: amount,
+		})
+	}
+
+	// the conditional update locks the row and checks the balance in a single statement
+	account, err := q.DebitAccountBalance(ctx, DebitAccountBalanceParams{
+		ID:     accountID,
+		Amount: -amount,
+	})
+	if errors.Is(err, ErrRecordNotFound) {
+		// no row is updated either when the balance is too low or when the account is missing
+		if _, err := q.GetAccount(ctx, accountID); err != nil {
+			return account, err
+		}
+		return account, ErrInsufficientFunds
+	}
+
+	return account, err
+}
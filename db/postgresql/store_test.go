@@ -2,20 +2,23 @@ package db
 
 import (
 	"context"
+	"math"
 	"testing"
+	"time"
 
+	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransferTx(t *testing.T) {
-	store := NewStore(testDB)
-
-	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	store := NewStore(testDB, RetryConfig{})
 
 	n := 5
 	amount := int64(10)
 
+	account1 := createRandomAccountWithBalance(t, int64(n)*amount)
+	account2 := createRandomAccount(t)
+
 	errs := make(chan error)
 	results := make(chan TransferTxResult)
 
@@ -46,6 +49,8 @@ func TestTransferTx(t *testing.T) {
 		require.Equal(t, account1.ID, transfer.FromAccountID)
 		require.Equal(t, account2.ID, transfer.ToAccountID)
 		require.Equal(t, amount, transfer.Amount)
+		require.Equal(t, amount, transfer.ToAmount)
+		require.Equal(t, "1", transfer.ExchangeRate)
 
 		_, err = store.GetTransfer(context.Background(), transfer.ID)
 		require.NoError(t, err)
@@ -78,8 +83,12 @@ func TestTransferTx(t *testing.T) {
 		require.NotEmpty(t, toAccount)
 		require.Equal(t, account2.ID, toAccount.ID)
 
-		diff1 := fromAccount.Balance - account1.Balance
-		diff2 := account2.Balance - toAccount.Balance
+		// the entries keep the balances they left
+		require.Equal(t, fromAccount.Balance, fromEntry.BalanceAfter)
+		require.Equal(t, toAccount.Balance, toEntry.BalanceAfter)
+
+		diff1 := account1.Balance - fromAccount.Balance
+		diff2 := toAccount.Balance - account2.Balance
 		require.Equal(t, diff1, diff2)
 		require.True(t, diff1 >= 0)
 		require.True(t, diff1%amount == 0)
@@ -97,20 +106,35 @@ func TestTransferTx(t *testing.T) {
 	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
 	require.NoError(t, err)
 
-	require.Equal(t, account1.Balance+int64(n)*amount, updatedAccount1.Balance)
-	require.Equal(t, account2.Balance-int64(n)*amount, updatedAccount2.Balance)
+	require.Equal(t, account1.Balance-int64(n)*amount, updatedAccount1.Balance)
+	require.Equal(t, account2.Balance+int64(n)*amount, updatedAccount2.Balance)
+
+	// in statement order, each entry moves the balance left by the one before
+	entries, err := testQueries.ListAccountEntries(context.Background(), ListAccountEntriesParams{
+		AccountID: account1.ID,
+		EndTime:   time.Now().Add(time.Minute),
+		MaxAmount: math.MaxInt64,
+		Limit:     int32(n),
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, n)
 
+	balance := account1.Balance
+	for _, entry := range entries {
+		balance += entry.Amount
+		require.Equal(t, balance, entry.BalanceAfter)
+	}
 }
 
 func TestTransferTXDeadlock(t *testing.T) {
-	store := NewStore(testDB)
-
-	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	store := NewStore(testDB, RetryConfig{})
 
 	n := 10
 	amount := int64(10)
 
+	account1 := createRandomAccountWithBalance(t, int64(n)*amount)
+	account2 := createRandomAccountWithBalance(t, int64(n)*amount)
+
 	errs := make(chan error)
 
 	for i := 0; i < n; i++ {
@@ -152,3 +176,134 @@ func TestTransferTXDeadlock(t *testing.T) {
 	require.Equal(t, account2.Balance, updatedAccount2.Balance)
 
 }
+
+func TestTransferTxInsufficientFunds(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        account1.Balance + 1,
+	})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	// the whole transaction is rolled back
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+	require.Equal(t, account2.Balance, updatedAccount2.Balance)
+}
+
+// createRandomAccountWithBalance creates a random account holding at least the given balance
+func createRandomAccountWithBalance(t *testing.T, minBalance int64) Account {
+	account := createRandomAccount(t)
+
+	account, err := testQueries.UpdateAccount(context.Background(), UpdateAccountParams{
+		ID:      account.ID,
+		Balance: account.Balance + minBalance,
+	})
+	require.NoError(t, err)
+
+	return account
+}
+
+func TestAddMoney(t *testing.T) {
+	account := createRandomAccount(t)
+
+	_, err := addMoney(context.Background(), testQueries, account.ID, -(account.Balance + 1))
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	// a missing account is not mistaken for insufficient funds
+	_, err = addMoney(context.Background(), testQueries, -1, -1)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	require.NotErrorIs(t, err, ErrInsufficientFunds)
+
+	updated, err := addMoney(context.Background(), testQueries, account.ID, -account.Balance)
+	require.NoError(t, err)
+	require.Zero(t, updated.Balance)
+}
+
+func TestTransferTxIdempotency(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	amount := int64(10)
+	account1 := createRandomAccountWithBalance(t, 2*amount)
+	account2 := createRandomAccount(t)
+
+	idempotency := &IdempotencyParams{
+		Username:    account1.Owner,
+		Key:         util.RandomString(16),
+		RequestHash: util.RandomString(64),
+	}
+
+	arg := TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        amount,
+		Idempotency:   idempotency,
+	}
+
+	result1, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, result1.Replayed)
+
+	// a retry returns the stored result without moving money again
+	result2, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, result2.Replayed)
+	require.Equal(t, result1.Transfer.ID, result2.Transfer.ID)
+	require.Equal(t, result1.FromAccount.Balance, result2.FromAccount.Balance)
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance-amount, updatedAccount1.Balance)
+
+	// the same key with a different request is rejected
+	arg.Idempotency = &IdempotencyParams{
+		Username:    idempotency.Username,
+		Key:         idempotency.Key,
+		RequestHash: util.RandomString(64),
+	}
+	_, err = store.TransferTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
+
+func TestExchangeTransferTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	account1 := createRandomAccountWithBalance(t, 100)
+	account2 := createRandomAccount(t)
+
+	arg := ExchangeTransferTxParams{
+		TransferTxParams: TransferTxParams{
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        100,
+		},
+		ToAmount:     92,
+		ExchangeRate: "0.92",
+		RateQuotedAt: time.Now().Add(-time.Minute),
+	}
+
+	result, err := store.ExchangeTransferTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	// the transfer keeps both amounts and the applied rate
+	require.Equal(t, arg.Amount, result.Transfer.Amount)
+	require.Equal(t, arg.ToAmount, result.Transfer.ToAmount)
+	require.Equal(t, arg.ExchangeRate, result.Transfer.ExchangeRate)
+	require.WithinDuration(t, arg.RateQuotedAt, result.Transfer.RateQuotedAt, time.Second)
+
+	// the from account is debited in its currency, the to account credited with the converted amount
+	require.Equal(t, -arg.Amount, result.FromEntry.Amount)
+	require.Equal(t, arg.ToAmount, result.ToEntry.Amount)
+	require.Equal(t, account1.Balance-arg.Amount, result.FromAccount.Balance)
+	require.Equal(t, account2.Balance+arg.ToAmount, result.ToAccount.Balance)
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testTaskPriority is above the priority of every worker queue, so the test tasks are claimed first
+const testTaskPriority = math.MaxInt32 - 10
+
+func createRandomTask(t *testing.T, priority int32, runAt time.Time) Task {
+	arg := CreateTaskParams{
+		Type:        "task:test",
+		Payload:     []byte(`{"id":1}`),
+		Queue:       "test",
+		Priority:    priority,
+		MaxAttempts: 3,
+		RunAt:       runAt,
+	}
+
+	task, err := testQueries.CreateTask(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.NotZero(t, task.ID)
+	require.Equal(t, arg.Type, task.Type)
+	require.JSONEq(t, string(arg.Payload), string(task.Payload))
+	require.Equal(t, arg.Priority, task.Priority)
+	require.Equal(t, "pending", task.Status)
+	require.Zero(t, task.Attempts)
+	require.Empty(t, task.LastError)
+
+	return task
+}
+
+func claimTestTask(t *testing.T, lockedUntil time.Time) Task {
+	task, err := testQueries.ClaimTask(context.Background(), lockedUntil)
+	require.NoError(t, err)
+	return task
+}
+
+func TestClaimTask(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	low := createRandomTask(t, testTaskPriority, now.Add(-time.Minute))
+	high := createRandomTask(t, testTaskPriority+1, now)
+	notDue := createRandomTask(t, testTaskPriority+2, now.Add(time.Hour))
+
+	// the due task of the highest priority comes first, whatever its age
+	lockedUntil := now.Add(time.Minute)
+	claimed := claimTestTask(t, lockedUntil)
+	require.Equal(t, high.ID, claimed.ID)
+	require.Equal(t, "running", claimed.Status)
+	require.Equal(t, int32(1), claimed.Attempts)
+	require.WithinDuration(t, lockedUntil, claimed.RunAt, time.Second)
+
+	// a locked task is not claimed twice
+	claimed = claimTestTask(t, lockedUntil)
+	require.Equal(t, low.ID, claimed.ID)
+
+	err := testQueries.CompleteTask(ctx, CompleteTaskParams{ID: high.ID, Attempts: 1})
+	require.NoError(t, err)
+	err = testQueries.CompleteTask(ctx, CompleteTaskParams{ID: low.ID, Attempts: 1})
+	require.NoError(t, err)
+
+	task, err := testQueries.GetTask(ctx, high.ID)
+	require.NoError(t, err)
+	require.Equal(t, "done", task.Status)
+
+	task, err = testQueries.GetTask(ctx, notDue.ID)
+	require.NoError(t, err)
+	require.Equal(t, "pending", task.Status)
+}
+
+func TestClaimAbandonedTask(t *testing.T) {
+	ctx := context.Background()
+	created := createRandomTask(t, testTaskPriority+3, time.Now())
+
+	// the worker stopped without recording the outcome, the lock is already expired
+	claimed := claimTestTask(t, time.Now().Add(-time.Second))
+	require.Equal(t, created.ID, claimed.ID)
+
+	claimed = claimTestTask(t, time.Now().Add(time.Minute))
+	require.Equal(t, created.ID, claimed.ID)
+	require.Equal(t, int32(2), claimed.Attempts)
+
+	// the outcome of the first attempt is ignored
+	err := testQueries.CompleteTask(ctx, CompleteTaskParams{ID: created.ID, Attempts: 1})
+	require.NoError(t, err)
+
+	task, err := testQueries.GetTask(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "running", task.Status)
+
+	err = testQueries.CompleteTask(ctx, CompleteTaskParams{ID: created.ID, Attempts: 2})
+	require.NoError(t, err)
+}
+
+func TestRetryAndDeadLetterTask(t *testing.T) {
+	ctx := context.Background()
+	created := createRandomTask(t, testTaskPriority+4, time.Now())
+
+	claimed := claimTestTask(t, time.Now().Add(time.Minute))
+	require.Equal(t, created.ID, claimed.ID)
+
+	runAt := time.Now().Add(time.Hour)
+	err := testQueries.RetryTask(ctx, RetryTaskParams{
+		ID:        claimed.ID,
+		Attempts:  claimed.Attempts,
+		RunAt:     runAt,
+		LastError: "first failure",
+	})
+	require.NoError(t, err)
+
+	task, err := testQueries.GetTask(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "pending", task.Status)
+	require.Equal(t, "first failure", task.LastError)
+	require.WithinDuration(t, runAt, task.RunAt, time.Second)
+
+	// a dead task is never claimed again
+	_, err = testDB.Exec(ctx, "UPDATE tasks SET run_at = now() WHERE id = $1", created.ID)
+	require.NoError(t, err)
+	claimed = claimTestTask(t, time.Now().Add(time.Minute))
+	require.Equal(t, created.ID, claimed.ID)
+
+	err = testQueries.DeadLetterTask(ctx, DeadLetterTaskParams{
+		ID:        claimed.ID,
+		Attempts:  claimed.Attempts,
+		LastError: "second failure",
+	})
+	require.NoError(t, err)
+
+	task, err = testQueries.GetTask(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "dead", task.Status)
+	require.Equal(t, "second failure", task.LastError)
+	require.Equal(t, int32(2), task.Attempts)
+}
+
+func TestDeadLetterExpiredTasks(t *testing.T) {
+	ctx := context.Background()
+	created := createRandomTask(t, testTaskPriority+5, time.Now())
+
+	// the worker stopped without recording the outcome of the last attempt
+	_, err := testDB.Exec(ctx, "UPDATE tasks SET status = 'running', attempts = max_attempts, run_at = now() - interval '1 second' WHERE id = $1", created.ID)
+	require.NoError(t, err)
+
+	// it is not claimed again
+	claimed, err := testQueries.ClaimTask(ctx, time.Now().Add(time.Minute))
+	if err == nil {
+		require.NotEqual(t, created.ID, claimed.ID)
+	} else {
+		require.ErrorIs(t, err, ErrRecordNotFound)
+	}
+
+	tasks, err := testQueries.DeadLetterExpiredTasks(ctx)
+	require.NoError(t, err)
+
+	var reaped bool
+	for _, task := range tasks {
+		if task.ID == created.ID {
+			reaped = true
+		}
+	}
+	require.True(t, reaped)
+
+	task, err := testQueries.GetTask(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "dead", task.Status)
+	require.Equal(t, created.MaxAttempts, task.Attempts)
+	require.NotEmpty(t, task.LastError)
+}
@@ -7,24 +7,35 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 const createTransfer = `-- name: CreateTransfer :one
 INSERT INTO transfers (
-  amount, from_account_id, to_account_id
+  amount, from_account_id, to_account_id, to_amount, exchange_rate, rate_quoted_at
 ) VALUES (
-  $1, $2, $3
-)RETURNING id, from_account_id, to_account_id, amount, created_at
+  $1, $2, $3, $4, $5, $6
+)RETURNING id, from_account_id, to_account_id, amount, created_at, to_amount, exchange_rate, rate_quoted_at
 `
 
 type CreateTransferParams struct {
-	Amount        int64 `json:"amount"`
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
+	Amount        int64     `json:"amount"`
+	FromAccountID int64     `json:"from_account_id"`
+	ToAccountID   int64     `json:"to_account_id"`
+	ToAmount      int64     `json:"to_amount"`
+	ExchangeRate  string    `json:"exchange_rate"`
+	RateQuotedAt  time.Time `json:"rate_quoted_at"`
 }
 
 func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, createTransfer, arg.Amount, arg.FromAccountID, arg.ToAccountID)
+	row := q.db.QueryRow(ctx, createTransfer,
+		arg.Amount,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.ToAmount,
+		arg.ExchangeRate,
+		arg.RateQuotedAt,
+	)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -32,17 +43,20 @@ func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams)
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.ToAmount,
+		&i.ExchangeRate,
+		&i.RateQuotedAt,
 	)
 	return i, err
 }
 
 const getTransfer = `-- name: GetTransfer :one
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, to_amount, exchange_rate, rate_quoted_at FROM transfers
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, getTransfer, id)
+	row := q.db.QueryRow(ctx, getTransfer, id)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -50,12 +64,135 @@ func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.ToAmount,
+		&i.ExchangeRate,
+		&i.RateQuotedAt,
 	)
 	return i, err
 }
 
+const listAccountTransfers = `-- name: ListAccountTransfers :many
+SELECT id, from_account_id, to_account_id, amount, created_at, to_amount, exchange_rate, rate_quoted_at FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND created_at >= $2 AND created_at < $3
+  AND CASE WHEN from_account_id = $1 THEN amount ELSE to_amount END
+    BETWEEN $4::bigint AND $5::bigint
+ORDER BY created_at, id
+LIMIT $6
+OFFSET $7
+`
+
+type ListAccountTransfersParams struct {
+	AccountID int64     `json:"account_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	MinAmount int64     `json:"min_amount"`
+	MaxAmount int64     `json:"max_amount"`
+	Limit     int32     `json:"limit"`
+	Offset    int32     `json:"offset"`
+}
+
+// the amount filter applies to the amount in the currency of the given account
+func (q *Queries) ListAccountTransfers(ctx context.Context, arg ListAccountTransfersParams) ([]Transfer, error) {
+	rows, err := q.db.Query(ctx, listAccountTransfers,
+		arg.AccountID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Transfer{}
+	for rows.Next() {
+		var i Transfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.ToAmount,
+			&i.ExchangeRate,
+			&i.RateQuotedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountTransfersAfter = `-- name: ListAccountTransfersAfter :many
+SELECT id, from_account_id, to_account_id, amount, created_at, to_amount, exchange_rate, rate_quoted_at FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND created_at >= $2 AND created_at < $3
+  AND CASE WHEN from_account_id = $1 THEN amount ELSE to_amount END
+    BETWEEN $4::bigint AND $5::bigint
+  AND (created_at, id) > ($6::timestamptz, $7::bigint)
+ORDER BY created_at, id
+LIMIT $8
+`
+
+type ListAccountTransfersAfterParams struct {
+	AccountID      int64     `json:"account_id"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	MinAmount      int64     `json:"min_amount"`
+	MaxAmount      int64     `json:"max_amount"`
+	AfterCreatedAt time.Time `json:"after_created_at"`
+	AfterID        int64     `json:"after_id"`
+	Limit          int32     `json:"limit"`
+}
+
+// keyset pagination variant of ListAccountTransfers, returns the transfers after the (created_at, id) cursor
+func (q *Queries) ListAccountTransfersAfter(ctx context.Context, arg ListAccountTransfersAfterParams) ([]Transfer, error) {
+	rows, err := q.db.Query(ctx, listAccountTransfersAfter,
+		arg.AccountID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Transfer{}
+	for rows.Next() {
+		var i Transfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.ToAmount,
+			&i.ExchangeRate,
+			&i.RateQuotedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTransfers = `-- name: ListTransfers :many
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, to_amount, exchange_rate, rate_quoted_at FROM transfers
 WHERE from_account_id = $1 OR to_account_id = $2
 ORDER BY id
 LIMIT $3
@@ -70,7 +207,7 @@ type ListTransfersParams struct {
 }
 
 func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
-	rows, err := q.db.QueryContext(ctx, listTransfers,
+	rows, err := q.db.Query(ctx, listTransfers,
 		arg.FromAccountID,
 		arg.ToAccountID,
 		arg.Limit,
@@ -89,14 +226,14 @@ func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([
 			&i.ToAccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.ToAmount,
+			&i.ExchangeRate,
+			&i.RateQuotedAt,
 		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
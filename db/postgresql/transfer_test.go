@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -13,6 +15,9 @@ func createRandomTransfer(t *testing.T, account1 Account, account2 Account) Tran
 		FromAccountID: account1.ID,
 		ToAccountID:   account2.ID,
 		Amount:        100,
+		ToAmount:      92,
+		ExchangeRate:  "0.92",
+		RateQuotedAt:  time.Now().Truncate(time.Second),
 	}
 
 	transfer, err := testQueries.CreateTransfer(context.Background(), arg)
@@ -23,6 +28,9 @@ func createRandomTransfer(t *testing.T, account1 Account, account2 Account) Tran
 	require.Equal(t, arg.FromAccountID, transfer.FromAccountID)
 	require.Equal(t, arg.ToAccountID, transfer.ToAccountID)
 	require.Equal(t, arg.Amount, transfer.Amount)
+	require.Equal(t, arg.ToAmount, transfer.ToAmount)
+	require.Equal(t, arg.ExchangeRate, transfer.ExchangeRate)
+	require.WithinDuration(t, arg.RateQuotedAt, transfer.RateQuotedAt, time.Second)
 
 	require.NotZero(t, transfer.ID)
 	require.NotZero(t, transfer.CreatedAt)
@@ -82,3 +90,76 @@ func TestListTransfer(t *testing.T) {
 		require.Equal(t, arg.ToAccountID, transfer.ToAccountID)
 	}
 }
+
+func TestListAccountTransfers(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	for i := 0; i < 3; i++ {
+		createRandomTransfer(t, account1, account2)
+		createRandomTransfer(t, account2, account1)
+	}
+
+	arg := ListAccountTransfersParams{
+		AccountID: account1.ID,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Minute),
+		MinAmount: 0,
+		MaxAmount: math.MaxInt64,
+		Limit:     10,
+		Offset:    0,
+	}
+
+	transfers, err := testQueries.ListAccountTransfers(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, transfers, 6)
+
+	for _, transfer := range transfers {
+		require.True(t, transfer.FromAccountID == account1.ID || transfer.ToAccountID == account1.ID)
+	}
+
+	// incoming transfers are filtered on the amount received
+	arg.MinAmount = 92
+	arg.MaxAmount = 92
+	transfers, err = testQueries.ListAccountTransfers(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, transfers, 3)
+
+	for _, transfer := range transfers {
+		require.Equal(t, account1.ID, transfer.ToAccountID)
+	}
+
+	// nothing before the start time
+	arg.MinAmount = 0
+	arg.MaxAmount = math.MaxInt64
+	arg.StartTime = time.Now().Add(time.Minute)
+	transfers, err = testQueries.ListAccountTransfers(context.Background(), arg)
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+}
+
+func TestListAccountTransfersAfter(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	var created []Transfer
+	for i := 0; i < 3; i++ {
+		created = append(created, createRandomTransfer(t, account1, account2))
+	}
+
+	arg := ListAccountTransfersAfterParams{
+		AccountID:      account2.ID,
+		StartTime:      time.Now().Add(-time.Minute),
+		EndTime:        time.Now().Add(time.Minute),
+		MinAmount:      0,
+		MaxAmount:      math.MaxInt64,
+		AfterCreatedAt: created[1].CreatedAt,
+		AfterID:        created[1].ID,
+		Limit:          5,
+	}
+
+	transfers, err := testQueries.ListAccountTransfersAfter(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, created[2].ID, transfers[0].ID)
+}
@@ -7,6 +7,9 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -17,7 +20,7 @@ INSERT INTO users (
     email 
 ) VALUES (
     $1, $2, $3, $4
-)RETURNING username, hashed_password, full_name, email, password_changed_at, created_at
+)RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at
 `
 
 type CreateUserParams struct {
@@ -28,7 +31,7 @@ type CreateUserParams struct {
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser,
+	row := q.db.QueryRow(ctx, createUser,
 		arg.Username,
 		arg.HashedPassword,
 		arg.FullName,
@@ -42,17 +45,259 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT username, hashed_password, full_name, email, password_changed_at, created_at FROM users
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at FROM users
 WHERE username = $1 LIMIT 1
 `
 
 func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, username)
+	row := q.db.QueryRow(ctx, getUser, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at FROM users
+WHERE email = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at FROM users
+WHERE username = $1 LIMIT 1
+FOR NO KEY UPDATE
+`
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserForUpdate, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const listTokenRevocationsSince = `-- name: ListTokenRevocationsSince :many
+SELECT username, tokens_revoked_at FROM users
+WHERE tokens_revoked_at > $1
+ORDER BY tokens_revoked_at
+`
+
+type ListTokenRevocationsSinceRow struct {
+	Username        string    `json:"username"`
+	TokensRevokedAt time.Time `json:"tokens_revoked_at"`
+}
+
+// tokens issued to these users before tokens_revoked_at are no longer valid
+func (q *Queries) ListTokenRevocationsSince(ctx context.Context, since time.Time) ([]ListTokenRevocationsSinceRow, error) {
+	rows, err := q.db.Query(ctx, listTokenRevocationsSince, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTokenRevocationsSinceRow{}
+	for rows.Next() {
+		var i ListTokenRevocationsSinceRow
+		if err := rows.Scan(
+			&i.Username,
+			&i.TokensRevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeUserTokens = `-- name: RevokeUserTokens :one
+UPDATE users
+SET tokens_revoked_at = GREATEST(tokens_revoked_at, $1)
+WHERE username = $2
+RETURNING tokens_revoked_at
+`
+
+type RevokeUserTokensParams struct {
+	TokensRevokedAt time.Time `json:"tokens_revoked_at"`
+	Username        string    `json:"username"`
+}
+
+// revokes every token issued to the user before tokens_revoked_at, which is taken from the clock that issues the tokens.
+// The cutoff never moves back.
+func (q *Queries) RevokeUserTokens(ctx context.Context, arg RevokeUserTokensParams) (time.Time, error) {
+	row := q.db.QueryRow(ctx, revokeUserTokens, arg.TokensRevokedAt, arg.Username)
+	var tokens_revoked_at time.Time
+	err := row.Scan(&tokens_revoked_at)
+	return tokens_revoked_at, err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET
+  hashed_password = COALESCE($1, hashed_password),
+  password_changed_at = CASE WHEN $1 IS NULL THEN password_changed_at ELSE now() END,
+  full_name = COALESCE($2, full_name),
+  email = COALESCE($3, email),
+  is_email_verified = CASE WHEN $3 IS NULL OR $3 = email THEN is_email_verified ELSE false END
+WHERE username = $4
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at
+`
+
+type UpdateUserParams struct {
+	HashedPassword pgtype.Text `json:"hashed_password"`
+	FullName       pgtype.Text `json:"full_name"`
+	Email          pgtype.Text `json:"email"`
+	Username       string      `json:"username"`
+}
+
+// null fields are left unchanged, a new password moves password_changed_at
+// and a new email has to be verified again
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUser,
+		arg.HashedPassword,
+		arg.FullName,
+		arg.Email,
+		arg.Username,
+	)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const updateUserFrozen = `-- name: UpdateUserFrozen :one
+UPDATE users
+SET is_frozen = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at
+`
+
+type UpdateUserFrozenParams struct {
+	Username string `json:"username"`
+	IsFrozen bool   `json:"is_frozen"`
+}
+
+func (q *Queries) UpdateUserFrozen(ctx context.Context, arg UpdateUserFrozenParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserFrozen, arg.Username, arg.IsFrozen)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $2, password_changed_at = now()
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at
+`
+
+type UpdateUserPasswordParams struct {
+	Username       string `json:"username"`
+	HashedPassword string `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPassword, arg.Username, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_frozen, is_email_verified, tokens_revoked_at
+`
+
+type VerifyUserEmailParams struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// only verifies the address the code was sent to, a code sent before an email change doesn't verify the new one
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, verifyUserEmail, arg.Username, arg.Email)
 	var i User
 	err := row.Scan(
 		&i.Username,
@@ -61,6 +306,10 @@ func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.IsFrozen,
+		&i.IsEmailVerified,
+		&i.TokensRevokedAt,
 	)
 	return i, err
 }
@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pawpaw2022/simplebank/util"
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +33,7 @@ func CreateRandomUser(t *testing.T) User {
 	require.Equal(t, arg.HashedPassword, user.HashedPassword)
 
 	require.True(t, user.PasswordChangedAt.IsZero())
+	require.True(t, user.TokensRevokedAt.IsZero())
 	require.NotZero(t, user.CreatedAt)
 
 	return user
@@ -56,3 +60,181 @@ func TestGetUser(t *testing.T) {
 	require.WithinDuration(t, user1.PasswordChangedAt, user2.PasswordChangedAt, 0)
 
 }
+
+func TestGetUserByEmail(t *testing.T) {
+	user1 := CreateRandomUser(t)
+
+	user2, err := testQueries.GetUserByEmail(context.Background(), user1.Email)
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, user2.Username)
+
+	_, err = testQueries.GetUserByEmail(context.Background(), util.RandomEmail())
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestUpdateUserFrozen(t *testing.T) {
+	user1 := CreateRandomUser(t)
+	require.Equal(t, util.DepositorRole, user1.Role)
+	require.False(t, user1.IsFrozen)
+
+	user2, err := testQueries.UpdateUserFrozen(context.Background(), UpdateUserFrozenParams{
+		Username: user1.Username,
+		IsFrozen: true,
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, user2.Username)
+	require.True(t, user2.IsFrozen)
+
+	// the tokens are revoked by SetUserFrozenTx
+	require.True(t, user2.TokensRevokedAt.Equal(user1.TokensRevokedAt))
+
+	user3, err := testQueries.UpdateUserFrozen(context.Background(), UpdateUserFrozenParams{
+		Username: user1.Username,
+		IsFrozen: false,
+	})
+
+	require.NoError(t, err)
+	require.False(t, user3.IsFrozen)
+}
+
+func TestUpdateUserTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	created, err := createRandomUserTx(t, nil)
+	require.NoError(t, err)
+	_, err = store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{
+		EmailID:    created.VerifyEmail.ID,
+		SecretCode: created.VerifyEmail.SecretCode,
+	})
+	require.NoError(t, err)
+	oldUser := created.User
+
+	// only the full name is set
+	newFullName := util.RandomOwner()
+	user, err := store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			Username: oldUser.Username,
+			FullName: pgtype.Text{String: newFullName, Valid: true},
+		},
+		Audit: AuditParams{Actor: oldUser.Username},
+		AfterEmailChange: func(q Querier, user User, verifyEmail VerifyEmail) error {
+			t.Fatal("email didn't change")
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newFullName, user.FullName)
+	require.Equal(t, oldUser.Email, user.Email)
+	require.Equal(t, oldUser.HashedPassword, user.HashedPassword)
+	require.True(t, user.PasswordChangedAt.Equal(oldUser.PasswordChangedAt))
+	require.True(t, user.TokensRevokedAt.Equal(oldUser.TokensRevokedAt))
+	require.True(t, user.IsEmailVerified)
+
+	events := auditEventsOf(t, oldUser.Username)
+	event := events[len(events)-1]
+	require.Equal(t, AuditUserUpdated, event.Action)
+	require.Contains(t, string(event.Before), oldUser.FullName)
+	require.Contains(t, string(event.After), newFullName)
+
+	// a new password moves password_changed_at and tokens_revoked_at, and blocks the sessions
+	newHashedPassword := util.RandomString(32)
+	user, err = store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			Username:       oldUser.Username,
+			HashedPassword: pgtype.Text{String: newHashedPassword, Valid: true},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newHashedPassword, user.HashedPassword)
+	require.True(t, user.PasswordChangedAt.After(oldUser.PasswordChangedAt))
+	require.WithinDuration(t, time.Now(), user.TokensRevokedAt, time.Second)
+	require.True(t, user.TokensRevokedAt.After(oldUser.TokensRevokedAt))
+	require.True(t, user.IsEmailVerified)
+
+	// a new email must be verified again
+	newEmail := util.RandomEmail()
+	var sent VerifyEmail
+	user, err = store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			Username: oldUser.Username,
+			Email:    pgtype.Text{String: newEmail, Valid: true},
+		},
+		SecretCode: util.RandomString(32),
+		AfterEmailChange: func(q Querier, user User, verifyEmail VerifyEmail) error {
+			sent = verifyEmail
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newEmail, user.Email)
+	require.False(t, user.IsEmailVerified)
+	require.Equal(t, newEmail, sent.Email)
+	require.Equal(t, oldUser.Username, sent.Username)
+
+	// the update is rolled back if the verification email cannot be sent
+	errSend := errors.New("cannot send email")
+	_, err = store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			Username: oldUser.Username,
+			Email:    pgtype.Text{String: util.RandomEmail(), Valid: true},
+		},
+		SecretCode: util.RandomString(32),
+		AfterEmailChange: func(q Querier, user User, verifyEmail VerifyEmail) error {
+			return errSend
+		},
+	})
+	require.ErrorIs(t, err, errSend)
+
+	user, err = testQueries.GetUser(context.Background(), oldUser.Username)
+	require.NoError(t, err)
+	require.Equal(t, newEmail, user.Email)
+
+	_, err = store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			Username: util.RandomOwner(),
+			FullName: pgtype.Text{String: newFullName, Valid: true},
+		},
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	user := CreateRandomUser(t)
+
+	arg := RevokeUserTokensParams{
+		Username:        user.Username,
+		TokensRevokedAt: time.Now(),
+	}
+
+	tokensRevokedAt, err := testQueries.RevokeUserTokens(context.Background(), arg)
+	require.NoError(t, err)
+	require.WithinDuration(t, arg.TokensRevokedAt, tokensRevokedAt, time.Millisecond)
+
+	// an older cutoff doesn't move it back
+	older, err := testQueries.RevokeUserTokens(context.Background(), RevokeUserTokensParams{
+		Username:        user.Username,
+		TokensRevokedAt: arg.TokensRevokedAt.Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	require.True(t, older.Equal(tokensRevokedAt))
+
+	cutoffs, err := testQueries.ListTokenRevocationsSince(context.Background(), time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	var revoked bool
+	for _, c := range cutoffs {
+		revoked = revoked || (c.Username == user.Username && c.TokensRevokedAt.Equal(tokensRevokedAt))
+	}
+	require.True(t, revoked)
+
+	// the password is left as is
+	user2, err := testQueries.GetUser(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.True(t, user2.PasswordChangedAt.Equal(user.PasswordChangedAt))
+
+	_, err = testQueries.RevokeUserTokens(context.Background(), RevokeUserTokensParams{
+		Username:        util.RandomOwner(),
+		TokensRevokedAt: time.Now(),
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -0,0 +1,471 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// CreateUserTxParams contains the input parameters of the create user transaction
+type CreateUserTxParams struct {
+	CreateUserParams
+	SecretCode  string // code the user must send back to verify the email address
+	Audit       AuditParams
+	AfterCreate func(q Querier, user User, verifyEmail VerifyEmail) error // optional, an error rolls the user back
+}
+
+// CreateUserTxResult is the output result of the create user transaction
+type CreateUserTxResult struct {
+	User        User
+	VerifyEmail VerifyEmail
+}
+
+// CreateUserTx creates a user with the code verifying its email address and records it in the audit log
+// within a single database transaction.
+// AfterCreate is called before the commit with the queries of the transaction, typically to enqueue
+// the verification email with them, so the user is not created if the email cannot be enqueued.
+func (store *SQLStore) CreateUserTx(ctx context.Context, arg CreateUserTxParams) (CreateUserTxResult, error) {
+	ctx, span := startTx(ctx, "CreateUserTx")
+
+	var result CreateUserTxResult
+
+	err := store.execTx(ctx, "CreateUserTx", func(q *Queries) error {
+
+		var err error
+
+		result.User, err = q.CreateUser(ctx, arg.CreateUserParams)
+		if err != nil {
+			return err
+		}
+
+		result.VerifyEmail, err = q.CreateVerifyEmail(ctx, CreateVerifyEmailParams{
+			Username:   result.User.Username,
+			Email:      result.User.Email,
+			SecretCode: arg.SecretCode,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditUserCreated,
+			TargetType: AuditTargetUser,
+			TargetID:   result.User.Username,
+			After:      newUserState(result.User),
+		})
+		if err != nil {
+			return err
+		}
+
+		if arg.AfterCreate != nil {
+			return arg.AfterCreate(q, result.User, result.VerifyEmail)
+		}
+
+		return nil
+	})
+
+	endTx(span, err)
+	return result, err
+}
+
+// VerifyEmailTxParams contains the input parameters of the verify email transaction
+type VerifyEmailTxParams struct {
+	EmailID    int64
+	SecretCode string
+	Audit      AuditParams // the actor is set to the verified user
+}
+
+// VerifyEmailTxResult is the output result of the verify email transaction
+type VerifyEmailTxResult struct {
+	User        User
+	VerifyEmail VerifyEmail
+}
+
+// VerifyEmailTx uses a verification code and marks the email of its user as verified within a single database transaction.
+// It returns ErrRecordNotFound if the code is wrong, used or expired, or if the user email changed since it was sent.
+func (store *SQLStore) VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error) {
+	ctx, span := startTx(ctx, "VerifyEmailTx")
+
+	var result VerifyEmailTxResult
+
+	err := store.execTx(ctx, "VerifyEmailTx", func(q *Queries) error {
+
+		var err error
+
+		result.VerifyEmail, err = q.UseVerifyEmail(ctx, UseVerifyEmailParams{
+			ID:         arg.EmailID,
+			SecretCode: arg.SecretCode,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.VerifyUserEmail(ctx, VerifyUserEmailParams{
+			Username: result.VerifyEmail.Username,
+			Email:    result.VerifyEmail.Email,
+		})
+		if err != nil {
+			return err
+		}
+
+		audit := arg.Audit
+		audit.Actor = result.User.Username
+
+		return recordAuditEvent(ctx, q, audit, auditEvent{
+			Action:     AuditEmailVerified,
+			TargetType: AuditTargetUser,
+			TargetID:   result.User.Username,
+			After:      newUserState(result.User),
+		})
+	})
+
+	endTx(span, err)
+	return result, err
+}
+
+// ResetPasswordTxParams contains the input parameters of the reset password transaction
+type ResetPasswordTxParams struct {
+	TokenHash      string // hash of the token sent by email
+	HashedPassword string
+	Audit          AuditParams // the actor is set to the user resetting the password
+}
+
+// ResetPasswordTx uses a password reset token and sets the new password of its user within a single database transaction.
+// The other reset tokens of the user are invalidated and all sessions are blocked,
+// tokens issued before the tokens_revoked_at of the returned user must be rejected.
+// It returns ErrRecordNotFound if the token is unknown, used or expired.
+func (store *SQLStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (User, error) {
+	ctx, span := startTx(ctx, "ResetPasswordTx")
+
+	var user User
+
+	err := store.execTx(ctx, "ResetPasswordTx", func(q *Queries) error {
+
+		resetToken, err := q.UsePasswordResetToken(ctx, arg.TokenHash)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+			Username:       resetToken.Username,
+			HashedPassword: arg.HashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.InvalidatePasswordResetTokens(ctx, user.Username); err != nil {
+			return err
+		}
+
+		if err := signOutEverywhere(ctx, q, &user); err != nil {
+			return err
+		}
+
+		audit := arg.Audit
+		audit.Actor = user.Username
+
+		return recordAuditEvent(ctx, q, audit, auditEvent{
+			Action:     AuditPasswordReset,
+			TargetType: AuditTargetUser,
+			TargetID:   user.Username,
+			After:      newUserState(user),
+		})
+	})
+
+	endTx(span, err)
+	return user, err
+}
+
+// UnlockLoginTxParams contains the input parameters of the unlock login transaction
+type UnlockLoginTxParams struct {
+	Username string
+	Audit    AuditParams
+}
+
+// UnlockLoginTx clears the failed login attempts of a user, lifting its lockout,
+// and records it in the audit log within a single database transaction.
+// The lockout of the client IPs the attempts came from is left as is.
+// It returns ErrRecordNotFound if the user doesn't exist.
+func (store *SQLStore) UnlockLoginTx(ctx context.Context, arg UnlockLoginTxParams) error {
+	ctx, span := startTx(ctx, "UnlockLoginTx")
+
+	err := store.execTx(ctx, "UnlockLoginTx", func(q *Queries) error {
+
+		user, err := q.GetUser(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		if err := q.ClearLoginFailures(ctx, user.Username); err != nil {
+			return err
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditLoginUnlocked,
+			TargetType: AuditTargetUser,
+			TargetID:   user.Username,
+		})
+	})
+
+	endTx(span, err)
+	return err
+}
+
+// SetUserFrozenTxParams contains the input parameters of the set user frozen transaction
+type SetUserFrozenTxParams struct {
+	Username string
+	IsFrozen bool
+	Audit    AuditParams
+}
+
+// SetUserFrozenTx freezes or unfreezes a user and records it in the audit log within a single database transaction.
+// Freezing also blocks every session of the user, tokens issued before the tokens_revoked_at
+// of the returned user must be rejected.
+// It returns ErrRecordNotFound if the user doesn't exist.
+func (store *SQLStore) SetUserFrozenTx(ctx context.Context, arg SetUserFrozenTxParams) (User, error) {
+	ctx, span := startTx(ctx, "SetUserFrozenTx")
+
+	var user User
+
+	err := store.execTx(ctx, "SetUserFrozenTx", func(q *Queries) error {
+
+		before, err := q.GetUserForUpdate(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUserFrozen(ctx, UpdateUserFrozenParams{
+			Username: arg.Username,
+			IsFrozen: arg.IsFrozen,
+		})
+		if err != nil {
+			return err
+		}
+
+		action := AuditUserUnfrozen
+		if arg.IsFrozen {
+			action = AuditUserFrozen
+
+			if err := signOutEverywhere(ctx, q, &user); err != nil {
+				return err
+			}
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     action,
+			TargetType: AuditTargetUser,
+			TargetID:   user.Username,
+			Before:     newUserState(before),
+			After:      newUserState(user),
+		})
+	})
+
+	endTx(span, err)
+	return user, err
+}
+
+// UpdateUserTxParams contains the input parameters of the update user transaction
+type UpdateUserTxParams struct {
+	UpdateUserParams
+	SecretCode       string // code verifying the new email, required when the email is set
+	Audit            AuditParams
+	AfterEmailChange func(q Querier, user User, verifyEmail VerifyEmail) error // optional, an error rolls the update back
+}
+
+// UpdateUserTx updates the fields of a user that are set and records the change in the audit log
+// within a single database transaction.
+// A new password blocks every session of the user, tokens issued before the tokens_revoked_at
+// of the returned user must be rejected.
+// A new email is unverified until the code created for it is used, AfterEmailChange is called
+// before the commit with the queries of the transaction to enqueue it. Setting the current email again changes nothing.
+func (store *SQLStore) UpdateUserTx(ctx context.Context, arg UpdateUserTxParams) (User, error) {
+	ctx, span := startTx(ctx, "UpdateUserTx")
+
+	var user User
+
+	err := store.execTx(ctx, "UpdateUserTx", func(q *Queries) error {
+
+		before, err := q.GetUserForUpdate(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUser(ctx, arg.UpdateUserParams)
+		if err != nil {
+			return err
+		}
+
+		if arg.HashedPassword.Valid {
+			if err := q.InvalidatePasswordResetTokens(ctx, user.Username); err != nil {
+				return err
+			}
+
+			if err := signOutEverywhere(ctx, q, &user); err != nil {
+				return err
+			}
+		}
+
+		err = recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditUserUpdated,
+			TargetType: AuditTargetUser,
+			TargetID:   user.Username,
+			Before:     newUserState(before),
+			After:      newUserState(user),
+		})
+		if err != nil {
+			return err
+		}
+
+		if user.Email == before.Email {
+			return nil
+		}
+
+		verifyEmail, err := q.CreateVerifyEmail(ctx, CreateVerifyEmailParams{
+			Username:   user.Username,
+			Email:      user.Email,
+			SecretCode: arg.SecretCode,
+		})
+		if err != nil {
+			return err
+		}
+
+		if arg.AfterEmailChange != nil {
+			return arg.AfterEmailChange(q, user, verifyEmail)
+		}
+
+		return nil
+	})
+
+	endTx(span, err)
+	return user, err
+}
+
+// ReserveLoginAttemptTxParams contains the input parameters of the reserve login attempt transaction
+type ReserveLoginAttemptTxParams struct {
+	Username string
+	ClientIp string
+	Since    time.Time                               // failures before are not counted
+	Admit    func(failures GetLoginFailuresRow) bool // reports whether the recent failures allow the attempt
+}
+
+// ReserveLoginAttemptTxResult is the output result of the reserve login attempt transaction
+type ReserveLoginAttemptTxResult struct {
+	Admitted bool
+	Attempt  LoginAttempt // zero unless the attempt was admitted
+}
+
+// ReserveLoginAttemptTx admits a login attempt from the recent failures of the username and of the client IP,
+// and records an admitted attempt as failed before its password is checked, within a single database transaction.
+// The attempts on the username and from the client IP are serialized, so concurrent attempts
+// see each other's reservations and cannot all get through before the lockout.
+// Rejected attempts are not recorded, so a lockout ends on time.
+func (store *SQLStore) ReserveLoginAttemptTx(ctx context.Context, arg ReserveLoginAttemptTxParams) (ReserveLoginAttemptTxResult, error) {
+	ctx, span := startTx(ctx, "ReserveLoginAttemptTx")
+
+	var result ReserveLoginAttemptTxResult
+
+	err := store.execTx(ctx, "ReserveLoginAttemptTx", func(q *Queries) error {
+		result = ReserveLoginAttemptTxResult{}
+
+		err := q.LockLoginAttempts(ctx, LockLoginAttemptsParams{
+			Username: arg.Username,
+			ClientIp: arg.ClientIp,
+		})
+		if err != nil {
+			return err
+		}
+
+		failures, err := q.GetLoginFailures(ctx, GetLoginFailuresParams{
+			Username: arg.Username,
+			ClientIp: arg.ClientIp,
+			Since:    arg.Since,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !arg.Admit(failures) {
+			return nil
+		}
+
+		result.Attempt, err = q.CreateLoginAttempt(ctx, CreateLoginAttemptParams{
+			Username:  arg.Username,
+			ClientIp:  arg.ClientIp,
+			Succeeded: false,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Admitted = true
+		return nil
+	})
+
+	endTx(span, err)
+	return result, err
+}
+
+// CreateSessionTxParams contains the input parameters of the login transaction
+type CreateSessionTxParams struct {
+	CreateSessionParams
+	LoginAttemptID int64 // attempt reserved by ReserveLoginAttemptTx
+	Audit          AuditParams
+}
+
+// CreateSessionTx creates the session of a successful login and records the login in the audit log
+// within a single database transaction.
+// The reserved attempt of the login is marked successful, which clears the failed attempts of the user
+// so they no longer count toward its lockout.
+func (store *SQLStore) CreateSessionTx(ctx context.Context, arg CreateSessionTxParams) (Session, error) {
+	ctx, span := startTx(ctx, "CreateSessionTx")
+
+	var session Session
+
+	err := store.execTx(ctx, "CreateSessionTx", func(q *Queries) error {
+
+		var err error
+
+		session, err = q.CreateSession(ctx, arg.CreateSessionParams)
+		if err != nil {
+			return err
+		}
+
+		if err := q.SucceedLoginAttempt(ctx, arg.LoginAttemptID); err != nil {
+			return err
+		}
+
+		if err := q.ClearLoginFailures(ctx, session.Username); err != nil {
+			return err
+		}
+
+		return recordAuditEvent(ctx, q, arg.Audit, auditEvent{
+			Action:     AuditLoginSucceeded,
+			TargetType: AuditTargetSession,
+			TargetID:   session.ID.String(),
+			After:      newSessionState(session),
+		})
+	})
+
+	endTx(span, err)
+	return session, err
+}
+
+// signOutEverywhere blocks every session of the user and revokes every token issued to it until now.
+// The cutoff is taken from the clock of the application, which sets the issue time of the tokens,
+// and is stored in the TokensRevokedAt of the user.
+func signOutEverywhere(ctx context.Context, q *Queries, user *User) error {
+	if err := q.BlockUserSessions(ctx, user.Username); err != nil {
+		return err
+	}
+
+	tokensRevokedAt, err := q.RevokeUserTokens(ctx, RevokeUserTokensParams{
+		Username:        user.Username,
+		TokensRevokedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	user.TokensRevokedAt = tokensRevokedAt
+	return nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUserTx(t *testing.T, afterCreate func(q Querier, user User, verifyEmail VerifyEmail) error) (CreateUserTxResult, error) {
+	store := NewStore(testDB, RetryConfig{})
+
+	return store.CreateUserTx(context.Background(), CreateUserTxParams{
+		CreateUserParams: CreateUserParams{
+			Username:       util.RandomOwner(),
+			HashedPassword: util.RandomString(32),
+			FullName:       util.RandomOwner(),
+			Email:          util.RandomEmail(),
+		},
+		SecretCode:  util.RandomString(32),
+		AfterCreate: afterCreate,
+	})
+}
+
+func TestCreateUserTxAfterCreate(t *testing.T) {
+	var sent VerifyEmail
+	result, err := createRandomUserTx(t, func(q Querier, user User, verifyEmail VerifyEmail) error {
+		sent = verifyEmail
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.False(t, result.User.IsEmailVerified)
+	require.Equal(t, result.VerifyEmail, sent)
+	require.Equal(t, result.User.Username, sent.Username)
+	require.Equal(t, result.User.Email, sent.Email)
+	require.False(t, sent.IsUsed)
+	require.True(t, sent.ExpiredAt.After(sent.CreatedAt))
+
+	// the user is rolled back with the task enqueued in the transaction if the email cannot be sent
+	errSend := errors.New("cannot send email")
+	var task Task
+	result, err = createRandomUserTx(t, func(q Querier, user User, verifyEmail VerifyEmail) error {
+		var err error
+		task, err = q.CreateTask(context.Background(), CreateTaskParams{
+			Type:        "task:test",
+			Payload:     []byte(`{"id":1}`),
+			Queue:       "test",
+			MaxAttempts: 3,
+			RunAt:       time.Now(),
+		})
+		require.NoError(t, err)
+		return errSend
+	})
+	require.ErrorIs(t, err, errSend)
+
+	_, err = testQueries.GetUser(context.Background(), result.User.Username)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	_, err = testQueries.GetTask(context.Background(), task.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestVerifyEmailTx(t *testing.T) {
+	store := NewStore(testDB, RetryConfig{})
+
+	created, err := createRandomUserTx(t, nil)
+	require.NoError(t, err)
+
+	// wrong code
+	_, err = store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{
+		EmailID:    created.VerifyEmail.ID,
+		SecretCode: util.RandomString(32),
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	arg := VerifyEmailTxParams{
+		EmailID:    created.VerifyEmail.ID,
+		SecretCode: created.VerifyEmail.SecretCode,
+	}
+
+	result, err := store.VerifyEmailTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, result.User.IsEmailVerified)
+	require.True(t, result.VerifyEmail.IsUsed)
+
+	events := auditEventsOf(t, created.User.Username)
+	require.Equal(t, AuditEmailVerified, events[len(events)-1].Action)
+
+	// the code can only be used once
+	_, err = store.VerifyEmailTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
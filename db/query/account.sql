@@ -22,6 +22,14 @@ ORDER BY id
 LIMIT $2
 OFFSET $3;
 
+-- name: ListAccountsAfter :many
+-- keyset pagination: returns the accounts created after the (created_at, id) cursor
+SELECT * FROM accounts
+WHERE owner = sqlc.arg(owner)
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamptz, sqlc.arg(after_id)::bigint)
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
 -- name: UpdateAccount :one
 UPDATE accounts
 SET balance = $2
@@ -38,3 +46,9 @@ RETURNING *;
 -- name: DeleteAccount :exec
 DELETE FROM accounts
 WHERE id = $1;
+
+-- name: DebitAccountBalance :one
+UPDATE accounts
+SET balance = balance - sqlc.arg(amount)
+WHERE id = sqlc.arg(id) AND balance >= sqlc.arg(amount)
+RETURNING *;
@@ -0,0 +1,18 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+  actor, action, target_type, target_id, client_ip, user_agent, before, after
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING *;
+
+-- name: ListAuditEvents :many
+-- empty filters match every event, returns the events after the (created_at, id) cursor
+SELECT * FROM audit_events
+WHERE (sqlc.arg(actor)::varchar = '' OR actor = sqlc.arg(actor))
+  AND (sqlc.arg(action)::varchar = '' OR action = sqlc.arg(action))
+  AND (sqlc.arg(target_type)::varchar = '' OR target_type = sqlc.arg(target_type))
+  AND (sqlc.arg(target_id)::varchar = '' OR target_id = sqlc.arg(target_id))
+  AND created_at >= sqlc.arg(start_time) AND created_at < sqlc.arg(end_time)
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamptz, sqlc.arg(after_id)::bigint)
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
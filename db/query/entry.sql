@@ -1,8 +1,10 @@
 -- name: CreateEntry :one
+-- the entry is created once the account balance is updated, created_at is taken after the account row is locked
+-- so the entries of an account are in the order of their balance_after
 INSERT INTO entries (
-  amount, account_id
+  amount, account_id, reference, balance_after, created_at
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4, clock_timestamp()
 )RETURNING *;
 
 
@@ -10,6 +12,25 @@ INSERT INTO entries (
 SELECT * FROM entries
 WHERE id = $1 LIMIT 1;
 
+-- name: ListAccountEntries :many
+SELECT * FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND created_at >= sqlc.arg(start_time) AND created_at < sqlc.arg(end_time)
+  AND abs(amount) BETWEEN sqlc.arg(min_amount)::bigint AND sqlc.arg(max_amount)::bigint
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: ListAccountEntriesAfter :many
+-- keyset pagination variant of ListAccountEntries, returns the entries after the (created_at, id) cursor
+SELECT * FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamptz, sqlc.arg(after_id)::bigint)
+  AND created_at >= sqlc.arg(start_time) AND created_at < sqlc.arg(end_time)
+  AND abs(amount) BETWEEN sqlc.arg(min_amount)::bigint AND sqlc.arg(max_amount)::bigint
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
 -- name: ListEntries :many
 SELECT * FROM entries
 WHERE account_id = $1
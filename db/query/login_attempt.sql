@@ -0,0 +1,40 @@
+-- name: CreateLoginAttempt :one
+INSERT INTO login_attempts (
+  username, client_ip, succeeded
+) VALUES (
+  $1, $2, $3
+) RETURNING *;
+
+-- name: GetLoginFailures :one
+-- failed attempts since the given time counting toward the lockout of the username and of the client IP,
+-- the last failure times are the zero time without failures
+SELECT
+  count(*) FILTER (WHERE username = sqlc.arg(username) AND NOT is_cleared)::int AS username_failures,
+  COALESCE(max(created_at) FILTER (WHERE username = sqlc.arg(username) AND NOT is_cleared), '0001-01-01')::timestamptz AS username_last_failure,
+  count(*) FILTER (WHERE client_ip = sqlc.arg(client_ip))::int AS client_ip_failures,
+  COALESCE(max(created_at) FILTER (WHERE client_ip = sqlc.arg(client_ip)), '0001-01-01')::timestamptz AS client_ip_last_failure
+FROM login_attempts
+WHERE succeeded = false
+  AND created_at > sqlc.arg(since)
+  AND (username = sqlc.arg(username) OR client_ip = sqlc.arg(client_ip));
+
+-- name: ClearLoginFailures :exec
+UPDATE login_attempts
+SET is_cleared = true
+WHERE username = $1 AND succeeded = false AND is_cleared = false;
+
+-- name: LockLoginAttempts :exec
+-- serializes the attempts on the username and from the client IP until the transaction ends,
+-- the username is always locked first so concurrent attempts cannot deadlock
+SELECT
+  pg_advisory_xact_lock(1, hashtext(sqlc.arg(username)::text)),
+  pg_advisory_xact_lock(2, hashtext(sqlc.arg(client_ip)::text));
+
+-- name: SucceedLoginAttempt :exec
+UPDATE login_attempts
+SET succeeded = true
+WHERE id = $1;
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts
+WHERE id = $1;
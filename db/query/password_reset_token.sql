@@ -0,0 +1,21 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+  username, token_hash
+) VALUES (
+  $1, $2
+) RETURNING *;
+
+-- name: UsePasswordResetToken :one
+-- marks the token as used, only succeeds once and before it expires
+UPDATE password_reset_tokens
+SET is_used = true
+WHERE token_hash = $1
+  AND is_used = false
+  AND expired_at > now()
+RETURNING *;
+
+-- name: InvalidatePasswordResetTokens :exec
+-- marks the other tokens of the user as used once the password is reset
+UPDATE password_reset_tokens
+SET is_used = true
+WHERE username = $1 AND is_used = false;
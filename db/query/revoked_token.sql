@@ -0,0 +1,15 @@
+-- name: RevokeToken :exec
+INSERT INTO revoked_tokens (
+  id, username, expires_at
+) VALUES (
+  $1, $2, $3
+) ON CONFLICT (id) DO NOTHING;
+
+-- name: GetRevokedToken :one
+SELECT * FROM revoked_tokens
+WHERE id = $1 LIMIT 1;
+
+-- name: ListActiveRevokedTokens :many
+SELECT * FROM revoked_tokens
+WHERE expires_at > now()
+ORDER BY revoked_at;
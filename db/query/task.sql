@@ -0,0 +1,65 @@
+-- name: CreateTask :one
+INSERT INTO tasks (
+  type, payload, queue, priority, max_attempts, run_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: GetTask :one
+SELECT * FROM tasks
+WHERE id = $1 LIMIT 1;
+
+-- name: ClaimTask :one
+-- locks the next due task until locked_until, workers skip the tasks locked by the others.
+-- A running task whose lock expired was abandoned by its worker and is claimed again,
+-- unless it used up its attempts, see DeadLetterExpiredTasks.
+UPDATE tasks
+SET status = 'running',
+  attempts = attempts + 1,
+  run_at = sqlc.arg(locked_until)::timestamptz,
+  updated_at = now()
+WHERE id = (
+  SELECT id FROM tasks
+  WHERE status IN ('pending', 'running')
+    AND run_at <= now()
+    AND attempts < max_attempts
+  ORDER BY priority DESC, run_at, id
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteTask :exec
+-- the attempt must match, so a worker whose lock expired cannot overwrite a later attempt
+UPDATE tasks
+SET status = 'done',
+  last_error = '',
+  updated_at = now()
+WHERE id = $1 AND attempts = $2 AND status = 'running';
+
+-- name: RetryTask :exec
+UPDATE tasks
+SET status = 'pending',
+  run_at = $3,
+  last_error = $4,
+  updated_at = now()
+WHERE id = $1 AND attempts = $2 AND status = 'running';
+
+-- name: DeadLetterExpiredTasks :many
+-- a running task whose lock expired on its last attempt was abandoned by its worker and is not claimed again
+UPDATE tasks
+SET status = 'dead',
+  last_error = 'lock expired on the last attempt',
+  updated_at = now()
+WHERE status = 'running'
+  AND run_at <= now()
+  AND attempts >= max_attempts
+RETURNING *;
+
+-- name: DeadLetterTask :exec
+-- the task is kept with its last error but never claimed again
+UPDATE tasks
+SET status = 'dead',
+  last_error = $3,
+  updated_at = now()
+WHERE id = $1 AND attempts = $2 AND status = 'running';
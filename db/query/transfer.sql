@@ -1,14 +1,36 @@
 -- name: CreateTransfer :one
 INSERT INTO transfers (
-  amount, from_account_id, to_account_id
+  amount, from_account_id, to_account_id, to_amount, exchange_rate, rate_quoted_at
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5, $6
 )RETURNING *;
 
 -- name: GetTransfer :one
 SELECT * FROM transfers
 WHERE id = $1 LIMIT 1;
 
+-- name: ListAccountTransfers :many
+-- the amount filter applies to the amount in the currency of the given account
+SELECT * FROM transfers
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND created_at >= sqlc.arg(start_time) AND created_at < sqlc.arg(end_time)
+  AND CASE WHEN from_account_id = sqlc.arg(account_id) THEN amount ELSE to_amount END
+    BETWEEN sqlc.arg(min_amount)::bigint AND sqlc.arg(max_amount)::bigint
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: ListAccountTransfersAfter :many
+-- keyset pagination variant of ListAccountTransfers, returns the transfers after the (created_at, id) cursor
+SELECT * FROM transfers
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND created_at >= sqlc.arg(start_time) AND created_at < sqlc.arg(end_time)
+  AND CASE WHEN from_account_id = sqlc.arg(account_id) THEN amount ELSE to_amount END
+    BETWEEN sqlc.arg(min_amount)::bigint AND sqlc.arg(max_amount)::bigint
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamptz, sqlc.arg(after_id)::bigint)
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
 -- name: ListTransfers :many
 SELECT * FROM transfers
 WHERE from_account_id = $1 OR to_account_id = $2
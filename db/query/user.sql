@@ -13,3 +13,57 @@ INSERT INTO users (
 SELECT * FROM users
 WHERE username = $1 LIMIT 1;
 
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE username = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: UpdateUser :one
+-- null fields are left unchanged, a new password moves password_changed_at
+-- and a new email has to be verified again
+UPDATE users
+SET
+  hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+  password_changed_at = CASE WHEN sqlc.narg(hashed_password) IS NULL THEN password_changed_at ELSE now() END,
+  full_name = COALESCE(sqlc.narg(full_name), full_name),
+  email = COALESCE(sqlc.narg(email), email),
+  is_email_verified = CASE WHEN sqlc.narg(email) IS NULL OR sqlc.narg(email) = email THEN is_email_verified ELSE false END
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: UpdateUserFrozen :one
+UPDATE users
+SET is_frozen = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+-- only verifies the address the code was sent to, a code sent before an email change doesn't verify the new one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING *;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1 LIMIT 1;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $2, password_changed_at = now()
+WHERE username = $1
+RETURNING *;
+
+-- name: RevokeUserTokens :one
+-- revokes every token issued to the user before tokens_revoked_at, which is taken from the clock that issues the tokens.
+-- The cutoff never moves back.
+UPDATE users
+SET tokens_revoked_at = GREATEST(tokens_revoked_at, sqlc.arg(tokens_revoked_at))
+WHERE username = sqlc.arg(username)
+RETURNING tokens_revoked_at;
+
+-- name: ListTokenRevocationsSince :many
+-- tokens issued to these users before tokens_revoked_at are no longer valid
+SELECT username, tokens_revoked_at FROM users
+WHERE tokens_revoked_at > sqlc.arg(since)
+ORDER BY tokens_revoked_at;
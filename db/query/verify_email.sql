@@ -0,0 +1,20 @@
+-- name: CreateVerifyEmail :one
+INSERT INTO verify_emails (
+  username, email, secret_code
+) VALUES (
+  $1, $2, $3
+) RETURNING *;
+
+-- name: GetVerifyEmail :one
+SELECT * FROM verify_emails
+WHERE id = $1 LIMIT 1;
+
+-- name: UseVerifyEmail :one
+-- marks the code as used, only succeeds once and before it expires
+UPDATE verify_emails
+SET is_used = true
+WHERE id = sqlc.arg(id)
+  AND secret_code = sqlc.arg(secret_code)
+  AND is_used = false
+  AND expired_at > now()
+RETURNING *;
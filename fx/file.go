@@ -0,0 +1,89 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rateFile is the format of a rates file:
+//
+//	{"as_of": "2023-09-01T00:00:00Z", "rates": {"USD/EUR": "0.92"}}
+type rateFile struct {
+	AsOf  time.Time         `json:"as_of"`
+	Rates map[string]string `json:"rates"`
+}
+
+// FileProvider quotes rates from a JSON file.
+// The file is read again whenever it is modified, so rates can be updated without a restart.
+type FileProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	current rateFile
+}
+
+// NewFileProvider creates a new FileProvider and loads the rates file.
+func NewFileProvider(path string) (RateProvider, error) {
+	provider := &FileProvider{path: path}
+
+	if _, err := provider.load(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// Quote returns the rate from the latest version of the file.
+func (provider *FileProvider) Quote(ctx context.Context, from string, to string) (Quote, error) {
+	current, err := provider.load()
+	if err != nil {
+		return Quote{}, err
+	}
+
+	rate, err := lookupRate(current.Rates, from, to)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{
+		From:     from,
+		To:       to,
+		Rate:     rate,
+		QuotedAt: current.AsOf,
+	}, nil
+}
+
+// load reads the file if it changed since the last read.
+func (provider *FileProvider) load() (rateFile, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	info, err := os.Stat(provider.path)
+	if err != nil {
+		return rateFile{}, fmt.Errorf("cannot stat rates file: %w", err)
+	}
+
+	if info.ModTime().Equal(provider.modTime) {
+		return provider.current, nil
+	}
+
+	data, err := os.ReadFile(provider.path)
+	if err != nil {
+		return rateFile{}, fmt.Errorf("cannot read rates file: %w", err)
+	}
+
+	var current rateFile
+	if err := json.Unmarshal(data, &current); err != nil {
+		return rateFile{}, fmt.Errorf("cannot parse rates file: %w", err)
+	}
+
+	provider.current = current
+	provider.modTime = info.ModTime()
+
+	return current, nil
+}
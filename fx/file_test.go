@@ -0,0 +1,52 @@
+package fx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeRatesFile(t *testing.T, path string, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	writeRatesFile(t, path, `{"as_of": "2023-09-01T00:00:00Z", "rates": {"USD/EUR": "0.92"}}`, time.Now().Add(-time.Hour))
+
+	provider, err := NewFileProvider(path)
+	require.NoError(t, err)
+
+	quote, err := provider.Quote(context.Background(), "USD", "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "0.92", quote.Rate)
+	require.Equal(t, time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), quote.QuotedAt.UTC())
+
+	_, err = provider.Quote(context.Background(), "USD", "CAD")
+	require.ErrorIs(t, err, ErrRateNotFound)
+
+	// a modified file is picked up without a restart
+	writeRatesFile(t, path, `{"as_of": "2023-09-02T00:00:00Z", "rates": {"USD/EUR": "0.93"}}`, time.Now())
+
+	quote, err = provider.Quote(context.Background(), "USD", "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "0.93", quote.Rate)
+}
+
+func TestFileProviderInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewFileProvider(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+
+	path := filepath.Join(dir, "rates.json")
+	writeRatesFile(t, path, `not json`, time.Now())
+
+	_, err = NewFileProvider(path)
+	require.Error(t, err)
+}
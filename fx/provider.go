@@ -0,0 +1,158 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ErrRateNotFound is returned when a provider has no rate for a currency pair.
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// ErrNoRateSource is returned for every cross-currency quote when no rates file is configured.
+var ErrNoRateSource = fmt.Errorf("%w: no rate source is configured", ErrRateNotFound)
+
+// ErrRateStale is returned when the latest rate is older than the maximum age.
+// It wraps ErrRateNotFound, since there is no rate a transfer may use.
+var ErrRateStale = fmt.Errorf("%w: rate is too old", ErrRateNotFound)
+
+// Quote is the exchange rate from one currency to another at a point in time.
+type Quote struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Rate     string    `json:"rate"` // decimal, e.g. "0.92" means 1 From = 0.92 To
+	QuotedAt time.Time `json:"quoted_at"`
+}
+
+// RateProvider is an interface that quotes exchange rates.
+type RateProvider interface {
+	// Quote returns the rate to convert an amount in the from currency to the to currency.
+	Quote(ctx context.Context, from string, to string) (Quote, error)
+}
+
+// NewProvider creates a FileProvider reading the given rates file, whose quotes are rejected once older than maxAge.
+// If path is empty, cross-currency quotes fail with ErrNoRateSource.
+func NewProvider(path string, maxAge time.Duration) (RateProvider, error) {
+	if path == "" {
+		return disabledProvider{}, nil
+	}
+
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("maximum rate age must be positive, got %s", maxAge)
+	}
+
+	provider, err := NewFileProvider(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMaxAgeProvider(provider, maxAge), nil
+}
+
+// MaxAgeProvider rejects the quotes of another provider that are older than a maximum age.
+type MaxAgeProvider struct {
+	provider RateProvider
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+// NewMaxAgeProvider creates a new MaxAgeProvider.
+func NewMaxAgeProvider(provider RateProvider, maxAge time.Duration) RateProvider {
+	return &MaxAgeProvider{
+		provider: provider,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+// Quote returns the quote of the wrapped provider if it is recent enough.
+func (provider *MaxAgeProvider) Quote(ctx context.Context, from string, to string) (Quote, error) {
+	quote, err := provider.provider.Quote(ctx, from, to)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	// a currency always converts to itself, however old the table
+	if from == to {
+		return quote, nil
+	}
+
+	if age := provider.now().Sub(quote.QuotedAt); age > provider.maxAge {
+		return Quote{}, fmt.Errorf("%w: %s was quoted %s ago", ErrRateStale, pair(from, to), age.Truncate(time.Second))
+	}
+
+	return quote, nil
+}
+
+// disabledProvider is used when no rate source is configured, so only same-currency quotes succeed.
+type disabledProvider struct{}
+
+// Quote returns a rate of 1 between the same currencies and ErrNoRateSource otherwise.
+func (disabledProvider) Quote(ctx context.Context, from string, to string) (Quote, error) {
+	if from != to {
+		return Quote{}, fmt.Errorf("%w for %s", ErrNoRateSource, pair(from, to))
+	}
+
+	return Quote{
+		From:     from,
+		To:       to,
+		Rate:     "1",
+		QuotedAt: time.Now(),
+	}, nil
+}
+
+// Convert converts an amount in the From currency to the To currency.
+// The result is rounded half away from zero to the smallest currency unit.
+func (q Quote) Convert(amount int64) (int64, error) {
+	rate, ok := new(big.Rat).SetString(q.Rate)
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q for %s/%s", q.Rate, q.From, q.To)
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+
+	quo, rem := new(big.Int).QuoRem(converted.Num(), converted.Denom(), new(big.Int))
+
+	// round half away from zero: |2 * rem| >= denom
+	if new(big.Int).Abs(new(big.Int).Mul(rem, big.NewInt(2))).Cmp(converted.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(converted.Sign())))
+	}
+
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("converted amount overflows: %s", quo)
+	}
+
+	return quo.Int64(), nil
+}
+
+// pair is the key of a rate table, e.g. "USD/EUR"
+func pair(from string, to string) string {
+	return from + "/" + to
+}
+
+// lookupRate finds the rate for a pair in a rate table.
+// If only the inverse pair is listed, its reciprocal is used.
+func lookupRate(rates map[string]string, from string, to string) (string, error) {
+	if from == to {
+		return "1", nil
+	}
+
+	if rate, ok := rates[pair(from, to)]; ok {
+		return rate, nil
+	}
+
+	if inverse, ok := rates[pair(to, from)]; ok {
+		r, ok := new(big.Rat).SetString(inverse)
+		if !ok || r.Sign() == 0 {
+			return "", fmt.Errorf("invalid rate %q for %s", inverse, pair(to, from))
+		}
+		return new(big.Rat).Inv(r).FloatString(rateDecimals), nil
+	}
+
+	return "", fmt.Errorf("%w for %s", ErrRateNotFound, pair(from, to))
+}
+
+// rateDecimals is the precision of rates derived from an inverse pair
+const rateDecimals = 8
@@ -0,0 +1,98 @@
+package fx
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteConvert(t *testing.T) {
+	testCases := []struct {
+		name   string
+		rate   string
+		amount int64
+		want   int64
+	}{
+		{name: "Identity", rate: "1", amount: 100, want: 100},
+		{name: "RoundDown", rate: "0.92", amount: 10, want: 9},
+		{name: "RoundHalfUp", rate: "0.25", amount: 2, want: 1},
+		{name: "Exact", rate: "1.36", amount: 250, want: 340},
+		{name: "Negative", rate: "0.25", amount: -2, want: -1},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			quote := Quote{From: "USD", To: "EUR", Rate: tc.rate}
+
+			got, err := quote.Convert(tc.amount)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestQuoteConvertInvalidRate(t *testing.T) {
+	quote := Quote{From: "USD", To: "EUR", Rate: "abc"}
+
+	_, err := quote.Convert(100)
+	require.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	// without a rates file only same-currency quotes succeed
+	provider, err := NewProvider("", time.Hour)
+	require.NoError(t, err)
+
+	quote, err := provider.Quote(context.Background(), "USD", "USD")
+	require.NoError(t, err)
+	require.Equal(t, "1", quote.Rate)
+
+	_, err = provider.Quote(context.Background(), "USD", "EUR")
+	require.ErrorIs(t, err, ErrNoRateSource)
+	require.ErrorIs(t, err, ErrRateNotFound)
+
+	_, err = NewProvider("missing.json", time.Hour)
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	writeRatesFile(t, path, `{"as_of": "2023-09-01T00:00:00Z", "rates": {"USD/EUR": "0.92"}}`, time.Now())
+
+	_, err = NewProvider(path, 0)
+	require.Error(t, err)
+
+	provider, err = NewProvider(path, time.Hour)
+	require.NoError(t, err)
+	require.IsType(t, &MaxAgeProvider{}, provider)
+}
+
+func TestMaxAgeProvider(t *testing.T) {
+	asOf := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	provider := &MaxAgeProvider{
+		provider: NewStaticProvider(map[string]string{"USD/EUR": "0.92"}, asOf),
+		maxAge:   time.Hour,
+		now:      func() time.Time { return asOf.Add(time.Hour) },
+	}
+
+	quote, err := provider.Quote(context.Background(), "USD", "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "0.92", quote.Rate)
+
+	provider.now = func() time.Time { return asOf.Add(time.Hour + time.Second) }
+
+	_, err = provider.Quote(context.Background(), "USD", "EUR")
+	require.ErrorIs(t, err, ErrRateStale)
+	require.ErrorIs(t, err, ErrRateNotFound)
+
+	// converting to the same currency does not depend on the table
+	quote, err = provider.Quote(context.Background(), "USD", "USD")
+	require.NoError(t, err)
+	require.Equal(t, "1", quote.Rate)
+
+	_, err = provider.Quote(context.Background(), "USD", "GBP")
+	require.ErrorIs(t, err, ErrRateNotFound)
+}
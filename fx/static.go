@@ -0,0 +1,36 @@
+package fx
+
+import (
+	"context"
+	"time"
+)
+
+// StaticProvider quotes rates from a fixed table.
+type StaticProvider struct {
+	rates map[string]string
+	asOf  time.Time
+}
+
+// NewStaticProvider creates a new StaticProvider.
+// The rates are keyed by pair, e.g. "USD/EUR", and asOf is the time the table was published.
+func NewStaticProvider(rates map[string]string, asOf time.Time) RateProvider {
+	return &StaticProvider{
+		rates: rates,
+		asOf:  asOf,
+	}
+}
+
+// Quote returns the rate from the table.
+func (provider *StaticProvider) Quote(ctx context.Context, from string, to string) (Quote, error) {
+	rate, err := lookupRate(provider.rates, from, to)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{
+		From:     from,
+		To:       to,
+		Rate:     rate,
+		QuotedAt: provider.asOf,
+	}, nil
+}
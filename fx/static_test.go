@@ -0,0 +1,33 @@
+package fx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticProvider(t *testing.T) {
+	asOf := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	provider := NewStaticProvider(map[string]string{"USD/EUR": "0.92"}, asOf)
+
+	quote, err := provider.Quote(context.Background(), "USD", "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "USD", quote.From)
+	require.Equal(t, "EUR", quote.To)
+	require.Equal(t, "0.92", quote.Rate)
+	require.Equal(t, asOf, quote.QuotedAt)
+
+	// the inverse pair is derived from the listed one
+	quote, err = provider.Quote(context.Background(), "EUR", "USD")
+	require.NoError(t, err)
+	require.Equal(t, "1.08695652", quote.Rate)
+
+	quote, err = provider.Quote(context.Background(), "CAD", "CAD")
+	require.NoError(t, err)
+	require.Equal(t, "1", quote.Rate)
+
+	_, err = provider.Quote(context.Background(), "USD", "GBP")
+	require.ErrorIs(t, err, ErrRateNotFound)
+}
@@ -0,0 +1,104 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/auth"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authorizationHeader = "authorization"
+	authorizationBearer = auth.AuthorizationTypeBearer
+)
+
+// payloadKey is the context key of the token payload set by the auth interceptor
+type payloadKey struct{}
+
+// scopeKey is the context key of the auth.Scope set by the auth interceptor
+type scopeKey struct{}
+
+// publicMethods can be called without a token
+var publicMethods = map[string]bool{
+	pb.SimpleBank_CreateUser_FullMethodName:  true,
+	pb.SimpleBank_LoginUser_FullMethodName:   true,
+	pb.SimpleBank_VerifyEmail_FullMethodName: true,
+}
+
+// accessPolicy lists the roles allowed on each authenticated method and the scope of their access, like the one of the HTTP API.
+// Methods missing from the policy are denied to everyone.
+var accessPolicy = auth.Policy{
+	pb.SimpleBank_CreateAccount_FullMethodName:  {util.DepositorRole: auth.ScopeOwn},
+	pb.SimpleBank_GetAccount_FullMethodName:     {util.DepositorRole: auth.ScopeOwn, util.BankerRole: auth.ScopeAny},
+	pb.SimpleBank_ListAccounts_FullMethodName:   {util.DepositorRole: auth.ScopeOwn},
+	pb.SimpleBank_CreateTransfer_FullMethodName: {util.DepositorRole: auth.ScopeOwn},
+}
+
+// AuthInterceptor is the gRPC equivalent of the authMiddleware and authorizeMiddleware of the HTTP API.
+// It verifies the bearer token, rejects revoked tokens and checks the role against accessPolicy.
+func (server *Server) AuthInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	payload, err := server.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger.SetUsername(ctx, payload.Username)
+
+	scope, err := accessPolicy.Authorize(info.FullMethod, payload.Role)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	ctx = context.WithValue(ctx, payloadKey{}, payload)
+	ctx = context.WithValue(ctx, scopeKey{}, scope)
+	return handler(ctx, req)
+}
+
+// authenticate verifies the bearer token in the request metadata the same way the HTTP API does.
+func (server *Server) authenticate(ctx context.Context) (*token.Payload, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, statusError(ctx, apperr.New(apperr.CodeUnauthenticated, "missing metadata"))
+	}
+
+	var authorization string
+	if values := md.Get(authorizationHeader); len(values) > 0 {
+		authorization = values[0]
+	}
+
+	payload, err := auth.Authenticate(ctx, server.tokenMaker, server.revoker, authorization)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return payload, nil
+}
+
+// authPayload returns the token payload set by AuthInterceptor.
+func authPayload(ctx context.Context) (*token.Payload, error) {
+	payload, ok := ctx.Value(payloadKey{}).(*token.Payload)
+	if !ok {
+		return nil, statusError(ctx, apperr.New(apperr.CodeUnauthenticated, "missing token payload"))
+	}
+	return payload, nil
+}
+
+// canAccess reports whether the authenticated user may access a resource of the owner with this method.
+func canAccess(ctx context.Context, payload *token.Payload, owner string) bool {
+	scope, _ := ctx.Value(scopeKey{}).(auth.Scope)
+	return scope.Allows(payload.Username, owner)
+}
@@ -0,0 +1,167 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptor(t *testing.T) {
+	username := util.RandomOwner()
+
+	testCases := []struct {
+		name     string
+		method   string
+		buildCtx func(t *testing.T, server *Server) context.Context
+		checker  func(t *testing.T, called bool, err error)
+	}{
+		{
+			name:   "OK",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				ctx, _ := newContextWithBearerToken(t, server.tokenMaker, username, util.DepositorRole, time.Minute)
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.NoError(t, err)
+				require.True(t, called)
+			},
+		},
+		{
+			name:   "Public Method",
+			method: pb.SimpleBank_LoginUser_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				return context.Background()
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.NoError(t, err)
+				require.True(t, called)
+			},
+		},
+		{
+			name:   "No Authorization",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				return context.Background()
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Expired Token",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				ctx, _ := newContextWithBearerToken(t, server.tokenMaker, username, util.DepositorRole, -time.Minute)
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Refresh Token",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				refreshToken, _, err := server.tokenMaker.CreateToken(username, util.DepositorRole, token.TokenTypeRefreshToken, time.Minute)
+				require.NoError(t, err)
+
+				md := metadata.Pairs(authorizationHeader, fmt.Sprintf("%s %s", authorizationBearer, refreshToken))
+				return metadata.NewIncomingContext(context.Background(), md)
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Revoked Token",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				// Revoked through the HTTP API, which shares the revoker
+				ctx, payload := newContextWithBearerToken(t, server.tokenMaker, username, util.DepositorRole, time.Minute)
+				server.revoker.Revoke(payload)
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Password Changed",
+			method: pb.SimpleBank_GetAccount_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				ctx, _ := newContextWithBearerToken(t, server.tokenMaker, username, util.DepositorRole, time.Minute)
+				server.revoker.RevokeIssuedBefore(username, time.Now())
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Role Not Allowed",
+			method: pb.SimpleBank_CreateTransfer_FullMethodName,
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				ctx, _ := newContextWithBearerToken(t, server.tokenMaker, username, util.BankerRole, time.Minute)
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+				require.False(t, called)
+			},
+		},
+		{
+			name:   "Unknown Method",
+			method: "/pb.SimpleBank/Unknown",
+			buildCtx: func(t *testing.T, server *Server) context.Context {
+				ctx, _ := newContextWithBearerToken(t, server.tokenMaker, username, util.AdminRole, time.Minute)
+				return ctx
+			},
+			checker: func(t *testing.T, called bool, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+				require.False(t, called)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+			server := newTestServer(t, store)
+			ctx := tc.buildCtx(t, server)
+
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			}
+
+			_, err := server.AuthInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			tc.checker(t, called, err)
+		})
+	}
+}
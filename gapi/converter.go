@@ -0,0 +1,54 @@
+package gapi
+
+import (
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// convertUser strips the hashed password from the user
+func convertUser(user db.User) *pb.User {
+	return &pb.User{
+		Username:          user.Username,
+		FullName:          user.FullName,
+		Email:             user.Email,
+		Role:              user.Role,
+		IsFrozen:          user.IsFrozen,
+		IsEmailVerified:   user.IsEmailVerified,
+		PasswordChangedAt: timestamppb.New(user.PasswordChangedAt),
+		CreatedAt:         timestamppb.New(user.CreatedAt),
+	}
+}
+
+func convertAccount(account db.Account) *pb.Account {
+	return &pb.Account{
+		Id:        account.ID,
+		Owner:     account.Owner,
+		Balance:   account.Balance,
+		Currency:  account.Currency,
+		CreatedAt: timestamppb.New(account.CreatedAt),
+	}
+}
+
+func convertTransfer(transfer db.Transfer) *pb.Transfer {
+	return &pb.Transfer{
+		Id:            transfer.ID,
+		FromAccountId: transfer.FromAccountID,
+		ToAccountId:   transfer.ToAccountID,
+		Amount:        transfer.Amount,
+		ToAmount:      transfer.ToAmount,
+		ExchangeRate:  transfer.ExchangeRate,
+		RateQuotedAt:  timestamppb.New(transfer.RateQuotedAt),
+		CreatedAt:     timestamppb.New(transfer.CreatedAt),
+	}
+}
+
+func convertEntry(entry db.Entry) *pb.Entry {
+	return &pb.Entry{
+		Id:        entry.ID,
+		AccountId: entry.AccountID,
+		Amount:    entry.Amount,
+		Reference: entry.Reference,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+	}
+}
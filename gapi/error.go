@@ -0,0 +1,90 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/logger"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo detail carrying the stable error code
+const errorDomain = "simplebank"
+
+// grpcCodes maps every error code to its gRPC status code, unknown codes are internal errors
+var grpcCodes = map[apperr.Code]codes.Code{
+	apperr.CodeValidationFailed:     codes.InvalidArgument,
+	apperr.CodeUnauthenticated:      codes.Unauthenticated,
+	apperr.CodeForbidden:            codes.PermissionDenied,
+	apperr.CodeEmailNotVerified:     codes.PermissionDenied,
+	apperr.CodeTooManyAttempts:      codes.ResourceExhausted,
+	apperr.CodeNotFound:             codes.NotFound,
+	apperr.CodeAlreadyExists:        codes.AlreadyExists,
+	apperr.CodeIdempotencyKeyReused: codes.AlreadyExists,
+	apperr.CodeInsufficientFunds:    codes.FailedPrecondition,
+	apperr.CodeCurrencyMismatch:     codes.FailedPrecondition,
+	apperr.CodeRateNotFound:         codes.FailedPrecondition,
+	apperr.CodeInternal:             codes.Internal,
+}
+
+// statusError converts err into a status error, the gRPC counterpart of the HTTP error response.
+// The stable code and the request ID are sent in an ErrorInfo detail, the field violations in a BadRequest detail.
+// The client only gets the message, so the cause of internal errors is logged here.
+func statusError(ctx context.Context, err error) error {
+	appErr := apperr.From(err)
+
+	code, ok := grpcCodes[appErr.Code]
+	if !ok {
+		code = codes.Internal
+	}
+
+	if code == codes.Internal {
+		logger.FromContext(ctx).Error().Err(err).Msg("internal error")
+	}
+
+	st, detailsErr := status.New(code, appErr.Message).WithDetails(&errdetails.ErrorInfo{
+		Reason:   string(appErr.Code),
+		Domain:   errorDomain,
+		Metadata: map[string]string{"request_id": logger.RequestID(ctx)},
+	})
+	if detailsErr != nil {
+		return status.Error(code, appErr.Message)
+	}
+
+	if len(appErr.Violations) > 0 {
+		if withViolations, err := st.WithDetails(badRequest(appErr.Violations)); err == nil {
+			st = withViolations
+		}
+	}
+
+	return st.Err()
+}
+
+// fieldViolation describes why a request field is invalid
+func fieldViolation(field string, err error) apperr.FieldViolation {
+	return apperr.FieldViolation{
+		Field:   field,
+		Message: err.Error(),
+	}
+}
+
+// invalidArgumentError returns an InvalidArgument status carrying the field violations as details
+func invalidArgumentError(ctx context.Context, violations []apperr.FieldViolation) error {
+	appErr := apperr.New(apperr.CodeValidationFailed, "invalid parameters")
+	appErr.Violations = violations
+	return statusError(ctx, appErr)
+}
+
+// badRequest converts the field violations into a BadRequest detail
+func badRequest(violations []apperr.FieldViolation) *errdetails.BadRequest {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Message,
+		})
+	}
+	return badRequest
+}
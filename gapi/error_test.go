@@ -0,0 +1,89 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatusError(t *testing.T) {
+	ctx := logger.WithRequestID(context.Background(), "req-123")
+
+	testCases := []struct {
+		name    string
+		err     error
+		checker func(t *testing.T, st *status.Status)
+	}{
+		{
+			name: "NotFound",
+			err:  apperr.New(apperr.CodeNotFound, "account not found"),
+			checker: func(t *testing.T, st *status.Status) {
+				require.Equal(t, codes.NotFound, st.Code())
+				require.Equal(t, "account not found", st.Message())
+
+				info := requireErrorInfo(t, st)
+				require.Equal(t, string(apperr.CodeNotFound), info.GetReason())
+				require.Equal(t, "req-123", info.GetMetadata()["request_id"])
+			},
+		},
+		{
+			name: "ValidationFailed",
+			err:  apperr.InvalidField("amount", "must be greater than 0"),
+			checker: func(t *testing.T, st *status.Status) {
+				require.Equal(t, codes.InvalidArgument, st.Code())
+
+				var badRequest *errdetails.BadRequest
+				for _, detail := range st.Details() {
+					if d, ok := detail.(*errdetails.BadRequest); ok {
+						badRequest = d
+					}
+				}
+				require.NotNil(t, badRequest)
+				require.Len(t, badRequest.GetFieldViolations(), 1)
+				require.Equal(t, "amount", badRequest.GetFieldViolations()[0].GetField())
+			},
+		},
+		{
+			name: "InternalHidesCause",
+			err:  sql.ErrConnDone,
+			checker: func(t *testing.T, st *status.Status) {
+				require.Equal(t, codes.Internal, st.Code())
+				require.NotContains(t, st.Message(), sql.ErrConnDone.Error())
+				require.Equal(t, string(apperr.CodeInternal), requireErrorInfo(t, st).GetReason())
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			st, ok := status.FromError(statusError(ctx, tc.err))
+			require.True(t, ok)
+			tc.checker(t, st)
+		})
+	}
+}
+
+func requireErrorInfo(t *testing.T, st *status.Status) *errdetails.ErrorInfo {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	require.FailNow(t, "status has no ErrorInfo detail")
+	return nil
+}
+
+func requireErrorReason(t *testing.T, err error, code apperr.Code) {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, string(code), requireErrorInfo(t, st).GetReason())
+}
@@ -0,0 +1,60 @@
+package gapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcLogger is the gRPC counterpart of the HTTP request logger: it assigns every call a request ID,
+// carries the request logger in the context and logs one JSON line per call.
+// It must run before AuthInterceptor so rejected calls are logged too.
+func GrpcLogger(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(logger.RequestIDHeader)); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if !logger.ValidRequestID(requestID) {
+		requestID = logger.NewRequestID()
+	}
+
+	ctx = logger.WithRequestID(ctx, requestID)
+	// Fails only outside a real gRPC call, e.g. in tests
+	_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(logger.RequestIDHeader), requestID))
+
+	result, err := handler(ctx, req)
+
+	statusCode := status.Code(err)
+
+	l := logger.FromContext(ctx)
+	var event *zerolog.Event
+	switch statusCode {
+	case codes.OK:
+		event = l.Info()
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		event = l.Error().Err(err)
+	default:
+		event = l.Warn().Err(err)
+	}
+
+	// Requests are never logged, they may hold passwords
+	event.Str("protocol", "grpc").
+		Str("method", info.FullMethod).
+		Int("status_code", int(statusCode)).
+		Str("status_text", statusCode.String()).
+		Dur("duration", time.Since(start)).
+		Msg("received a gRPC request")
+
+	return result, err
+}
@@ -0,0 +1,83 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/auth"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+	}
+
+	// Tests distributing tasks set a mock distributor on the server
+	server, err := NewServer(config, store, nil, auth.NewRevoker(store, config.RefreshTokenDuration))
+	require.NoError(t, err)
+
+	return server
+}
+
+// newContextWithBearerToken returns an incoming context carrying an access token, as sent by a client
+func newContextWithBearerToken(t *testing.T, tokenMaker token.TokenMaker, username string, role string, duration time.Duration) (context.Context, *token.Payload) {
+	accessToken, payload, err := tokenMaker.CreateToken(username, role, token.TokenTypeAccessToken, duration)
+	require.NoError(t, err)
+
+	md := metadata.MD{
+		authorizationHeader: []string{
+			fmt.Sprintf("%s %s", authorizationBearer, accessToken),
+		},
+	}
+
+	return metadata.NewIncomingContext(context.Background(), md), payload
+}
+
+// newContextWithPayload returns a context as the handlers of the method get it from AuthInterceptor
+func newContextWithPayload(method string, username string, role string) context.Context {
+	payload := &token.Payload{
+		Username: username,
+		Role:     role,
+	}
+
+	ctx := context.WithValue(context.Background(), payloadKey{}, payload)
+	if scope, err := accessPolicy.Authorize(method, role); err == nil {
+		ctx = context.WithValue(ctx, scopeKey{}, scope)
+	}
+	return ctx
+}
+
+func randomUser(t *testing.T) (user db.User, password string) {
+	password = util.RandomString(6)
+	hashedPassword, err := util.HashPassword(password)
+	require.NoError(t, err)
+
+	user = db.User{
+		Username:        util.RandomOwner(),
+		FullName:        util.RandomOwner(),
+		Email:           util.RandomEmail(),
+		HashedPassword:  hashedPassword,
+		Role:            util.DepositorRole,
+		IsEmailVerified: true,
+	}
+
+	return
+}
+
+func randomAccount(owner string) db.Account {
+	return db.Account{
+		ID:       util.RandomInt(1, 1000),
+		Owner:    owner,
+		Balance:  util.RandomMoney(),
+		Currency: util.RandomCurrency(),
+	}
+}
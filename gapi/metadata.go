@@ -0,0 +1,52 @@
+package gapi
+
+import (
+	"context"
+	"net"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	userAgentHeader = "user-agent"
+)
+
+// Metadata describes the client of a request, it is stored with the session at login and in the audit log
+type Metadata struct {
+	UserAgent string
+	ClientIP  string
+}
+
+func (server *Server) extractMetadata(ctx context.Context) *Metadata {
+	mtdt := &Metadata{}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgents := md.Get(userAgentHeader); len(userAgents) > 0 {
+			mtdt.UserAgent = userAgents[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		mtdt.ClientIP = p.Addr.String()
+
+		// keep the IP only, like the HTTP API does
+		if host, _, err := net.SplitHostPort(mtdt.ClientIP); err == nil {
+			mtdt.ClientIP = host
+		}
+	}
+
+	return mtdt
+}
+
+// auditParams describes the client of the request, actor is the user performing the operation
+func (server *Server) auditParams(ctx context.Context, actor string) db.AuditParams {
+	mtdt := server.extractMetadata(ctx)
+	return db.AuditParams{
+		Actor:     actor,
+		ClientIP:  mtdt.ClientIP,
+		UserAgent: mtdt.UserAgent,
+	}
+}
@@ -0,0 +1,45 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+)
+
+// Authorization: A logged-in user can only create an account for himself.
+func (server *Server) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+	payload, err := authPayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCurrency(req.GetCurrency()); err != nil {
+		return nil, invalidArgumentError(ctx, []apperr.FieldViolation{fieldViolation("currency", err)})
+	}
+
+	account, err := server.store.CreateAccountTx(ctx, db.CreateAccountTxParams{
+		CreateAccountParams: db.CreateAccountParams{
+			Owner:    payload.Username,
+			Balance:  0,
+			Currency: req.GetCurrency(),
+		},
+		Audit: server.auditParams(ctx, payload.Username),
+	})
+	if err != nil {
+		switch db.ErrorCode(err) {
+		case db.UniqueViolation:
+			err = apperr.Wrap(err, apperr.CodeAlreadyExists, fmt.Sprintf("user already has a %s account", req.GetCurrency()))
+		case db.ForeignKeyViolation:
+			err = apperr.Wrap(err, apperr.CodeNotFound, "owner not found")
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	rsp := &pb.CreateAccountResponse{
+		Account: convertAccount(account),
+	}
+	return rsp, nil
+}
@@ -0,0 +1,75 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/transfer"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Authorization: a logged-in user can only send money from his own account.
+func (server *Server) CreateTransfer(ctx context.Context, req *pb.CreateTransferRequest) (*pb.CreateTransferResponse, error) {
+	payload, err := authPayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if violations := validateCreateTransferRequest(req); violations != nil {
+		return nil, invalidArgumentError(ctx, violations)
+	}
+
+	// Retries with the same idempotency key get the original result back, whichever API they go through
+	result, err := server.transfers.Create(ctx, transfer.CreateParams{
+		Request: transfer.Request{
+			FromAccountID: req.GetFromAccountId(),
+			ToAccountID:   req.GetToAccountId(),
+			Amount:        req.GetAmount(),
+			Currency:      req.GetCurrency(),
+		},
+		Username:       payload.Username,
+		IdempotencyKey: req.GetIdempotencyKey(),
+		Audit:          server.auditParams(ctx, payload.Username),
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	rsp := &pb.CreateTransferResponse{
+		Transfer:    convertTransfer(result.Transfer),
+		FromAccount: convertAccount(result.FromAccount),
+		ToAccount:   convertAccount(result.ToAccount),
+		FromEntry:   convertEntry(result.FromEntry),
+		ToEntry:     convertEntry(result.ToEntry),
+		Replayed:    result.Replayed,
+	}
+	return rsp, nil
+}
+
+func validateCreateTransferRequest(req *pb.CreateTransferRequest) (violations []apperr.FieldViolation) {
+	if err := validateID(req.GetFromAccountId()); err != nil {
+		violations = append(violations, fieldViolation("from_account_id", err))
+	}
+
+	if err := validateID(req.GetToAccountId()); err != nil {
+		violations = append(violations, fieldViolation("to_account_id", err))
+	}
+
+	if req.GetAmount() <= 0 {
+		violations = append(violations, fieldViolation("amount", errors.New("must be greater than 0")))
+	}
+
+	if err := validateCurrency(req.GetCurrency()); err != nil {
+		violations = append(violations, fieldViolation("currency", err))
+	}
+
+	if len(req.GetIdempotencyKey()) > maxIdempotencyKeyLength {
+		violations = append(violations, fieldViolation("idempotency_key", fmt.Errorf("must be at most %d characters", maxIdempotencyKeyLength)))
+	}
+
+	return violations
+}
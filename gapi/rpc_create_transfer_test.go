@@ -0,0 +1,272 @@
+package gapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/transfer"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateTransferRPC(t *testing.T) {
+	amount := int64(10)
+
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account3 := randomAccount(user2.Username)
+
+	// transfers to the same account are rejected
+	account2.ID = account1.ID + 1
+	account3.ID = account1.ID + 2
+
+	account1.Currency = util.USD
+	account2.Currency = util.USD
+	account3.Currency = util.EUR
+
+	ratesAsOf := time.Now().Truncate(time.Second)
+
+	testCases := []struct {
+		name       string
+		req        *pb.CreateTransferRequest
+		rates      fx.RateProvider
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, rsp *pb.CreateTransferResponse, err error)
+	}{
+		{
+			name: "OK",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account2.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+
+				arg := db.TransferTxParams{
+					FromAccountID: account1.ID,
+					ToAccountID:   account2.ID,
+					Amount:        amount,
+					Audit:         &db.AuditParams{Actor: user1.Username},
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(db.TransferTxResult{
+					Transfer: db.Transfer{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount},
+				}, nil)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, amount, rsp.GetTransfer().GetAmount())
+				require.False(t, rsp.GetReplayed())
+			},
+		},
+		{
+			name: "Cross Currency",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account3.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			rates: fx.NewStaticProvider(map[string]string{"USD/EUR": "0.5"}, ratesAsOf),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+
+				arg := db.ExchangeTransferTxParams{
+					TransferTxParams: db.TransferTxParams{
+						FromAccountID: account1.ID,
+						ToAccountID:   account3.ID,
+						Amount:        amount,
+						Audit:         &db.AuditParams{Actor: user1.Username},
+					},
+					ToAmount:     amount / 2,
+					ExchangeRate: "0.5",
+					RateQuotedAt: ratesAsOf,
+				}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(db.TransferTxResult{}, nil)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Exchange Rate Not Found",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account3.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			rates: fx.NewStaticProvider(map[string]string{}, ratesAsOf),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account3.ID)).Times(1).Return(account3, nil)
+				store.EXPECT().ExchangeTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+			},
+		},
+		{
+			name: "Insufficient Funds",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account2.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrInsufficientFunds)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+			},
+		},
+		{
+			name: "Idempotency Key Reused",
+			req: &pb.CreateTransferRequest{
+				FromAccountId:  account1.ID,
+				ToAccountId:    account2.ID,
+				Amount:         amount,
+				Currency:       util.USD,
+				IdempotencyKey: util.RandomString(16),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{RequestHash: "other"}, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.AlreadyExists, status.Code(err))
+			},
+		},
+		{
+			name: "Same Account",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account1.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name: "Currency Mismatch",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account2.ID,
+				Amount:        amount,
+				Currency:      util.EUR,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+				requireErrorReason(t, err, apperr.CodeCurrencyMismatch)
+			},
+		},
+		{
+			name: "Not Owner",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account2.ID,
+				ToAccountId:   account1.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name: "Email Not Verified",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account2.ID,
+				Amount:        amount,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				unverifiedUser := user1
+				unverifiedUser.IsEmailVerified = false
+
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user1.Username)).Times(1).Return(unverifiedUser, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+				requireErrorReason(t, err, apperr.CodeEmailNotVerified)
+			},
+		},
+		{
+			name: "Invalid Amount",
+			req: &pb.CreateTransferRequest{
+				FromAccountId: account1.ID,
+				ToAccountId:   account2.ID,
+				Amount:        -1,
+				Currency:      util.USD,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			// The GetUser stubs of a test case are defined first, so they take precedence over the verified user
+			tc.buildStubs(store)
+			store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user1.Username)).AnyTimes().Return(user1, nil)
+
+			server := newTestServer(t, store)
+			if tc.rates != nil {
+				server.transfers = transfer.NewService(store, tc.rates)
+			}
+
+			ctx := newContextWithPayload(pb.SimpleBank_CreateTransfer_FullMethodName, user1.Username, util.DepositorRole)
+			rsp, err := server.CreateTransfer(ctx, tc.req)
+			tc.checker(t, rsp, err)
+		})
+	}
+}
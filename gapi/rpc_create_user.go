@@ -0,0 +1,86 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
+)
+
+func (server *Server) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if violations := validateCreateUserRequest(req); violations != nil {
+		return nil, invalidArgumentError(ctx, violations)
+	}
+
+	hashedPassword, err := util.HashPassword(req.GetPassword())
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	secretCode, err := util.NewSecretCode()
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	// The new user is the actor of its own creation
+	// The user is only created if the verification email could be enqueued
+	result, err := server.store.CreateUserTx(ctx, db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       req.GetUsername(),
+			HashedPassword: hashedPassword,
+			FullName:       req.GetFullName(),
+			Email:          req.GetEmail(),
+		},
+		SecretCode: secretCode,
+		Audit:      server.auditParams(ctx, req.GetUsername()),
+		AfterCreate: func(q db.Querier, user db.User, verifyEmail db.VerifyEmail) error {
+			return server.distributeVerifyEmail(ctx, q, verifyEmail)
+		},
+	})
+	if err != nil {
+		if db.ErrorCode(err) == db.UniqueViolation {
+			err = apperr.Wrap(err, apperr.CodeAlreadyExists, "username or email already exists")
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	rsp := &pb.CreateUserResponse{
+		User: convertUser(result.User),
+	}
+	return rsp, nil
+}
+
+// distributeVerifyEmail enqueues the task sending the verification link to a user with q, the queries
+// of the user transaction, so the task is committed with the code it sends and dropped if the user is rolled back.
+func (server *Server) distributeVerifyEmail(ctx context.Context, q db.Querier, verifyEmail db.VerifyEmail) error {
+	payload := &worker.PayloadSendVerifyEmail{
+		VerifyEmailID: verifyEmail.ID,
+	}
+	return server.taskDistributor.DistributeTaskSendVerifyEmail(ctx, payload,
+		worker.Queue(worker.QueueCritical),
+		worker.Tx(q),
+	)
+}
+
+func validateCreateUserRequest(req *pb.CreateUserRequest) (violations []apperr.FieldViolation) {
+	if err := validateUsername(req.GetUsername()); err != nil {
+		violations = append(violations, fieldViolation("username", err))
+	}
+
+	if err := validatePassword(req.GetPassword()); err != nil {
+		violations = append(violations, fieldViolation("password", err))
+	}
+
+	if err := validateFullName(req.GetFullName()); err != nil {
+		violations = append(violations, fieldViolation("full_name", err))
+	}
+
+	if err := validateEmail(req.GetEmail()); err != nil {
+		violations = append(violations, fieldViolation("email", err))
+	}
+
+	return violations
+}
@@ -0,0 +1,39 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+)
+
+// Authorization: A logged-in user can only get his own account, bankers can get any account.
+func (server *Server) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.GetAccountResponse, error) {
+	payload, err := authPayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateID(req.GetId()); err != nil {
+		return nil, invalidArgumentError(ctx, []apperr.FieldViolation{fieldViolation("id", err)})
+	}
+
+	account, err := server.store.GetAccount(ctx, req.GetId())
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, "account not found")
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	if !canAccess(ctx, payload, account.Owner) {
+		return nil, statusError(ctx, apperr.New(apperr.CodeForbidden, "account doesn't belong to the authenticated user"))
+	}
+
+	rsp := &pb.GetAccountResponse{
+		Account: convertAccount(account),
+	}
+	return rsp, nil
+}
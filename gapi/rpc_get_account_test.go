@@ -0,0 +1,129 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetAccountRPC(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+
+	testCases := []struct {
+		name       string
+		req        *pb.GetAccountRequest
+		buildCtx   func() context.Context
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, rsp *pb.GetAccountResponse, err error)
+	}{
+		{
+			name: "OK",
+			req:  &pb.GetAccountRequest{Id: account.ID},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, user.Username, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, account.ID, rsp.GetAccount().GetId())
+				require.Equal(t, account.Owner, rsp.GetAccount().GetOwner())
+				require.Equal(t, account.Balance, rsp.GetAccount().GetBalance())
+				require.Equal(t, account.Currency, rsp.GetAccount().GetCurrency())
+			},
+		},
+		{
+			name: "Banker",
+			req:  &pb.GetAccountRequest{Id: account.ID},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, util.RandomOwner(), util.BankerRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, account.ID, rsp.GetAccount().GetId())
+			},
+		},
+		{
+			name: "Permission Denied",
+			req:  &pb.GetAccountRequest{Id: account.ID},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, util.RandomOwner(), util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name: "Not Found",
+			req:  &pb.GetAccountRequest{Id: account.ID},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, user.Username, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+		{
+			name: "Internal Error",
+			req:  &pb.GetAccountRequest{Id: account.ID},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, user.Username, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+		{
+			name: "Invalid ID",
+			req:  &pb.GetAccountRequest{Id: 0},
+			buildCtx: func() context.Context {
+				return newContextWithPayload(pb.SimpleBank_GetAccount_FullMethodName, user.Username, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			rsp, err := server.GetAccount(tc.buildCtx(), tc.req)
+			tc.checker(t, rsp, err)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/page"
+	"github.com/pawpaw2022/simplebank/pb"
+)
+
+// Authorization: A logged-in user can only list his own accounts.
+func (server *Server) ListAccounts(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsResponse, error) {
+	payload, err := authPayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []apperr.FieldViolation
+	if req.GetPageSize() < 5 || req.GetPageSize() > 10 {
+		violations = append(violations, fieldViolation("page_size", fmt.Errorf("must be between %d and %d", 5, 10)))
+	}
+
+	// The token is the cursor of the HTTP API, so clients can page through either API
+	cursor, err := page.DecodeCursor(req.GetPageToken())
+	if err != nil {
+		violations = append(violations, fieldViolation("page_token", err))
+	}
+
+	if violations != nil {
+		return nil, invalidArgumentError(ctx, violations)
+	}
+
+	// Fetch one more row than the page size to know if there is a next page
+	accounts, err := server.store.ListAccountsAfter(ctx, db.ListAccountsAfterParams{
+		Owner:          payload.Username,
+		AfterCreatedAt: cursor.CreatedAt,
+		AfterID:        cursor.ID,
+		Limit:          req.GetPageSize() + 1,
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	accounts, nextPageToken := page.Next(accounts, req.GetPageSize(), func(account db.Account) page.Cursor {
+		return page.Cursor{CreatedAt: account.CreatedAt, ID: account.ID}
+	})
+
+	rsp := &pb.ListAccountsResponse{NextPageToken: nextPageToken}
+	for _, account := range accounts {
+		rsp.Accounts = append(rsp.Accounts, convertAccount(account))
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,136 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/util"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (server *Server) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
+	if violations := validateLoginUserRequest(req); violations != nil {
+		return nil, invalidArgumentError(ctx, violations)
+	}
+
+	// Throttle the attempts on the username and from the client IP
+	attempt, wait, err := server.loginGuard.Reserve(ctx, req.GetUsername(), server.extractMetadata(ctx).ClientIP)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	if wait > 0 {
+		seconds := int64(math.Ceil(wait.Seconds()))
+		return nil, server.loginFailed(ctx, req.GetUsername(), apperr.Newf(apperr.CodeTooManyAttempts, "too many failed login attempts, try again in %d seconds", seconds))
+	}
+
+	user, err := server.store.GetUser(ctx, req.GetUsername())
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return nil, server.loginFailed(ctx, req.GetUsername(), apperr.Wrap(err, apperr.CodeNotFound, "user not found"))
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	if err := util.ComparePassword(user.HashedPassword, req.GetPassword()); err != nil {
+		return nil, server.loginFailed(ctx, req.GetUsername(), apperr.Wrap(err, apperr.CodeUnauthenticated, "incorrect password"))
+	}
+
+	// Frozen users cannot log in, the right password doesn't count toward the lockout
+	if user.IsFrozen {
+		err = apperr.New(apperr.CodeForbidden, "user is frozen")
+		if releaseErr := server.loginGuard.Release(ctx, attempt); releaseErr != nil {
+			err = releaseErr
+		}
+		return nil, server.loginFailed(ctx, req.GetUsername(), err)
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		token.TokenTypeAccessToken,
+		server.config.AccessTokenDuration,
+	)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	// The refresh token payload ID doubles as the session ID
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.Role,
+		token.TokenTypeRefreshToken,
+		server.config.RefreshTokenDuration,
+	)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	mtdt := server.extractMetadata(ctx)
+	session, err := server.store.CreateSessionTx(ctx, db.CreateSessionTxParams{
+		CreateSessionParams: db.CreateSessionParams{
+			ID:           refreshPayload.ID,
+			Username:     user.Username,
+			RefreshToken: refreshToken,
+			UserAgent:    mtdt.UserAgent,
+			ClientIp:     mtdt.ClientIP,
+			IsBlocked:    false,
+			ExpiresAt:    refreshPayload.ExpireAt,
+		},
+		LoginAttemptID: attempt.ID,
+		Audit: db.AuditParams{
+			Actor:     user.Username,
+			ClientIP:  mtdt.ClientIP,
+			UserAgent: mtdt.UserAgent,
+		},
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	rsp := &pb.LoginUserResponse{
+		User:                  convertUser(user),
+		SessionId:             session.ID.String(),
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(accessPayload.ExpireAt),
+		RefreshTokenExpiresAt: timestamppb.New(refreshPayload.ExpireAt),
+	}
+	return rsp, nil
+}
+
+// loginFailed records the failed login attempt in the audit log and returns the status error of err.
+// The username is recorded as sent, it may not exist.
+func (server *Server) loginFailed(ctx context.Context, username string, err error) error {
+	mtdt := server.extractMetadata(ctx)
+	_, auditErr := server.store.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Actor:      username,
+		Action:     db.AuditLoginFailed,
+		TargetType: db.AuditTargetUser,
+		TargetID:   username,
+		ClientIp:   mtdt.ClientIP,
+		UserAgent:  mtdt.UserAgent,
+	})
+	if auditErr != nil {
+		err = auditErr
+	}
+
+	return statusError(ctx, err)
+}
+
+func validateLoginUserRequest(req *pb.LoginUserRequest) (violations []apperr.FieldViolation) {
+	if err := validateUsername(req.GetUsername()); err != nil {
+		violations = append(violations, fieldViolation("username", err))
+	}
+
+	if err := validatePassword(req.GetPassword()); err != nil {
+		violations = append(violations, fieldViolation("password", err))
+	}
+
+	return violations
+}
@@ -0,0 +1,163 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginUserRPC(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		req        *pb.LoginUserRequest
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, rsp *pb.LoginUserResponse, err error)
+	}{
+		{
+			name: "OK",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().CreateSessionTx(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSessionTxParams) (db.Session, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, user.Username, arg.Audit.Actor)
+						require.Equal(t, reservedLoginAttempt.ID, arg.LoginAttemptID)
+						return db.Session{ID: arg.ID, Username: arg.Username}, nil
+					})
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.Username, rsp.GetUser().GetUsername())
+				require.NotEmpty(t, rsp.GetAccessToken())
+				require.NotEmpty(t, rsp.GetRefreshToken())
+				require.NotEmpty(t, rsp.GetSessionId())
+			},
+		},
+		{
+			name: "User Not Found",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, db.ErrRecordNotFound)
+				store.EXPECT().CreateSessionTx(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DeleteLoginAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAuditEventParams) (db.AuditEvent, error) {
+						require.Equal(t, db.AuditLoginFailed, arg.Action)
+						require.Equal(t, user.Username, arg.Actor)
+						return db.AuditEvent{}, nil
+					})
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+		{
+			name: "Incorrect Password",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password + "x"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+				store.EXPECT().CreateSessionTx(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DeleteLoginAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAuditEventParams) (db.AuditEvent, error) {
+						require.Equal(t, db.AuditLoginFailed, arg.Action)
+						require.Equal(t, user.Username, arg.Actor)
+						return db.AuditEvent{}, nil
+					})
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name: "Frozen User",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := user
+				frozen.IsFrozen = true
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(frozen, nil)
+				store.EXPECT().CreateSessionTx(gomock.Any(), gomock.Any()).Times(0)
+				// the password was right, the attempt doesn't count toward the lockout
+				store.EXPECT().DeleteLoginAttempt(gomock.Any(), gomock.Eq(reservedLoginAttempt.ID)).Times(1)
+				store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAuditEventParams) (db.AuditEvent, error) {
+						require.Equal(t, db.AuditLoginFailed, arg.Action)
+						require.Equal(t, user.Username, arg.Actor)
+						return db.AuditEvent{}, nil
+					})
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name: "Too Many Attempts",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				failures := db.GetLoginFailuresRow{
+					UsernameFailures:    5,
+					UsernameLastFailure: time.Now(),
+				}
+				store.EXPECT().ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(reserveLoginAttempt(failures))
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.ResourceExhausted, status.Code(err))
+			},
+		},
+		{
+			name: "Invalid Username",
+			req:  &pb.LoginUserRequest{Username: "invalid-user#1", Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, rsp *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			// Cases throttling the login define ReserveLoginAttemptTx first
+			store.EXPECT().ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(reserveLoginAttempt(db.GetLoginFailuresRow{}))
+
+			server := newTestServer(t, store)
+			rsp, err := server.LoginUser(context.Background(), tc.req)
+			tc.checker(t, rsp, err)
+		})
+	}
+}
+
+// reservedLoginAttempt is the attempt reserved for the logins let through by reserveLoginAttempt
+var reservedLoginAttempt = db.LoginAttempt{ID: 1}
+
+// reserveLoginAttempt mocks ReserveLoginAttemptTx with the recent failures,
+// the attempt is reserved if they let it through
+func reserveLoginAttempt(failures db.GetLoginFailuresRow) func(context.Context, db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+	return func(_ context.Context, arg db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+		if !arg.Admit(failures) {
+			return db.ReserveLoginAttemptTxResult{}, nil
+		}
+		return db.ReserveLoginAttemptTxResult{Admitted: true, Attempt: reservedLoginAttempt}, nil
+	}
+}
@@ -0,0 +1,47 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/pb"
+)
+
+// VerifyEmail marks the email of a user as verified with the code sent to it.
+// A code can only be used once and before it expires.
+func (server *Server) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	if violations := validateVerifyEmailRequest(req); violations != nil {
+		return nil, invalidArgumentError(ctx, violations)
+	}
+
+	_, err := server.store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{
+		EmailID:    req.GetEmailId(),
+		SecretCode: req.GetSecretCode(),
+		Audit:      server.auditParams(ctx, ""),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.InvalidField("secret_code", "is invalid, already used or expired")
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	rsp := &pb.VerifyEmailResponse{
+		IsVerified: true,
+	}
+	return rsp, nil
+}
+
+func validateVerifyEmailRequest(req *pb.VerifyEmailRequest) (violations []apperr.FieldViolation) {
+	if err := validateID(req.GetEmailId()); err != nil {
+		violations = append(violations, fieldViolation("email_id", err))
+	}
+
+	if err := validateString(req.GetSecretCode(), 1, 128); err != nil {
+		violations = append(violations, fieldViolation("secret_code", err))
+	}
+
+	return violations
+}
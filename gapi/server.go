@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/auth"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+	"github.com/pawpaw2022/simplebank/lockout"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/token"
+	"github.com/pawpaw2022/simplebank/transfer"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
+)
+
+// Server serves gRPC requests for our banking service.
+type Server struct {
+	pb.UnimplementedSimpleBankServer
+	config          util.Config
+	store           db.Store
+	tokenMaker      token.TokenMaker
+	revoker         *auth.Revoker
+	loginGuard      *lockout.Guard
+	transfers       *transfer.Service
+	taskDistributor worker.TaskDistributor
+}
+
+// NewServer creates a new gRPC server.
+// The revoker is shared with the HTTP server, its cache is kept in sync by the caller.
+func NewServer(config util.Config, store db.Store, taskDistributor worker.TaskDistributor, revoker *auth.Revoker) (*Server, error) {
+	tokenMaker, err := token.NewPasteoMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	rates, err := fx.NewProvider(config.FXRatesFile, config.FXRateMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rate provider: %w", err)
+	}
+
+	loginGuard := lockout.NewGuard(store, lockout.Config{
+		MaxAttempts:      config.LoginMaxAttempts,
+		MaxAttemptsPerIP: config.LoginMaxIPAttempts,
+		Window:           config.LoginAttemptWindow,
+		LockoutDuration:  config.LoginLockoutDuration,
+		Delay:            config.LoginDelay,
+		MaxDelay:         config.LoginMaxDelay,
+	})
+
+	server := &Server{
+		config:          config,
+		store:           store,
+		tokenMaker:      tokenMaker,
+		revoker:         revoker,
+		loginGuard:      loginGuard,
+		transfers:       transfer.NewService(store, rates),
+		taskDistributor: taskDistributor,
+	}
+
+	return server, nil
+}
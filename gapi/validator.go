@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+
+	"github.com/pawpaw2022/simplebank/util"
+)
+
+// The rules match the binding tags of the HTTP API
+var isValidUsername = regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
+
+func validateString(value string, minLength int, maxLength int) error {
+	n := len(value)
+	if n < minLength || n > maxLength {
+		return fmt.Errorf("must contain from %d-%d characters", minLength, maxLength)
+	}
+	return nil
+}
+
+func validateUsername(value string) error {
+	if err := validateString(value, 6, 100); err != nil {
+		return err
+	}
+	if !isValidUsername(value) {
+		return fmt.Errorf("must contain only letters and digits")
+	}
+	return nil
+}
+
+func validatePassword(value string) error {
+	return validateString(value, 6, 100)
+}
+
+func validateFullName(value string) error {
+	return validateString(value, 1, 100)
+}
+
+func validateEmail(value string) error {
+	if err := validateString(value, 3, 200); err != nil {
+		return err
+	}
+	if _, err := mail.ParseAddress(value); err != nil {
+		return fmt.Errorf("is not a valid email address")
+	}
+	return nil
+}
+
+func validateCurrency(value string) error {
+	if !util.IsSupportedCurrency(value) {
+		return fmt.Errorf("is not a supported currency")
+	}
+	return nil
+}
+
+func validateID(value int64) error {
+	if value < 1 {
+		return fmt.Errorf("must be a positive integer")
+	}
+	return nil
+}
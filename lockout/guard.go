@@ -0,0 +1,137 @@
+// Package lockout protects the login against brute-force attacks.
+// Failed attempts are stored in the login_attempts table, every failure of a username makes its next attempt
+// wait longer, and too many failures of a username or from a client IP lock them out for a while.
+package lockout
+
+import (
+	"context"
+	"time"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+)
+
+// Guard defaults, used for the Config fields left at zero
+const (
+	defaultMaxAttempts      = 5
+	defaultMaxAttemptsPerIP = 20
+	defaultWindow           = 15 * time.Minute
+	defaultLockoutDuration  = 15 * time.Minute
+	defaultDelay            = time.Second
+	defaultMaxDelay         = 30 * time.Second
+)
+
+// Config tunes the Guard.
+type Config struct {
+	MaxAttempts      int           // failures of a username within the window locking it out
+	MaxAttemptsPerIP int           // failures from a client IP within the window locking it out, whatever the usernames
+	Window           time.Duration // how long a failure counts
+	LockoutDuration  time.Duration // how long a lockout lasts after the last failure
+	Delay            time.Duration // wait after the first failure of a username, doubled on every failure
+	MaxDelay         time.Duration // upper bound of the wait before a lockout
+}
+
+// withDefaults fills the fields left at zero with the defaults
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.MaxAttemptsPerIP <= 0 {
+		c.MaxAttemptsPerIP = defaultMaxAttemptsPerIP
+	}
+	if c.Window <= 0 {
+		c.Window = defaultWindow
+	}
+	if c.LockoutDuration <= 0 {
+		c.LockoutDuration = defaultLockoutDuration
+	}
+	if c.Delay <= 0 {
+		c.Delay = defaultDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = defaultMaxDelay
+	}
+	return c
+}
+
+// delay returns the wait after the given number of failures of a username, starting at 1
+func (c Config) delay(failures int32) time.Duration {
+	delay := c.Delay
+	for i := int32(1); i < failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return delay
+}
+
+// wait returns how long after now the next attempt is allowed, zero if it is allowed now
+func (c Config) wait(failures db.GetLoginFailuresRow, now time.Time) time.Duration {
+	var until time.Time
+
+	switch {
+	case failures.UsernameFailures >= int32(c.MaxAttempts):
+		until = failures.UsernameLastFailure.Add(c.LockoutDuration)
+	case failures.UsernameFailures > 0:
+		until = failures.UsernameLastFailure.Add(c.delay(failures.UsernameFailures))
+	}
+
+	if failures.ClientIpFailures >= int32(c.MaxAttemptsPerIP) {
+		ipUntil := failures.ClientIpLastFailure.Add(c.LockoutDuration)
+		if ipUntil.After(until) {
+			until = ipUntil
+		}
+	}
+
+	if until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// Guard decides whether a login attempt is allowed from the recent failures.
+// An allowed attempt is recorded as failed before its password is checked, then
+// db.Store.CreateSessionTx marks it successful, which also clears the failures of the username.
+type Guard struct {
+	store  db.Store
+	config Config
+}
+
+// NewGuard creates a new Guard.
+// The fields of config left at zero are set to the defaults.
+func NewGuard(store db.Store, config Config) *Guard {
+	return &Guard{
+		store:  store,
+		config: config.withDefaults(),
+	}
+}
+
+// Reserve returns how long the client must wait before attempting to log in as the username,
+// zero if the attempt is allowed. The username is checked as sent, it may not exist.
+// An allowed attempt is returned, it counts as failed until the login succeeds or it is released.
+// Rejected attempts are not recorded, so a lockout ends on time.
+func (g *Guard) Reserve(ctx context.Context, username string, clientIP string) (db.LoginAttempt, time.Duration, error) {
+	now := time.Now()
+
+	var wait time.Duration
+	result, err := g.store.ReserveLoginAttemptTx(ctx, db.ReserveLoginAttemptTxParams{
+		Username: username,
+		ClientIp: clientIP,
+		Since:    now.Add(-g.config.Window),
+		Admit: func(failures db.GetLoginFailuresRow) bool {
+			wait = g.config.wait(failures, now)
+			return wait == 0
+		},
+	})
+	if err != nil {
+		return db.LoginAttempt{}, 0, err
+	}
+
+	return result.Attempt, wait, nil
+}
+
+// Release drops a reserved attempt that must not count toward the lockout,
+// such as one with the right password whose login is refused for another reason.
+func (g *Guard) Release(ctx context.Context, attempt db.LoginAttempt) error {
+	return g.store.DeleteLoginAttempt(ctx, attempt.ID)
+}
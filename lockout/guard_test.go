@@ -0,0 +1,205 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	config := Config{}.withDefaults()
+	require.Equal(t, defaultMaxAttempts, config.MaxAttempts)
+	require.Equal(t, defaultMaxAttemptsPerIP, config.MaxAttemptsPerIP)
+	require.Equal(t, defaultWindow, config.Window)
+	require.Equal(t, defaultLockoutDuration, config.LockoutDuration)
+	require.Equal(t, defaultDelay, config.Delay)
+	require.Equal(t, defaultMaxDelay, config.MaxDelay)
+}
+
+func TestDelay(t *testing.T) {
+	config := Config{
+		Delay:    time.Second,
+		MaxDelay: 5 * time.Second,
+	}
+
+	testCases := []struct {
+		failures int32
+		delay    time.Duration
+	}{
+		{failures: 1, delay: time.Second},
+		{failures: 2, delay: 2 * time.Second},
+		{failures: 3, delay: 4 * time.Second},
+		{failures: 4, delay: 5 * time.Second},
+		{failures: 40, delay: 5 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.delay, config.delay(tc.failures))
+	}
+}
+
+func TestWait(t *testing.T) {
+	config := Config{
+		MaxAttempts:      3,
+		MaxAttemptsPerIP: 10,
+		LockoutDuration:  time.Minute,
+		Delay:            time.Second,
+		MaxDelay:         5 * time.Second,
+	}
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		failures db.GetLoginFailuresRow
+		wait     time.Duration
+	}{
+		{
+			name:     "No Failures",
+			failures: db.GetLoginFailuresRow{},
+			wait:     0,
+		},
+		{
+			name:     "Delay",
+			failures: db.GetLoginFailuresRow{UsernameFailures: 2, UsernameLastFailure: now.Add(-time.Second)},
+			wait:     time.Second,
+		},
+		{
+			name:     "Delay Elapsed",
+			failures: db.GetLoginFailuresRow{UsernameFailures: 2, UsernameLastFailure: now.Add(-3 * time.Second)},
+			wait:     0,
+		},
+		{
+			name:     "Username Locked Out",
+			failures: db.GetLoginFailuresRow{UsernameFailures: 3, UsernameLastFailure: now.Add(-10 * time.Second)},
+			wait:     50 * time.Second,
+		},
+		{
+			name:     "Username Lockout Over",
+			failures: db.GetLoginFailuresRow{UsernameFailures: 3, UsernameLastFailure: now.Add(-2 * time.Minute)},
+			wait:     0,
+		},
+		{
+			name:     "Client IP Locked Out",
+			failures: db.GetLoginFailuresRow{ClientIpFailures: 10, ClientIpLastFailure: now.Add(-20 * time.Second)},
+			wait:     40 * time.Second,
+		},
+		{
+			name: "Longest Wait",
+			failures: db.GetLoginFailuresRow{
+				UsernameFailures:    1,
+				UsernameLastFailure: now,
+				ClientIpFailures:    10,
+				ClientIpLastFailure: now,
+			},
+			wait: time.Minute,
+		},
+		{
+			name:     "Client IP Below Threshold",
+			failures: db.GetLoginFailuresRow{ClientIpFailures: 9, ClientIpLastFailure: now},
+			wait:     0,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.wait, config.wait(tc.failures, now))
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	username := util.RandomOwner()
+	clientIP := "127.0.0.1"
+
+	store := mockdb.NewMockStore(ctrl)
+	guard := NewGuard(store, Config{Window: time.Hour})
+
+	testCases := []struct {
+		name     string
+		failures db.GetLoginFailuresRow
+		admitted bool
+	}{
+		{
+			name:     "Admitted",
+			failures: db.GetLoginFailuresRow{},
+			admitted: true,
+		},
+		{
+			name: "Locked Out",
+			failures: db.GetLoginFailuresRow{
+				UsernameFailures:    defaultMaxAttempts,
+				UsernameLastFailure: time.Now(),
+			},
+			admitted: false,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			reserved := db.LoginAttempt{ID: util.RandomInt(1, 1000), Username: username, ClientIp: clientIP}
+
+			store.EXPECT().
+				ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ context.Context, arg db.ReserveLoginAttemptTxParams) (db.ReserveLoginAttemptTxResult, error) {
+					require.Equal(t, username, arg.Username)
+					require.Equal(t, clientIP, arg.ClientIp)
+					require.WithinDuration(t, time.Now().Add(-time.Hour), arg.Since, time.Second)
+
+					if !arg.Admit(tc.failures) {
+						return db.ReserveLoginAttemptTxResult{}, nil
+					}
+					return db.ReserveLoginAttemptTxResult{Admitted: true, Attempt: reserved}, nil
+				})
+
+			attempt, wait, err := guard.Reserve(context.Background(), username, clientIP)
+			require.NoError(t, err)
+
+			if tc.admitted {
+				require.Zero(t, wait)
+				require.Equal(t, reserved, attempt)
+			} else {
+				require.InDelta(t, defaultLockoutDuration, wait, float64(time.Second))
+				require.Zero(t, attempt.ID)
+			}
+		})
+	}
+
+	store.EXPECT().
+		ReserveLoginAttemptTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.ReserveLoginAttemptTxResult{}, sql.ErrConnDone)
+
+	_, _, err := guard.Reserve(context.Background(), username, clientIP)
+	require.ErrorIs(t, err, sql.ErrConnDone)
+}
+
+func TestRelease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	guard := NewGuard(store, Config{})
+
+	attempt := db.LoginAttempt{ID: util.RandomInt(1, 1000)}
+	store.EXPECT().
+		DeleteLoginAttempt(gomock.Any(), gomock.Eq(attempt.ID)).
+		Times(1).
+		Return(nil)
+
+	require.NoError(t, guard.Release(context.Background(), attempt))
+}
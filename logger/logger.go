@@ -0,0 +1,128 @@
+// Package logger sets up the structured JSON logger and carries request scoped loggers through context.Context.
+package logger
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader is the header a request ID is read from and echoed back in,
+// the gRPC API uses it as a metadata key.
+const RequestIDHeader = "X-Request-ID"
+
+// Redacted replaces the value of sensitive fields in the logs.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the query parameters and fields that must never reach the logs
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"secret":        true,
+	"code":          true,
+}
+
+// requestIDPattern limits client supplied request IDs, anything else is replaced by a generated one
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// Setup makes the global logger write JSON lines at the given level ("debug", "info", ...) to w.
+func Setup(w io.Writer, level string) error {
+	lvl := zerolog.InfoLevel
+	if level != "" {
+		var err error
+		lvl, err = zerolog.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	zerolog.DurationFieldUnit = time.Millisecond
+	log.Logger = zerolog.New(w).Level(lvl).With().Timestamp().Logger()
+	return nil
+}
+
+// NewRequestID generates a request ID.
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ValidRequestID reports whether a client supplied request ID can be used as is.
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+// WithRequestID returns a context carrying the request ID and a logger tagging every line with it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	l := log.Logger.With().Str("request_id", requestID).Logger()
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return l.WithContext(ctx)
+}
+
+// RequestID returns the request ID carried by the context, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the request logger carried by the context, or the global logger.
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if RequestID(ctx) == "" {
+		return &log.Logger
+	}
+	return zerolog.Ctx(ctx)
+}
+
+// SetUsername tags every following line of the request logger with the authenticated username.
+// It does nothing outside a request, so the global logger is never changed.
+func SetUsername(ctx context.Context, username string) {
+	if RequestID(ctx) == "" {
+		return
+	}
+
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("username", username)
+	})
+}
+
+// IsSensitive reports whether the value of a field or parameter must be redacted.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	return strings.HasSuffix(key, "_password") || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret")
+}
+
+// RedactQuery returns the raw query string with the values of sensitive parameters redacted.
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Cannot tell which parts are sensitive
+		return Redacted
+	}
+
+	for key := range values {
+		if IsSensitive(key) {
+			values[key] = []string{Redacted}
+		}
+	}
+
+	return values.Encode()
+}
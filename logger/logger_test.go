@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rawQuery string
+		expected string
+	}{
+		{
+			name:     "Empty",
+			rawQuery: "",
+			expected: "",
+		},
+		{
+			name:     "Nothing Sensitive",
+			rawQuery: "page_size=5&cursor=abc",
+			expected: "cursor=abc&page_size=5",
+		},
+		{
+			name:     "Sensitive",
+			rawQuery: "id=1&code=secret-code&refresh_token=abc&new_password=xyz",
+			expected: "code=%5BREDACTED%5D&id=1&new_password=%5BREDACTED%5D&refresh_token=%5BREDACTED%5D",
+		},
+		{
+			name:     "Case Insensitive",
+			rawQuery: "Password=xyz",
+			expected: "Password=%5BREDACTED%5D",
+		},
+		{
+			name:     "Malformed",
+			rawQuery: "password=%zz",
+			expected: Redacted,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, RedactQuery(tc.rawQuery))
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	require.True(t, ValidRequestID(NewRequestID()))
+	require.True(t, ValidRequestID("upstream.request-1_a"))
+	require.False(t, ValidRequestID(""))
+	require.False(t, ValidRequestID("has space"))
+	require.False(t, ValidRequestID("line\nbreak"))
+	require.False(t, ValidRequestID(string(bytes.Repeat([]byte("a"), 65))))
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	defer func() { log.Logger = global }()
+	require.NoError(t, Setup(&buf, "info"))
+
+	requestID := NewRequestID()
+	ctx := WithRequestID(context.Background(), requestID)
+	require.Equal(t, requestID, RequestID(ctx))
+
+	SetUsername(ctx, "alice1")
+	FromContext(ctx).Info().Msg("in request")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, requestID, line["request_id"])
+	require.Equal(t, "alice1", line["username"])
+	require.Equal(t, "in request", line["message"])
+
+	// Outside a request the global logger is left untouched
+	buf.Reset()
+	SetUsername(context.Background(), "bob123")
+	FromContext(context.Background()).Info().Msg("outside request")
+
+	line = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.NotContains(t, line, "request_id")
+	require.NotContains(t, line, "username")
+}
+
+func TestSetupInvalidLevel(t *testing.T) {
+	global := log.Logger
+	defer func() { log.Logger = global }()
+
+	require.Error(t, Setup(&bytes.Buffer{}, "loud"))
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"time"
+)
+
+// FileSender writes every message to an .eml file instead of sending it, for local development.
+// The files can be opened with any mail client.
+type FileSender struct {
+	dir  string
+	from mail.Address
+}
+
+// NewFileSender creates a sender writing to dir, which is created if missing.
+func NewFileSender(dir string, from mail.Address) (*FileSender, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mail directory is not set")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create mail directory: %w", err)
+	}
+
+	return &FileSender{dir: dir, from: from}, nil
+}
+
+func (sender *FileSender) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+
+	data, err := msg.encode(sender.from, now)
+	if err != nil {
+		return err
+	}
+
+	// the timestamp orders the files, CreateTemp keeps names unique within the same nanosecond
+	file, err := os.CreateTemp(sender.dir, fmt.Sprintf("%d-*.eml", now.UnixNano()))
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySender keeps the sent messages in memory, for tests.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemorySender creates a sender keeping the messages in memory.
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (sender *MemorySender) Send(_ context.Context, msg Message) error {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	sender.messages = append(sender.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (sender *MemorySender) Messages() []Message {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	return append([]Message(nil), sender.messages...)
+}
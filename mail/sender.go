@@ -0,0 +1,92 @@
+// Package mail sends emails to users through a pluggable Sender.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Supported senders
+const (
+	SenderMemory = "memory" // keeps the messages in memory, for tests
+	SenderFile   = "file"   // writes every message to a file, for local development
+	SenderSMTP   = "smtp"
+)
+
+// Message is an email with an HTML body
+type Message struct {
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects how emails are sent.
+type Config struct {
+	Sender       string // one of the Sender constants, SenderMemory if empty
+	FromName     string
+	FromAddress  string
+	Dir          string // directory the file sender writes to
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string // no authentication if empty
+	SMTPPassword string
+}
+
+// NewSender creates the sender selected by the config.
+func NewSender(config Config) (Sender, error) {
+	from := mail.Address{Name: config.FromName, Address: config.FromAddress}
+
+	switch config.Sender {
+	case "", SenderMemory:
+		return NewMemorySender(), nil
+	case SenderFile:
+		return NewFileSender(config.Dir, from)
+	case SenderSMTP:
+		return NewSMTPSender(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, from)
+	}
+
+	return nil, fmt.Errorf("unsupported mail sender %q", config.Sender)
+}
+
+// encode returns the message in the RFC 5322 format, ready to be sent or stored
+func (msg Message) encode(from mail.Address, date time.Time) ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("message has no recipient")
+	}
+
+	to := make([]string, 0, len(msg.To))
+	for _, address := range msg.To {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", address, err)
+		}
+		to = append(to, parsed.String())
+	}
+
+	var buf bytes.Buffer
+	header := func(key string, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	// the encoding also keeps line breaks out of the header
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/html; charset="UTF-8"`)
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.HTML)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"context"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testFrom = mail.Address{Name: "Simple Bank", Address: "no-reply@simplebank.com"}
+
+func TestNewSender(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		checker func(t *testing.T, sender Sender, err error)
+	}{
+		{
+			name:   "Default",
+			config: Config{},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &MemorySender{}, sender)
+			},
+		},
+		{
+			name:   "File",
+			config: Config{Sender: SenderFile, Dir: t.TempDir()},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &FileSender{}, sender)
+			},
+		},
+		{
+			name:   "FileWithoutDir",
+			config: Config{Sender: SenderFile},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:   "SMTP",
+			config: Config{Sender: SenderSMTP, SMTPHost: "localhost", SMTPPort: 1025, FromAddress: testFrom.Address},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &SMTPSender{}, sender)
+			},
+		},
+		{
+			name:   "SMTPWithoutHost",
+			config: Config{Sender: SenderSMTP, FromAddress: testFrom.Address},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:   "Unsupported",
+			config: Config{Sender: "pigeon"},
+			checker: func(t *testing.T, sender Sender, err error) {
+				require.ErrorContains(t, err, "unsupported mail sender")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := NewSender(tc.config)
+			tc.checker(t, sender, err)
+		})
+	}
+}
+
+func TestMessageEncode(t *testing.T) {
+	date := time.Date(2023, time.September, 1, 12, 0, 0, 0, time.UTC)
+	msg := Message{
+		To:      []string{"john@example.com", "Jane <jane@example.com>"},
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		HTML:    "<b>hi</b>",
+	}
+
+	data, err := msg.encode(testFrom, date)
+	require.NoError(t, err)
+
+	header, body, found := strings.Cut(string(data), "\r\n\r\n")
+	require.True(t, found)
+	require.Equal(t, "<b>hi</b>", body)
+
+	require.Contains(t, header, `From: "Simple Bank" <no-reply@simplebank.com>`)
+	require.Contains(t, header, `To: <john@example.com>, "Jane" <jane@example.com>`)
+	require.Contains(t, header, "Date: Fri, 01 Sep 2023 12:00:00 +0000")
+	require.Contains(t, header, `Content-Type: text/html; charset="UTF-8"`)
+
+	// line breaks in the subject cannot add headers
+	require.NotContains(t, header, "\r\nBcc:")
+
+	_, err = Message{Subject: "no recipient"}.encode(testFrom, date)
+	require.Error(t, err)
+
+	_, err = Message{To: []string{"not an address"}}.encode(testFrom, date)
+	require.Error(t, err)
+}
+
+func TestMemorySender(t *testing.T) {
+	sender := NewMemorySender()
+	require.Empty(t, sender.Messages())
+
+	msg := Message{To: []string{"john@example.com"}, Subject: "Hello", HTML: "hi"}
+	require.NoError(t, sender.Send(context.Background(), msg))
+
+	messages := sender.Messages()
+	require.Equal(t, []Message{msg}, messages)
+
+	// the returned slice is a copy
+	messages[0].Subject = "changed"
+	require.Equal(t, "Hello", sender.Messages()[0].Subject)
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender, err := NewFileSender(dir, testFrom)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		err = sender.Send(context.Background(), Message{To: []string{"john@example.com"}, Subject: "Hello", HTML: "hi"})
+		require.NoError(t, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(data), "Subject: Hello\r\n")
+	require.True(t, strings.HasSuffix(string(data), "\r\n\r\nhi"))
+}
+
+func TestVerifyEmail(t *testing.T) {
+	msg, err := VerifyEmail("john@example.com", "<John>", "http://localhost:8080/verify_email?id=1&code=abc")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"john@example.com"}, msg.To)
+	require.NotEmpty(t, msg.Subject)
+	require.Contains(t, msg.HTML, `href="http://localhost:8080/verify_email?id=1&amp;code=abc"`)
+
+	// user input is escaped
+	require.Contains(t, msg.HTML, "&lt;John&gt;")
+}
+
+func TestVerifyEmailLink(t *testing.T) {
+	link := VerifyEmailLink("http://localhost:8080/", 12, "a+b/c")
+	require.Equal(t, "http://localhost:8080/verify_email?code=a%2Bb%2Fc&id=12", link)
+}
+
+func TestResetPassword(t *testing.T) {
+	msg, err := ResetPassword("john@example.com", "<John>", "abc-123")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"john@example.com"}, msg.To)
+	require.NotEmpty(t, msg.Subject)
+	require.Contains(t, msg.HTML, "<b>abc-123</b>")
+	require.Contains(t, msg.HTML, "&lt;John&gt;")
+}
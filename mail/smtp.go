@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPSender sends the messages through an SMTP server.
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from mail.Address
+}
+
+// NewSMTPSender creates a sender using the SMTP server at host:port.
+// It authenticates with PLAIN auth if a username is given, which requires TLS unless the host is localhost.
+func NewSMTPSender(host string, port int, username string, password string, from mail.Address) (*SMTPSender, error) {
+	if host == "" {
+		return nil, fmt.Errorf("SMTP host is not set")
+	}
+
+	if _, err := mail.ParseAddress(from.Address); err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", from.Address, err)
+	}
+
+	sender := &SMTPSender{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+	}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return sender, nil
+}
+
+// Send delivers the message to the SMTP server.
+// net/smtp has no context support, so a cancelled context only stops messages that are not sent yet.
+func (sender *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := msg.encode(sender.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(sender.addr, sender.auth, sender.from.Address, msg.To, data); err != nil {
+		return fmt.Errorf("cannot send email: %w", err)
+	}
+
+	return nil
+}
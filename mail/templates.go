@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var verifyEmailTemplate = template.Must(template.New("verify_email").Parse(
+	`Hello {{.FullName}},<br/>
+Thank you for registering with us!<br/>
+Please <a href="{{.Link}}">click here</a> to verify your email address.<br/>`,
+))
+
+var resetPasswordTemplate = template.Must(template.New("reset_password").Parse(
+	`Hello {{.FullName}},<br/>
+We received a request to reset the password of your account.<br/>
+Send the following token with your new password to reset it, it can be used once within an hour:<br/>
+<b>{{.Token}}</b><br/>
+If you did not request it, you can ignore this email.<br/>`,
+))
+
+// VerifyEmailLink returns the link of the HTTP API verifying the email with the secret code.
+func VerifyEmailLink(publicURL string, emailID int64, secretCode string) string {
+	query := url.Values{}
+	query.Set("id", strconv.FormatInt(emailID, 10))
+	query.Set("code", secretCode)
+	return strings.TrimSuffix(publicURL, "/") + "/verify_email?" + query.Encode()
+}
+
+// VerifyEmail returns the message asking a new user to verify the email address by opening the link.
+func VerifyEmail(to string, fullName string, link string) (Message, error) {
+	var body bytes.Buffer
+	err := verifyEmailTemplate.Execute(&body, struct {
+		FullName string
+		Link     string
+	}{fullName, link})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      []string{to},
+		Subject: "Welcome to Simple Bank",
+		HTML:    body.String(),
+	}, nil
+}
+
+// ResetPassword returns the message with the token resetting the password of a user.
+func ResetPassword(to string, fullName string, token string) (Message, error) {
+	var body bytes.Buffer
+	err := resetPasswordTemplate.Execute(&body, struct {
+		FullName string
+		Token    string
+	}{fullName, token})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      []string{to},
+		Subject: "Reset your Simple Bank password",
+		HTML:    body.String(),
+	}, nil
+}
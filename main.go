@@ -1,38 +1,311 @@
 package main
 
 import (
-	"database/sql"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	_ "github.com/lib/pq" // postgresql driver
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pawpaw2022/simplebank/api"
+	"github.com/pawpaw2022/simplebank/auth"
+	"github.com/pawpaw2022/simplebank/db/migrations"
 	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/gapi"
+	"github.com/pawpaw2022/simplebank/logger"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/pawpaw2022/simplebank/metrics"
+	"github.com/pawpaw2022/simplebank/pb"
+	"github.com/pawpaw2022/simplebank/tracing"
 	"github.com/pawpaw2022/simplebank/util"
+	"github.com/pawpaw2022/simplebank/worker"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	// defaultShutdownTimeout is used when SHUTDOWN_TIMEOUT is not set
+	defaultShutdownTimeout = 20 * time.Second
+	// defaultReadHeaderTimeout is used when HTTP_READ_HEADER_TIMEOUT is not set
+	defaultReadHeaderTimeout = 5 * time.Second
+	// defaultReadTimeout is used when HTTP_READ_TIMEOUT is not set
+	defaultReadTimeout = 30 * time.Second
+	// dbStatsName labels the connection pool metrics
+	dbStatsName = "simple_bank"
 )
 
 func main() {
 	// Load config
 	config, err := util.LoadConfig(".")
 	if err != nil {
-		log.Fatal("cannot load config: %w", err)
+		log.Fatal().Err(err).Msg("cannot load config")
+	}
+
+	if err := logger.Setup(os.Stdout, config.LogLevel); err != nil {
+		log.Fatal().Err(err).Msg("cannot set up logger")
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(config, os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("cannot run migrate command")
+		}
+		return
+	}
+
+	if config.MigrateOnStart {
+		if err := migrations.Up(config.DBSource); err != nil {
+			log.Fatal().Err(err).Msg("cannot run migrations")
+		}
+		log.Info().Msg("db migrated successfully")
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	// Slow clients must not hold connections open forever
+	if config.HTTPReadHeaderTimeout <= 0 {
+		config.HTTPReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if config.HTTPReadTimeout <= 0 {
+		config.HTTPReadTimeout = defaultReadTimeout
+	}
+
+	if config.FXRatesFile == "" {
+		log.Warn().Msg("no FX_RATES_FILE configured, cross-currency transfers are disabled")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     config.TracingExporter,
+		OTLPEndpoint: config.OTLPEndpoint,
+		OTLPInsecure: config.OTLPInsecure,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot set up tracing")
 	}
 
 	// Connect to db
-	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	connPool, err := pgxpool.New(context.Background(), config.DBSource)
 	if err != nil {
-		log.Fatal("cannot connect to db: %w", err)
+		log.Fatal().Err(err).Msg("cannot connect to db")
 	}
 
-	store := db.NewStore(conn)
-	server, err := api.NewServer(config, store)
+	if err := metrics.RegisterDBStats(connPool, dbStatsName); err != nil {
+		log.Fatal().Err(err).Msg("cannot register db stats metrics")
+	}
+
+	store := db.NewStore(connPool, db.RetryConfig{
+		MaxRetries: config.TxMaxRetries,
+		Delay:      config.TxRetryDelay,
+		MaxDelay:   config.TxRetryMaxDelay,
+	})
+
+	mailer, err := mail.NewSender(mail.Config{
+		Sender:       config.MailSender,
+		FromName:     config.MailFromName,
+		FromAddress:  config.MailFromAddress,
+		Dir:          config.MailDir,
+		SMTPHost:     config.SMTPHost,
+		SMTPPort:     config.SMTPPort,
+		SMTPUsername: config.SMTPUsername,
+		SMTPPassword: config.SMTPPassword,
+	})
 	if err != nil {
-		log.Fatal("cannot create server: %w", err)
+		log.Fatal().Err(err).Msg("cannot create mail sender")
+	}
+
+	// SIGTERM is what Kubernetes sends before killing the pod
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve gRPC next to the HTTP API and process the background tasks, the first one to fail stops the others
+	group, ctx := errgroup.WithContext(ctx)
+
+	// A failed start cancels the group, so whatever already runs still shuts down gracefully
+	if err := runServices(ctx, group, config, store, mailer); err != nil {
+		group.Go(func() error {
+			return err
+		})
+	}
+
+	waitErr := group.Wait()
+	if waitErr != nil {
+		log.Error().Err(waitErr).Msg("server stopped with error")
+	}
+
+	// Only close the pool once no request can use it anymore
+	connPool.Close()
+
+	// Flush the spans of the last requests
+	flushCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Error().Err(err).Msg("cannot flush traces")
 	}
 
-	err = server.Start(config.ServerAddress)
+	log.Info().Msg("server stopped")
+
+	// Exit with a failure so the orchestrator restarts the pod, os.Exit skips the deferred calls
+	if waitErr != nil {
+		cancel()
+		stop()
+		os.Exit(1)
+	}
+}
 
+// runServices starts the background jobs and both servers in the group
+func runServices(ctx context.Context, group *errgroup.Group, config util.Config, store db.Store, mailer mail.Sender) error {
+	taskDistributor := worker.NewPGTaskDistributor(store)
+
+	revoker, err := runTokenRevoker(ctx, group, config, store)
 	if err != nil {
-		log.Fatal("cannot start server: %w", err)
+		return err
+	}
+
+	runTaskProcessor(ctx, group, config, store, mailer)
+
+	if err := runGrpcServer(ctx, group, config, store, taskDistributor, revoker); err != nil {
+		return err
 	}
 
+	return runGinServer(ctx, group, config, store, taskDistributor, revoker)
+}
+
+// runTokenRevoker keeps the revoked token cache shared by both servers in sync with the database
+func runTokenRevoker(ctx context.Context, group *errgroup.Group, config util.Config, store db.Store) (*auth.Revoker, error) {
+	// Refresh tokens live the longest, a cutoff must be remembered until they expire
+	revoker := auth.NewRevoker(store, config.RefreshTokenDuration)
+
+	// The servers must not accept a revoked token because the cache is still empty
+	if err := revoker.Sync(ctx); err != nil {
+		return nil, fmt.Errorf("cannot load revoked tokens: %w", err)
+	}
+
+	group.Go(func() error {
+		revoker.Run(ctx, auth.RevocationSyncInterval)
+		return nil
+	})
+
+	return revoker, nil
+}
+
+func runTaskProcessor(ctx context.Context, group *errgroup.Group, config util.Config, store db.Store, mailer mail.Sender) {
+	processor := worker.NewPGTaskProcessor(store, mailer, worker.Config{
+		Concurrency:   config.WorkerConcurrency,
+		PollInterval:  config.WorkerPollInterval,
+		RetryDelay:    config.WorkerRetryDelay,
+		RetryMaxDelay: config.WorkerRetryMaxDelay,
+		LockTimeout:   config.WorkerLockTimeout,
+		PublicURL:     config.PublicURL,
+	})
+
+	// Run returns once the tasks in progress are done, before the pool is closed
+	group.Go(func() error {
+		return processor.Run(ctx)
+	})
+}
+
+func runGrpcServer(ctx context.Context, group *errgroup.Group, config util.Config, store db.Store, taskDistributor worker.TaskDistributor, revoker *auth.Revoker) error {
+	server, err := gapi.NewServer(config, store, taskDistributor, revoker)
+	if err != nil {
+		return fmt.Errorf("cannot create gRPC server: %w", err)
+	}
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		otelgrpc.UnaryServerInterceptor(),
+		gapi.GrpcLogger,
+		server.AuthInterceptor,
+	))
+	pb.RegisterSimpleBankServer(grpcServer, server)
+
+	// Lets clients such as grpcurl discover the services
+	reflection.Register(grpcServer)
+
+	listener, err := net.Listen("tcp", config.GRPCServerAddress)
+	if err != nil {
+		return fmt.Errorf("cannot create listener: %w", err)
+	}
+
+	group.Go(func() error {
+		log.Info().Msgf("start gRPC server at %s", listener.Addr().String())
+		return grpcServer.Serve(listener)
+	})
+
+	group.Go(func() error {
+		<-ctx.Done()
+		log.Info().Msg("graceful shutdown gRPC server")
+
+		// GracefulStop waits for every pending RPC, so it is bounded by the shutdown timeout
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(config.ShutdownTimeout):
+			log.Warn().Msg("gRPC shutdown timed out, closing remaining connections")
+			grpcServer.Stop()
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
+func runGinServer(ctx context.Context, group *errgroup.Group, config util.Config, store db.Store, taskDistributor worker.TaskDistributor, revoker *auth.Revoker) error {
+	server, err := api.NewServer(config, store, taskDistributor, revoker)
+	if err != nil {
+		return fmt.Errorf("cannot create server: %w", err)
+	}
+
+	serveHTTP(ctx, group, config, "HTTP", &http.Server{
+		Addr:              config.ServerAddress,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: config.HTTPReadHeaderTimeout,
+		ReadTimeout:       config.HTTPReadTimeout,
+	})
+
+	// Metrics and health probes are served on their own listener, which is only reachable from inside the cluster
+	serveHTTP(ctx, group, config, "internal HTTP", &http.Server{
+		Addr:              config.InternalAddress,
+		Handler:           server.InternalHandler(),
+		ReadHeaderTimeout: config.HTTPReadHeaderTimeout,
+		ReadTimeout:       config.HTTPReadTimeout,
+	})
+
+	return nil
+}
+
+// serveHTTP serves the HTTP server until ctx is done, then shuts it down gracefully
+func serveHTTP(ctx context.Context, group *errgroup.Group, config util.Config, name string, httpServer *http.Server) {
+	group.Go(func() error {
+		log.Info().Msgf("start %s server at %s", name, httpServer.Addr)
+		err := httpServer.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+
+	group.Go(func() error {
+		<-ctx.Done()
+		log.Info().Msgf("graceful shutdown %s server", name)
+
+		// The signal context is already done, in-flight requests get their own deadline
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+
+		return httpServer.Shutdown(shutdownCtx)
+	})
 }
@@ -0,0 +1,122 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics.
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "simplebank"
+
+// Transfer outcomes, used as the outcome label of TransfersTotal
+const (
+	TransferSucceeded            = "succeeded"
+	TransferReplayed             = "replayed"
+	TransferInsufficientFunds    = "insufficient_funds"
+	TransferRateNotFound         = "exchange_rate_not_found"
+	TransferIdempotencyKeyReused = "idempotency_key_reused"
+	TransferFailed               = "failed"
+)
+
+// Task outcomes, used as the outcome label of TasksTotal
+const (
+	TaskSucceeded = "succeeded"
+	TaskRetried   = "retried"
+	TaskDead      = "dead" // failed too often or could not be retried, see the dead tasks in the tasks table
+)
+
+var (
+	// HTTPRequestDuration observes every HTTP request by route pattern, so /accounts/1 and /accounts/2 share a series.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// TransfersTotal counts transfer requests by source currency and outcome, across the HTTP and gRPC APIs.
+	TransfersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Number of transfer requests by source currency and outcome.",
+	}, []string{"currency", "outcome"})
+
+	// TransferTxDuration observes the transfer database transactions, including replays and failures.
+	TransferTxDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transfer_tx_duration_seconds",
+		Help:      "Duration of the transfer database transaction.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// TxRetriesTotal counts database transactions run again after a retryable error, by transaction name.
+	TxRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_tx_retries_total",
+		Help:      "Number of database transaction retries by transaction name.",
+	}, []string{"tx"})
+
+	// TasksTotal counts the attempts of background tasks by task type and outcome.
+	TasksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_total",
+		Help:      "Number of background task attempts by task type and outcome.",
+	}, []string{"type", "outcome"})
+)
+
+// ObserveTransfer counts a transfer request.
+func ObserveTransfer(currency string, outcome string) {
+	TransfersTotal.WithLabelValues(currency, outcome).Inc()
+}
+
+// RegisterDBStats exposes the stats of the connection pool, such as acquired, idle and total connections.
+// The stats are read from the pool on every scrape.
+func RegisterDBStats(pool *pgxpool.Pool, dbName string) error {
+	labels := prometheus.Labels{"db_name": dbName}
+
+	gauge := func(name string, help string, value func(stat *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "db_pool",
+			Name:        name,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return value(pool.Stat()) })
+	}
+	counter := func(name string, help string, value func(stat *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "db_pool",
+			Name:        name,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return value(pool.Stat()) })
+	}
+
+	collectors := []prometheus.Collector{
+		gauge("max_connections", "Maximum size of the pool.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.MaxConns()) }),
+		gauge("total_connections", "Number of connections in the pool, acquired, idle or being established.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.TotalConns()) }),
+		gauge("acquired_connections", "Number of connections currently in use.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.AcquiredConns()) }),
+		gauge("idle_connections", "Number of idle connections.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.IdleConns()) }),
+		counter("acquires_total", "Number of successful connection acquires.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.AcquireCount()) }),
+		counter("empty_acquires_total", "Number of acquires that had to wait because the pool was empty.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.EmptyAcquireCount()) }),
+		counter("canceled_acquires_total", "Number of acquires canceled by their context.",
+			func(stat *pgxpool.Stat) float64 { return float64(stat.CanceledAcquireCount()) }),
+		counter("acquire_duration_seconds_total", "Total time spent acquiring connections.",
+			func(stat *pgxpool.Stat) float64 { return stat.AcquireDuration().Seconds() }),
+	}
+
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
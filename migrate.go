@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/pawpaw2022/simplebank/db/migrations"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/rs/zerolog/log"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up [N]       apply all or N pending migrations
+  down [N]     roll back N migrations, 1 if omitted
+  version      print the current migration version
+  force V      set the version to V without running migrations, to recover from a dirty state`
+
+// runMigrateCommand runs a migrate subcommand with the embedded migrations against DB_SOURCE
+func runMigrateCommand(config util.Config, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrations.New(config.DBSource)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	command := args[0]
+	n, hasN, err := parseMigrateArg(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		if hasN {
+			err = m.Steps(n)
+		} else {
+			err = m.Up()
+		}
+	case "down":
+		// Rolling back everything drops every table, it is never the default
+		if !hasN {
+			n = 1
+		}
+		err = m.Steps(-n)
+	case "version":
+		if hasN {
+			return errors.New(migrateUsage)
+		}
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Println("no migration applied")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d, dirty %t\n", version, dirty)
+		return nil
+	case "force":
+		if !hasN {
+			return errors.New(migrateUsage)
+		}
+		err = m.Force(n)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Info().Msg("no change")
+		return nil
+	}
+
+	return err
+}
+
+// parseMigrateArg parses the optional numeric argument of a migrate command
+func parseMigrateArg(args []string) (n int, ok bool, err error) {
+	if len(args) == 0 {
+		return 0, false, nil
+	}
+
+	n, err = strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, false, fmt.Errorf("invalid number %q\n%s", args[0], migrateUsage)
+	}
+
+	return n, true, nil
+}
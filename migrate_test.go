@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigrateArg(t *testing.T) {
+	n, ok, err := parseMigrateArg(nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Zero(t, n)
+
+	n, ok, err = parseMigrateArg([]string{"3"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 3, n)
+
+	_, _, err = parseMigrateArg([]string{"-1"})
+	require.Error(t, err)
+
+	_, _, err = parseMigrateArg([]string{"all"})
+	require.Error(t, err)
+}
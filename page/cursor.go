@@ -0,0 +1,56 @@
+// Package page encodes the cursors of the keyset paginated lists.
+// The HTTP and gRPC APIs share it, so a cursor returned by one is understood by the other.
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a token that is not a cursor returned by Next.
+var ErrInvalidCursor = errors.New("is not a valid cursor")
+
+// Cursor points at the last row of a page, the next page starts right after it.
+// Clients get it as an opaque token and must not rely on its content.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        int64     `json:"id"`
+}
+
+// Encode returns the cursor as an opaque token.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by Next. An empty token is the start of the list.
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+	if token == "" {
+		return c, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Next cuts rows down to the page size. The list queries fetch one extra row,
+// so the token of the next page is only returned if there is another page.
+func Next[T any](rows []T, pageSize int32, cursorOf func(T) Cursor) ([]T, string) {
+	if len(rows) <= int(pageSize) {
+		return rows, ""
+	}
+
+	rows = rows[:pageSize]
+	return rows, cursorOf(rows[len(rows)-1]).Encode()
+}
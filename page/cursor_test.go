@@ -0,0 +1,44 @@
+package page
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{
+		CreatedAt: time.Date(2023, time.September, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        42,
+	}
+
+	got, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	require.True(t, cursor.CreatedAt.Equal(got.CreatedAt))
+	require.Equal(t, cursor.ID, got.ID)
+
+	// an empty cursor starts from the beginning
+	got, err = DecodeCursor("")
+	require.NoError(t, err)
+	require.Zero(t, got)
+
+	for _, token := range []string{"%%%", "bm90IGpzb24", Cursor{}.Encode()} {
+		_, err = DecodeCursor(token)
+		require.ErrorIs(t, err, ErrInvalidCursor, token)
+	}
+}
+
+func TestNext(t *testing.T) {
+	cursorOf := func(id int64) Cursor {
+		return Cursor{ID: id}
+	}
+
+	rows, next := Next([]int64{1, 2, 3}, 3, cursorOf)
+	require.Equal(t, []int64{1, 2, 3}, rows)
+	require.Empty(t, next)
+
+	rows, next = Next([]int64{1, 2, 3, 4}, 3, cursorOf)
+	require.Equal(t, []int64{1, 2, 3}, rows)
+	require.Equal(t, Cursor{ID: 3}.Encode(), next)
+}
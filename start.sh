@@ -3,8 +3,7 @@
 set -e 
 
 echo "Run db migrations"
-source /app/app.env
-/app/migrate -path /app/migrations -database "$DB_SOURCE" -verbose up
+/app/main migrate up
 
 echo "Run app"
-exec "$@" 
+exec "$@"
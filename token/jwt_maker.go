@@ -28,25 +28,28 @@ func NewJWTMaker(secretKey string) (TokenMaker, error) {
 
 // implements TokenMaker interface
 
-// CreateToken creates a new token for a specific username and duration.
-func (maker *JWTMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+// CreateToken creates a new token of the given type for a specific username, role and duration.
+func (maker *JWTMaker) CreateToken(username string, role string, tokenType TokenType, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, role, tokenType, duration)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":        payload.ID,
-		"username":  payload.Username,
-		"issue_at":  payload.IssueAt.Unix(),
-		"expire_at": payload.ExpireAt.Unix(),
+		"id":         payload.ID,
+		"token_type": payload.Type,
+		"username":   payload.Username,
+		"role":       payload.Role,
+		"issue_at":   payload.IssueAt.Unix(),
+		"expire_at":  payload.ExpireAt.Unix(),
 	})
 
-	return jwtToken.SignedString([]byte(maker.secretKey))
+	token, err := jwtToken.SignedString([]byte(maker.secretKey))
+	return token, payload, err
 }
 
-// VerifyToken checks if the token is valid or not.
-func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
+// VerifyToken checks if the token is valid and of the given type.
+func (maker *JWTMaker) VerifyToken(token string, tokenType TokenType) (*Payload, error) {
 	jwtToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 
 		// Check if the signing method is HMAC
@@ -80,11 +83,21 @@ func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 		return nil, fmt.Errorf("invalid id claim")
 	}
 
+	claimedType, ok := payload["token_type"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid token_type claim")
+	}
+
 	username, ok := payload["username"].(string)
 	if !ok {
 		return nil, fmt.Errorf("invalid username claim")
 	}
 
+	role, ok := payload["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid role claim")
+	}
+
 	issueAt, ok := payload["issue_at"].(float64)
 	if !ok {
 		return nil, fmt.Errorf("invalid issue_at claim")
@@ -100,11 +113,19 @@ func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 		return nil, fmt.Errorf("token has expired")
 	}
 
-	return &Payload{
+	verified := &Payload{
 		ID:       uuid.MustParse(id),
+		Type:     TokenType(claimedType),
 		Username: username,
+		Role:     role,
 		IssueAt:  time.Unix(int64(issueAt), 0),
 		ExpireAt: time.Unix(int64(expireAt), 0),
-	}, nil
+	}
+
+	if err := verified.verifyType(tokenType); err != nil {
+		return nil, err
+	}
+
+	return verified, nil
 
 }
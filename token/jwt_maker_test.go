@@ -15,22 +15,26 @@ func TestJWTMaker(t *testing.T) {
 	require.NoError(t, err)
 
 	username := util.RandomOwner()
+	role := util.DepositorRole
 	duration := time.Minute
 
 	issueAt := time.Now()
 	expireAt := issueAt.Add(duration)
 
-	token, err := maker.CreateToken(username, duration)
+	token, payload, err := maker.CreateToken(username, role, TokenTypeAccessToken, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token, TokenTypeAccessToken)
 	require.NoError(t, err)
 	require.NotEmpty(t, payload)
 
 	// Verify the payload data.
 	require.Equal(t, username, payload.Username)
+	require.Equal(t, role, payload.Role)
 	require.NotZero(t, payload.ID)
+	require.Equal(t, TokenTypeAccessToken, payload.Type)
 	require.WithinDuration(t, issueAt, payload.IssueAt, time.Second)
 	require.WithinDuration(t, expireAt, payload.ExpireAt, time.Second)
 }
@@ -39,22 +43,24 @@ func TestExpiredJWTMaker(t *testing.T) {
 	maker, err := NewJWTMaker(util.RandomString(32))
 	require.NoError(t, err)
 
-	token, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
+	token, payload, err := maker.CreateToken(util.RandomOwner(), util.DepositorRole, TokenTypeAccessToken, -time.Minute)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token, TokenTypeAccessToken)
 	require.Error(t, err)
 	require.Nil(t, payload)
 }
 
 func TestInvalidJWTMaker(t *testing.T) {
-	payload, err := NewPayload(util.RandomOwner(), time.Minute)
+	payload, err := NewPayload(util.RandomOwner(), util.DepositorRole, TokenTypeAccessToken, time.Minute)
 	require.NoError(t, err)
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
 		"id":        payload.ID,
 		"username":  payload.Username,
+		"role":      payload.Role,
 		"issue_at":  payload.IssueAt.Unix(),
 		"expire_at": payload.ExpireAt.Unix(),
 	})
@@ -64,8 +70,25 @@ func TestInvalidJWTMaker(t *testing.T) {
 	maker, err := NewJWTMaker(util.RandomString(32))
 	require.NoError(t, err)
 
-	payload, err = maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token, TokenTypeAccessToken)
 	require.Error(t, err)
 	require.EqualError(t, err, "invalid token signing method: none")
 	require.Nil(t, payload)
 }
+
+func TestWrongTokenTypeJWTMaker(t *testing.T) {
+	maker, err := NewJWTMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), util.DepositorRole, TokenTypeRefreshToken, time.Minute)
+	require.NoError(t, err)
+
+	// A refresh token can't be used as an access token
+	payload, err := maker.VerifyToken(token, TokenTypeAccessToken)
+	require.Error(t, err)
+	require.Nil(t, payload)
+
+	payload, err = maker.VerifyToken(token, TokenTypeRefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeRefreshToken, payload.Type)
+}
@@ -4,9 +4,10 @@ import "time"
 
 // TokenMaker is an interface that creates and verifies tokens.
 type TokenMaker interface {
-	// CreateToken creates a new token for a specific username and duration.
-	CreateToken(username string, duration time.Duration) (string, error)
+	// CreateToken creates a new token of the given type for a specific username, role and duration.
+	// It also returns the payload so callers can read the token ID and expiry.
+	CreateToken(username string, role string, tokenType TokenType, duration time.Duration) (string, *Payload, error)
 
-	// VerifyToken checks if the token is valid or not.
-	VerifyToken(token string) (*Payload, error)
+	// VerifyToken checks if the token is valid and of the given type.
+	VerifyToken(token string, tokenType TokenType) (*Payload, error)
 }
@@ -29,18 +29,19 @@ func NewPasteoMaker(symmetricKey string) (TokenMaker, error) {
 
 }
 
-// CreateToken creates a new token for a specific username and duration.
-func (maker *PasteoMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+// CreateToken creates a new token of the given type for a specific username, role and duration.
+func (maker *PasteoMaker) CreateToken(username string, role string, tokenType TokenType, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, role, tokenType, duration)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	return token, payload, err
 }
 
-// VerifyToken checks if the token is valid or not.
-func (maker *PasteoMaker) VerifyToken(token string) (*Payload, error) {
+// VerifyToken checks if the token is valid and of the given type.
+func (maker *PasteoMaker) VerifyToken(token string, tokenType TokenType) (*Payload, error) {
 	payload := &Payload{}
 	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
 	if err != nil {
@@ -52,5 +53,9 @@ func (maker *PasteoMaker) VerifyToken(token string) (*Payload, error) {
 		return nil, fmt.Errorf("token is expired")
 	}
 
+	if err := payload.verifyType(tokenType); err != nil {
+		return nil, err
+	}
+
 	return payload, nil
 }
@@ -13,22 +13,26 @@ func TestPasetoMaker(t *testing.T) {
 	require.NoError(t, err)
 
 	username := util.RandomOwner()
+	role := util.DepositorRole
 	duration := time.Minute
 
 	issueAt := time.Now()
 	expireAt := issueAt.Add(duration)
 
-	token, err := maker.CreateToken(username, duration)
+	token, payload, err := maker.CreateToken(username, role, TokenTypeAccessToken, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token, TokenTypeAccessToken)
 	require.NoError(t, err)
 	require.NotEmpty(t, payload)
 
 	// Verify the payload data.
 	require.Equal(t, username, payload.Username)
+	require.Equal(t, role, payload.Role)
 	require.NotZero(t, payload.ID)
+	require.Equal(t, TokenTypeAccessToken, payload.Type)
 	require.WithinDuration(t, issueAt, payload.IssueAt, time.Second)
 	require.WithinDuration(t, expireAt, payload.ExpireAt, time.Second)
 }
@@ -37,11 +41,29 @@ func TestExpiredPasetoMaker(t *testing.T) {
 	maker, err := NewPasteoMaker(util.RandomString(32))
 	require.NoError(t, err)
 
-	token, err := maker.CreateToken(util.RandomOwner(), -time.Minute)
+	token, payload, err := maker.CreateToken(util.RandomOwner(), util.DepositorRole, TokenTypeAccessToken, -time.Minute)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
-	payload, err := maker.VerifyToken(token)
+	payload, err = maker.VerifyToken(token, TokenTypeAccessToken)
 	require.Error(t, err)
 	require.Nil(t, payload)
 }
+
+func TestWrongTokenTypePasetoMaker(t *testing.T) {
+	maker, err := NewPasteoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), util.DepositorRole, TokenTypeRefreshToken, time.Minute)
+	require.NoError(t, err)
+
+	// A refresh token can't be used as an access token
+	payload, err := maker.VerifyToken(token, TokenTypeAccessToken)
+	require.Error(t, err)
+	require.Nil(t, payload)
+
+	payload, err = maker.VerifyToken(token, TokenTypeRefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeRefreshToken, payload.Type)
+}
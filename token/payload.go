@@ -1,21 +1,32 @@
 package token
 
 import (
+	"fmt"
 	"time"
 
 	uuid "github.com/google/uuid"
 )
 
+// TokenType tells access tokens, sent with every request, from refresh tokens, only used to renew them.
+type TokenType string
+
+const (
+	TokenTypeAccessToken  TokenType = "access"
+	TokenTypeRefreshToken TokenType = "refresh"
+)
+
 // Payload is the output of the token creation process.
 type Payload struct {
 	ID       uuid.UUID `json:"id"`
+	Type     TokenType `json:"token_type"`
 	Username string    `json:"username"`
+	Role     string    `json:"role"`
 	IssueAt  time.Time `json:"issue_at"`
 	ExpireAt time.Time `json:"expire_at"`
 }
 
-// NewPayload creates a new payload for a specific username and duration.
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+// NewPayload creates a new payload of the given type for a specific username, role and duration.
+func NewPayload(username string, role string, tokenType TokenType, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -23,10 +34,21 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 
 	payload := &Payload{
 		ID:       tokenID,
+		Type:     tokenType,
 		Username: username,
+		Role:     role,
 		IssueAt:  time.Now(),
 		ExpireAt: time.Now().Add(duration),
 	}
 
 	return payload, nil
 }
+
+// verifyType checks the token is of the expected type,
+// so a refresh token can't be used as an access token and the other way round.
+func (payload *Payload) verifyType(tokenType TokenType) error {
+	if payload.Type != tokenType {
+		return fmt.Errorf("invalid token type %q, expected %q", payload.Type, tokenType)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Package tracing sets up the OpenTelemetry tracer provider and W3C trace context propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// ServiceName identifies this service in the traces.
+const ServiceName = "simplebank"
+
+// Supported exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout" // for local development
+	ExporterOTLP   = "otlp"
+)
+
+// Config selects where the spans are exported.
+type Config struct {
+	Exporter     string // one of the Exporter constants, ExporterNone if empty
+	OTLPEndpoint string // host:port of the OTLP gRPC collector, the exporter default if empty
+	OTLPInsecure bool   // disables TLS to the collector
+}
+
+// Setup registers the global tracer provider and propagator.
+// The returned function flushes the pending spans and must be called before the process exits.
+func Setup(ctx context.Context, config Config) (shutdown func(context.Context) error, err error) {
+	// Incoming trace context is honored even when nothing is exported,
+	// so the IDs still flow to the services this one calls
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(config.OTLPEndpoint))
+		}
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s exporter: %w", config.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		checker func(t *testing.T, shutdown func(context.Context) error, err error)
+	}{
+		{
+			name:   "Disabled",
+			config: Config{},
+			checker: func(t *testing.T, shutdown func(context.Context) error, err error) {
+				require.NoError(t, err)
+				require.NoError(t, shutdown(context.Background()))
+			},
+		},
+		{
+			name:   "Stdout",
+			config: Config{Exporter: ExporterStdout},
+			checker: func(t *testing.T, shutdown func(context.Context) error, err error) {
+				require.NoError(t, err)
+				require.NoError(t, shutdown(context.Background()))
+			},
+		},
+		{
+			name:   "Unsupported Exporter",
+			config: Config{Exporter: "jaeger"},
+			checker: func(t *testing.T, shutdown func(context.Context) error, err error) {
+				require.Error(t, err)
+				require.Nil(t, shutdown)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tc.config)
+			tc.checker(t, shutdown, err)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package transfer sends money between accounts on behalf of a user.
+// It holds the checks and the flow shared by the HTTP and gRPC APIs, which only translate
+// their requests and the returned errors.
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/apperr"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/fx"
+	"github.com/pawpaw2022/simplebank/metrics"
+)
+
+// Request is a transfer as sent by a client.
+// Its JSON encoding is hashed to tell the retries of an idempotency key from a different request,
+// so the fields and their tags must not change.
+type Request struct {
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"` // currency of the amount, must be the one of the from account
+}
+
+// CreateParams contains the input parameters of Create
+type CreateParams struct {
+	Request
+	Username       string // user sending the money, must own the from account
+	IdempotencyKey string // optional, retries with the same key get the original result back
+	Audit          db.AuditParams
+}
+
+// Service runs the transfers.
+type Service struct {
+	store db.Store
+	rates fx.RateProvider
+}
+
+// NewService creates a new Service.
+func NewService(store db.Store, rates fx.RateProvider) *Service {
+	return &Service{
+		store: store,
+		rates: rates,
+	}
+}
+
+// Create sends the money once the user and both accounts are checked.
+// The to account may hold another currency, the amount is converted in that case.
+// A retry of a completed request gets the stored result back before anything else is checked,
+// so it doesn't fail on a balance, account or rate that changed in between.
+// The outcome is observed in metrics.TransfersTotal, errors are apperr errors or database errors.
+func (s *Service) Create(ctx context.Context, arg CreateParams) (db.TransferTxResult, error) {
+	var idempotency *db.IdempotencyParams
+	if arg.IdempotencyKey != "" {
+		requestHash, err := HashRequest(arg.Request)
+		if err != nil {
+			return db.TransferTxResult{}, err
+		}
+
+		idempotency = &db.IdempotencyParams{
+			Username:    arg.Username,
+			Key:         arg.IdempotencyKey,
+			RequestHash: requestHash,
+		}
+
+		result, replayed, err := s.replay(ctx, *idempotency, arg.Currency)
+		if err != nil || replayed {
+			return result, err
+		}
+	}
+
+	if arg.FromAccountID == arg.ToAccountID {
+		return db.TransferTxResult{}, apperr.InvalidField("to_account_id", "must be different from from_account_id")
+	}
+
+	if err := s.requireVerifiedEmail(ctx, arg.Username); err != nil {
+		return db.TransferTxResult{}, err
+	}
+
+	fromAccount, err := s.getAccount(ctx, arg.FromAccountID)
+	if err != nil {
+		return db.TransferTxResult{}, err
+	}
+
+	if fromAccount.Currency != arg.Currency {
+		return db.TransferTxResult{}, apperr.Newf(apperr.CodeCurrencyMismatch, "accountID [%d] currency mismatch: %s vs %s", fromAccount.ID, fromAccount.Currency, arg.Currency)
+	}
+
+	if fromAccount.Owner != arg.Username {
+		return db.TransferTxResult{}, apperr.New(apperr.CodeForbidden, "from account doesn't belong to the authenticated user")
+	}
+
+	toAccount, err := s.getAccount(ctx, arg.ToAccountID)
+	if err != nil {
+		return db.TransferTxResult{}, err
+	}
+
+	audit := arg.Audit
+	txArg := db.ExchangeTransferTxParams{
+		TransferTxParams: db.TransferTxParams{
+			FromAccountID: arg.FromAccountID,
+			ToAccountID:   arg.ToAccountID,
+			Amount:        arg.Amount,
+			Idempotency:   idempotency,
+			Audit:         &audit,
+		},
+	}
+
+	if toAccount.Currency != fromAccount.Currency {
+		if err := s.convertAmount(ctx, &txArg, fromAccount.Currency, toAccount.Currency); err != nil {
+			return db.TransferTxResult{}, err
+		}
+	}
+
+	var result db.TransferTxResult
+	if txArg.ExchangeRate != "" {
+		result, err = s.store.ExchangeTransferTx(ctx, txArg)
+	} else {
+		result, err = s.store.TransferTx(ctx, txArg.TransferTxParams)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrInsufficientFunds):
+			metrics.ObserveTransfer(fromAccount.Currency, metrics.TransferInsufficientFunds)
+		case errors.Is(err, db.ErrIdempotencyKeyReused):
+			metrics.ObserveTransfer(fromAccount.Currency, metrics.TransferIdempotencyKeyReused)
+		default:
+			metrics.ObserveTransfer(fromAccount.Currency, metrics.TransferFailed)
+		}
+		return result, err
+	}
+
+	if result.Replayed {
+		metrics.ObserveTransfer(fromAccount.Currency, metrics.TransferReplayed)
+	} else {
+		metrics.ObserveTransfer(fromAccount.Currency, metrics.TransferSucceeded)
+	}
+
+	return result, nil
+}
+
+// replay looks up a request already made with the idempotency key.
+// The key is claimed again in the transfer transaction, which settles concurrent requests with the same key.
+func (s *Service) replay(ctx context.Context, arg db.IdempotencyParams, currency string) (result db.TransferTxResult, replayed bool, err error) {
+	stored, err := s.store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+		Username:       arg.Username,
+		IdempotencyKey: arg.Key,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return result, false, nil
+		}
+		return result, false, err
+	}
+
+	if stored.RequestHash != arg.RequestHash {
+		metrics.ObserveTransfer(currency, metrics.TransferIdempotencyKeyReused)
+		return result, false, db.ErrIdempotencyKeyReused
+	}
+
+	if err := json.Unmarshal(stored.Response, &result); err != nil {
+		return result, false, fmt.Errorf("cannot decode stored response: %w", err)
+	}
+	result.Replayed = true
+
+	metrics.ObserveTransfer(currency, metrics.TransferReplayed)
+	return result, true, nil
+}
+
+// HashRequest returns a hex encoded SHA-256 of the JSON encoded request
+func HashRequest(req Request) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// requireVerifiedEmail fails unless the user has verified the email address
+func (s *Service) requireVerifiedEmail(ctx context.Context, username string) error {
+	user, err := s.store.GetUser(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if !user.IsEmailVerified {
+		return apperr.New(apperr.CodeEmailNotVerified, "email address must be verified before sending money")
+	}
+	return nil
+}
+
+// getAccount gets an account taking part in a transfer
+func (s *Service) getAccount(ctx context.Context, accountID int64) (db.Account, error) {
+	account, err := s.store.GetAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			err = apperr.Wrap(err, apperr.CodeNotFound, fmt.Sprintf("account %d not found", accountID))
+		}
+		return account, err
+	}
+
+	return account, nil
+}
+
+// convertAmount quotes the exchange rate and sets the converted amount on the transfer
+func (s *Service) convertAmount(ctx context.Context, arg *db.ExchangeTransferTxParams, from string, to string) error {
+	quote, err := s.rates.Quote(ctx, from, to)
+	if err != nil {
+		if errors.Is(err, fx.ErrRateNotFound) {
+			metrics.ObserveTransfer(from, metrics.TransferRateNotFound)
+			err = apperr.Wrap(err, apperr.CodeRateNotFound, err.Error())
+		}
+		return err
+	}
+
+	toAmount, err := quote.Convert(arg.Amount)
+	if err != nil {
+		return err
+	}
+
+	if toAmount <= 0 {
+		message := fmt.Sprintf("%d %s is too small to convert to %s", arg.Amount, from, to)
+		return apperr.InvalidField("amount", message)
+	}
+
+	arg.ToAmount = toAmount
+	arg.ExchangeRate = quote.Rate
+	arg.RateQuotedAt = quote.QuotedAt
+	return nil
+}
@@ -0,0 +1,26 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRequest(t *testing.T) {
+	req := Request{
+		FromAccountID: 1,
+		ToAccountID:   2,
+		Amount:        10,
+		Currency:      "USD",
+	}
+
+	// Stored hashes must keep matching the retries of the same request
+	hash, err := HashRequest(req)
+	require.NoError(t, err)
+	require.Equal(t, "31a39c510ef95c9ad0e569295f4bb34b4a5dedea2eda5760330de78e76511eaa", hash)
+
+	req.Amount = 11
+	other, err := HashRequest(req)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other)
+}
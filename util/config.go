@@ -9,11 +9,47 @@ import (
 // Config is the application config
 // Use Viper to read from environment variables
 type Config struct {
-	DBDriver            string        `mapstructure:"DB_DRIVER"`
-	DBSource            string        `mapstructure:"DB_SOURCE"`
-	ServerAddress       string        `mapstructure:"SERVER_ADDRESS"`
-	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	DBSource              string        `mapstructure:"DB_SOURCE"`
+	ServerAddress         string        `mapstructure:"SERVER_ADDRESS"`
+	TrustedProxies        []string      `mapstructure:"TRUSTED_PROXIES"` // comma separated IPs or CIDRs allowed to set X-Forwarded-For, none if empty
+	GRPCServerAddress     string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	InternalAddress       string        `mapstructure:"INTERNAL_SERVER_ADDRESS"` // serves /metrics and the health probes, must not be exposed publicly
+	TokenSymmetricKey     string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	AccessTokenDuration   time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration  time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	FXRatesFile           string        `mapstructure:"FX_RATES_FILE"`    // cross-currency transfers are disabled if empty
+	FXRateMaxAge          time.Duration `mapstructure:"FX_RATE_MAX_AGE"`  // quotes older than this are rejected
+	LogLevel              string        `mapstructure:"LOG_LEVEL"`        // debug also logs every query, info if empty
+	TracingExporter       string        `mapstructure:"TRACING_EXPORTER"` // none, stdout or otlp
+	OTLPEndpoint          string        `mapstructure:"OTLP_ENDPOINT"`    // host:port of the OTLP gRPC collector
+	OTLPInsecure          bool          `mapstructure:"OTLP_INSECURE"`
+	MigrateOnStart        bool          `mapstructure:"MIGRATE_ON_START"`         // applies pending migrations before serving
+	ShutdownTimeout       time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`         // how long in-flight requests may take to finish on shutdown
+	HTTPReadHeaderTimeout time.Duration `mapstructure:"HTTP_READ_HEADER_TIMEOUT"` // how long a client may take to send the request headers
+	HTTPReadTimeout       time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`        // how long a client may take to send the whole request
+	TxMaxRetries          int           `mapstructure:"TX_MAX_RETRIES"`           // retries of a transaction after a deadlock, -1 disables them
+	TxRetryDelay          time.Duration `mapstructure:"TX_RETRY_DELAY"`           // base delay before a retry, doubled on every retry
+	TxRetryMaxDelay       time.Duration `mapstructure:"TX_RETRY_MAX_DELAY"`
+	PublicURL             string        `mapstructure:"PUBLIC_URL"`  // base URL of the HTTP server used in links sent to users
+	MailSender            string        `mapstructure:"MAIL_SENDER"` // memory, file or smtp
+	MailFromName          string        `mapstructure:"MAIL_FROM_NAME"`
+	MailFromAddress       string        `mapstructure:"MAIL_FROM_ADDRESS"`
+	MailDir               string        `mapstructure:"MAIL_DIR"` // where the file sender writes messages
+	SMTPHost              string        `mapstructure:"SMTP_HOST"`
+	SMTPPort              int           `mapstructure:"SMTP_PORT"`
+	SMTPUsername          string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword          string        `mapstructure:"SMTP_PASSWORD"`
+	WorkerConcurrency     int           `mapstructure:"WORKER_CONCURRENCY"`   // background tasks processed at the same time
+	WorkerPollInterval    time.Duration `mapstructure:"WORKER_POLL_INTERVAL"` // how often idle workers look for due tasks
+	WorkerRetryDelay      time.Duration `mapstructure:"WORKER_RETRY_DELAY"`   // base delay before a failed task is attempted again, doubled on every attempt
+	WorkerRetryMaxDelay   time.Duration `mapstructure:"WORKER_RETRY_MAX_DELAY"`
+	WorkerLockTimeout     time.Duration `mapstructure:"WORKER_LOCK_TIMEOUT"`   // how long a task attempt may take
+	LoginMaxAttempts      int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`    // failed logins of a username within the window locking it out
+	LoginMaxIPAttempts    int           `mapstructure:"LOGIN_MAX_IP_ATTEMPTS"` // failed logins from a client IP within the window locking it out
+	LoginAttemptWindow    time.Duration `mapstructure:"LOGIN_ATTEMPT_WINDOW"`  // how long a failed login counts
+	LoginLockoutDuration  time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginDelay            time.Duration `mapstructure:"LOGIN_DELAY"` // wait after the first failed login of a username, doubled on every failure
+	LoginMaxDelay         time.Duration `mapstructure:"LOGIN_MAX_DELAY"`
 }
 
 // LoadConfig loads the application config from file or environment variables
@@ -0,0 +1,8 @@
+package util
+
+// All roles a user can have
+const (
+	DepositorRole = "depositor"
+	BankerRole    = "banker"
+	AdminRole     = "admin"
+)
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// SecretCodeBytes is the entropy of the codes sent to users
+const SecretCodeBytes = 32
+
+// NewSecretCode returns a URL-safe random code read from crypto/rand,
+// unlike RandomString it is fit for secrets sent to users
+func NewSecretCode() (string, error) {
+	b := make([]byte, SecretCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate secret code: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecret returns the hex encoded sha256 of a secret, so it can be looked up without being stored.
+// Secrets from NewSecretCode carry enough entropy to not need a salt.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSecretCode(t *testing.T) {
+	code1, err := NewSecretCode()
+	require.NoError(t, err)
+
+	b, err := base64.RawURLEncoding.DecodeString(code1)
+	require.NoError(t, err)
+	require.Len(t, b, SecretCodeBytes)
+
+	code2, err := NewSecretCode()
+	require.NoError(t, err)
+	require.NotEqual(t, code1, code2)
+}
+
+func TestHashSecret(t *testing.T) {
+	code := RandomString(32)
+
+	hash := HashSecret(code)
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, HashSecret(code))
+	require.NotEqual(t, hash, HashSecret(code+"x"))
+	require.NotContains(t, hash, code)
+}
@@ -0,0 +1,135 @@
+// Package worker runs background tasks, such as sending emails, outside of the API requests.
+// Tasks are stored in the tasks table: a TaskDistributor enqueues them and a TaskProcessor runs them.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/logger"
+)
+
+// Queues a task can be distributed to
+const (
+	QueueCritical = "critical"
+	QueueDefault  = "default"
+	QueueLow      = "low"
+)
+
+// queuePriority orders the queues, the due tasks of a higher priority queue are always claimed first
+var queuePriority = map[string]int32{
+	QueueCritical: 10,
+	QueueDefault:  5,
+	QueueLow:      1,
+}
+
+// defaultMaxAttempts is used for tasks distributed without the MaxAttempts option
+const defaultMaxAttempts = 10
+
+// TaskDistributor enqueues tasks for the TaskProcessor.
+type TaskDistributor interface {
+	DistributeTaskSendVerifyEmail(ctx context.Context, payload *PayloadSendVerifyEmail, opts ...Option) error
+	DistributeTaskSendResetPassword(ctx context.Context, payload *PayloadSendResetPassword, opts ...Option) error
+}
+
+// Option changes how a task is distributed.
+type Option func(*taskOptions)
+
+type taskOptions struct {
+	queue       string
+	maxAttempts int
+	processIn   time.Duration
+	querier     db.Querier
+}
+
+// Queue distributes the task to the given queue instead of QueueDefault.
+func Queue(name string) Option {
+	return func(o *taskOptions) {
+		o.queue = name
+	}
+}
+
+// MaxAttempts sets how often the task is attempted before it is moved to the dead letters.
+func MaxAttempts(n int) Option {
+	return func(o *taskOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// ProcessIn delays the first attempt of the task.
+func ProcessIn(d time.Duration) Option {
+	return func(o *taskOptions) {
+		o.processIn = d
+	}
+}
+
+// Tx stores the task with the queries of a database transaction instead of the store,
+// so it is only processed once the transaction commits and is dropped if it rolls back.
+func Tx(q db.Querier) Option {
+	return func(o *taskOptions) {
+		o.querier = q
+	}
+}
+
+// PGTaskDistributor stores the tasks in the tasks table of the database.
+type PGTaskDistributor struct {
+	store db.Store
+}
+
+// NewPGTaskDistributor creates a new TaskDistributor.
+func NewPGTaskDistributor(store db.Store) TaskDistributor {
+	return &PGTaskDistributor{
+		store: store,
+	}
+}
+
+// distribute stores a task of the given type with its payload encoded in JSON
+func (d *PGTaskDistributor) distribute(ctx context.Context, taskType string, payload interface{}, opts []Option) error {
+	options := taskOptions{
+		queue:       QueueDefault,
+		maxAttempts: defaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	priority, ok := queuePriority[options.queue]
+	if !ok {
+		return fmt.Errorf("unknown queue %q", options.queue)
+	}
+	if options.maxAttempts < 1 {
+		return fmt.Errorf("max attempts must be at least 1, got %d", options.maxAttempts)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cannot marshal task payload: %w", err)
+	}
+
+	var querier db.Querier = d.store
+	if options.querier != nil {
+		querier = options.querier
+	}
+
+	task, err := querier.CreateTask(ctx, db.CreateTaskParams{
+		Type:        taskType,
+		Payload:     data,
+		Queue:       options.queue,
+		Priority:    priority,
+		MaxAttempts: int32(options.maxAttempts),
+		RunAt:       time.Now().Add(options.processIn),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create task: %w", err)
+	}
+
+	logger.FromContext(ctx).Info().
+		Int64("task_id", task.ID).
+		Str("type", task.Type).
+		Str("queue", task.Queue).
+		Msg("enqueued task")
+	return nil
+}
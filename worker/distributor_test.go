@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDistributeTask(t *testing.T) {
+	payload := &PayloadSendVerifyEmail{VerifyEmailID: 42}
+
+	testCases := []struct {
+		name       string
+		opts       []Option
+		buildStubs func(t *testing.T, store *mockdb.MockStore)
+		checker    func(t *testing.T, err error)
+	}{
+		{
+			name: "Defaults",
+			buildStubs: func(t *testing.T, store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateTask(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateTaskParams) (db.Task, error) {
+						require.Equal(t, TaskSendVerifyEmail, arg.Type)
+						require.JSONEq(t, `{"verify_email_id":42}`, string(arg.Payload))
+						require.Equal(t, QueueDefault, arg.Queue)
+						require.Equal(t, queuePriority[QueueDefault], arg.Priority)
+						require.Equal(t, int32(defaultMaxAttempts), arg.MaxAttempts)
+						require.WithinDuration(t, time.Now(), arg.RunAt, time.Second)
+						return db.Task{ID: 1, Type: arg.Type, Queue: arg.Queue}, nil
+					})
+			},
+			checker: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Options",
+			opts: []Option{Queue(QueueCritical), MaxAttempts(3), ProcessIn(time.Minute)},
+			buildStubs: func(t *testing.T, store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateTask(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateTaskParams) (db.Task, error) {
+						require.Equal(t, QueueCritical, arg.Queue)
+						require.Equal(t, queuePriority[QueueCritical], arg.Priority)
+						require.Greater(t, arg.Priority, queuePriority[QueueDefault])
+						require.Equal(t, int32(3), arg.MaxAttempts)
+						require.WithinDuration(t, time.Now().Add(time.Minute), arg.RunAt, time.Second)
+						return db.Task{ID: 1, Type: arg.Type, Queue: arg.Queue}, nil
+					})
+			},
+			checker: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Unknown Queue",
+			opts: []Option{Queue("unknown")},
+			buildStubs: func(t *testing.T, store *mockdb.MockStore) {
+				store.EXPECT().CreateTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "Invalid Max Attempts",
+			opts: []Option{MaxAttempts(0)},
+			buildStubs: func(t *testing.T, store *mockdb.MockStore) {
+				store.EXPECT().CreateTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "Store Error",
+			buildStubs: func(t *testing.T, store *mockdb.MockStore) {
+				store.EXPECT().CreateTask(gomock.Any(), gomock.Any()).Times(1).Return(db.Task{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(t, store)
+
+			distributor := NewPGTaskDistributor(store)
+			err := distributor.DistributeTaskSendVerifyEmail(context.Background(), payload, tc.opts...)
+			tc.checker(t, err)
+		})
+	}
+}
+
+func TestDistributeTaskTx(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	tx := mockdb.NewMockStore(ctrl)
+
+	// the task is stored with the queries of the transaction only
+	store.EXPECT().CreateTask(gomock.Any(), gomock.Any()).Times(0)
+	tx.EXPECT().
+		CreateTask(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateTaskParams) (db.Task, error) {
+			require.Equal(t, TaskSendVerifyEmail, arg.Type)
+			return db.Task{ID: 1, Type: arg.Type, Queue: arg.Queue}, nil
+		})
+
+	distributor := NewPGTaskDistributor(store)
+	err := distributor.DistributeTaskSendVerifyEmail(context.Background(), &PayloadSendVerifyEmail{VerifyEmailID: 42}, Tx(tx))
+	require.NoError(t, err)
+}
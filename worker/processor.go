@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/pawpaw2022/simplebank/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Processor defaults, used for the Config fields left at zero
+const (
+	defaultConcurrency   = 4
+	defaultPollInterval  = time.Second
+	defaultRetryDelay    = 5 * time.Second
+	defaultRetryMaxDelay = 10 * time.Minute
+	defaultLockTimeout   = time.Minute
+)
+
+// recordTimeout bounds the query recording the outcome of a task.
+// It gets its own context, so a handler that used up the lock timeout still has its outcome recorded.
+const recordTimeout = 5 * time.Second
+
+// ErrSkipRetry marks the errors attempting the task again cannot fix, such as an invalid payload.
+// The task is moved to the dead letters at once.
+var ErrSkipRetry = errors.New("skip retry")
+
+// Config tunes the TaskProcessor.
+type Config struct {
+	Concurrency   int           // tasks processed at the same time
+	PollInterval  time.Duration // how long an idle worker waits before looking for due tasks again
+	RetryDelay    time.Duration // base delay before a failed task is attempted again, doubled on every attempt
+	RetryMaxDelay time.Duration // upper bound of the retry delay
+	LockTimeout   time.Duration // how long an attempt may take, the task is claimed again after that
+	PublicURL     string        // base URL of the HTTP API used in links sent to users
+}
+
+// withDefaults fills the fields left at zero with the defaults
+func (c Config) withDefaults() Config {
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = defaultRetryDelay
+	}
+	if c.RetryMaxDelay <= 0 {
+		c.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = defaultLockTimeout
+	}
+	return c
+}
+
+// backoff returns the delay before the attempt following the given failed one, starting at 1.
+// Half of the delay is random, so tasks that failed together are not attempted again together.
+// jitter returns a random number in [0, n), such as rand.Int63n.
+func (c Config) backoff(attempt int32, jitter func(n int64) int64) time.Duration {
+	delay := c.RetryDelay
+	for i := int32(1); i < attempt && delay < c.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.RetryMaxDelay {
+		delay = c.RetryMaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(jitter(int64(half)+1))
+}
+
+// TaskProcessor runs the distributed tasks.
+type TaskProcessor interface {
+	// Run processes tasks until the context is cancelled, then waits for the tasks in progress.
+	Run(ctx context.Context) error
+}
+
+// taskHandler runs a task with its JSON payload
+type taskHandler func(ctx context.Context, payload []byte) error
+
+// PGTaskProcessor claims the due tasks from the tasks table.
+// Every task is processed at least once: a task whose outcome could not be recorded is claimed again
+// once its lock expires, so handlers must tolerate running twice.
+type PGTaskProcessor struct {
+	store    db.Store
+	mailer   mail.Sender
+	config   Config
+	handlers map[string]taskHandler
+}
+
+// NewPGTaskProcessor creates a new TaskProcessor.
+// The fields of config left at zero are set to the defaults.
+func NewPGTaskProcessor(store db.Store, mailer mail.Sender, config Config) TaskProcessor {
+	processor := &PGTaskProcessor{
+		store:  store,
+		mailer: mailer,
+		config: config.withDefaults(),
+	}
+
+	processor.handlers = map[string]taskHandler{
+		TaskSendVerifyEmail:   processor.processTaskSendVerifyEmail,
+		TaskSendResetPassword: processor.processTaskSendResetPassword,
+	}
+
+	return processor
+}
+
+func (processor *PGTaskProcessor) Run(ctx context.Context) error {
+	log.Info().Int("concurrency", processor.config.Concurrency).Msg("start task processor")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		processor.reapExpired(ctx)
+	}()
+
+	for i := 0; i < processor.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			processor.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+	log.Info().Msg("task processor stopped")
+	return nil
+}
+
+// work processes tasks until the context is cancelled.
+// It only waits for the poll interval once no task is due.
+func (processor *PGTaskProcessor) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := processor.processNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("cannot claim task")
+		}
+		if claimed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(processor.config.PollInterval):
+		}
+	}
+}
+
+// reapExpired moves the tasks abandoned on their last attempt to the dead letters until the context is cancelled.
+// ClaimTask skips them, so they would stay running forever otherwise.
+func (processor *PGTaskProcessor) reapExpired(ctx context.Context) {
+	ticker := time.NewTicker(processor.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tasks, err := processor.store.DeadLetterExpiredTasks(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("cannot dead-letter expired tasks")
+			}
+			continue
+		}
+
+		for _, task := range tasks {
+			metrics.TasksTotal.WithLabelValues(task.Type, metrics.TaskDead).Inc()
+			log.Error().
+				Int64("task_id", task.ID).
+				Str("type", task.Type).
+				Int32("attempt", task.Attempts).
+				Msg("task lock expired on the last attempt, moved to the dead letters")
+		}
+	}
+}
+
+// processNext claims the next due task and processes it, it reports whether a task was claimed
+func (processor *PGTaskProcessor) processNext(ctx context.Context) (bool, error) {
+	task, err := processor.store.ClaimTask(ctx, time.Now().Add(processor.config.LockTimeout))
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	processor.process(task)
+	return true, nil
+}
+
+// process runs the handler of a claimed task and records the outcome.
+// The handler doesn't get the context of Run, so a shutdown doesn't interrupt a task halfway,
+// but it is bounded by the lock timeout so the task is not claimed again while it runs.
+// The outcome is recorded with a context of its own, which the handler cannot have used up.
+func (processor *PGTaskProcessor) process(task db.Task) {
+	l := log.With().
+		Int64("task_id", task.ID).
+		Str("type", task.Type).
+		Int32("attempt", task.Attempts).
+		Logger()
+
+	handlerCtx, cancel := context.WithTimeout(context.Background(), processor.config.LockTimeout)
+	err := processor.handle(handlerCtx, task)
+	cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	if err == nil {
+		metrics.TasksTotal.WithLabelValues(task.Type, metrics.TaskSucceeded).Inc()
+		l.Info().Msg("processed task")
+
+		err = processor.store.CompleteTask(ctx, db.CompleteTaskParams{
+			ID:       task.ID,
+			Attempts: task.Attempts,
+		})
+		if err != nil {
+			l.Error().Err(err).Msg("cannot complete task")
+		}
+		return
+	}
+
+	if errors.Is(err, ErrSkipRetry) || task.Attempts >= task.MaxAttempts {
+		metrics.TasksTotal.WithLabelValues(task.Type, metrics.TaskDead).Inc()
+		l.Error().Err(err).Msg("task failed, moved to the dead letters")
+
+		err = processor.store.DeadLetterTask(ctx, db.DeadLetterTaskParams{
+			ID:        task.ID,
+			Attempts:  task.Attempts,
+			LastError: err.Error(),
+		})
+		if err != nil {
+			l.Error().Err(err).Msg("cannot dead-letter task")
+		}
+		return
+	}
+
+	delay := processor.config.backoff(task.Attempts, rand.Int63n)
+	metrics.TasksTotal.WithLabelValues(task.Type, metrics.TaskRetried).Inc()
+	l.Warn().Err(err).Dur("delay", delay).Msg("task failed, retrying")
+
+	err = processor.store.RetryTask(ctx, db.RetryTaskParams{
+		ID:        task.ID,
+		Attempts:  task.Attempts,
+		RunAt:     time.Now().Add(delay),
+		LastError: err.Error(),
+	})
+	if err != nil {
+		l.Error().Err(err).Msg("cannot retry task")
+	}
+}
+
+// handle runs the handler of the task type
+func (processor *PGTaskProcessor) handle(ctx context.Context, task db.Task) error {
+	handler, ok := processor.handlers[task.Type]
+	if !ok {
+		return fmt.Errorf("unknown task type %q: %w", task.Type, ErrSkipRetry)
+	}
+	return handler(ctx, task.Payload)
+}
@@ -0,0 +1,309 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const testTaskType = "task:test"
+
+func newTestProcessor(store db.Store, mailer mail.Sender) *PGTaskProcessor {
+	return NewPGTaskProcessor(store, mailer, Config{PublicURL: "http://localhost:8080"}).(*PGTaskProcessor)
+}
+
+type eqRetryTaskParamsMatcher struct {
+	arg db.RetryTaskParams
+}
+
+func (e eqRetryTaskParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.RetryTaskParams)
+	if !ok {
+		return false
+	}
+
+	// The task must wait for the backoff delay before running again
+	if !arg.RunAt.After(time.Now()) {
+		return false
+	}
+
+	e.arg.RunAt = arg.RunAt
+	return e.arg == arg
+}
+
+func (e eqRetryTaskParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v with a run_at in the future", e.arg)
+}
+
+func EqRetryTaskParams(arg db.RetryTaskParams) gomock.Matcher {
+	return eqRetryTaskParamsMatcher{arg}
+}
+
+func TestProcessTask(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+
+	testCases := []struct {
+		name       string
+		task       db.Task
+		handlerErr error
+		buildStubs func(store *mockdb.MockStore, task db.Task)
+	}{
+		{
+			name: "Succeeded",
+			task: db.Task{ID: 1, Type: testTaskType, Attempts: 1, MaxAttempts: 3},
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				arg := db.CompleteTaskParams{ID: task.ID, Attempts: task.Attempts}
+				store.EXPECT().CompleteTask(gomock.Any(), gomock.Eq(arg)).Times(1).Return(nil)
+			},
+		},
+		{
+			name:       "Retried",
+			task:       db.Task{ID: 2, Type: testTaskType, Attempts: 2, MaxAttempts: 3},
+			handlerErr: handlerErr,
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				arg := db.RetryTaskParams{ID: task.ID, Attempts: task.Attempts, LastError: handlerErr.Error()}
+				store.EXPECT().RetryTask(gomock.Any(), EqRetryTaskParams(arg)).Times(1).Return(nil)
+				store.EXPECT().DeadLetterTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name:       "Max Attempts",
+			task:       db.Task{ID: 3, Type: testTaskType, Attempts: 3, MaxAttempts: 3},
+			handlerErr: handlerErr,
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				arg := db.DeadLetterTaskParams{ID: task.ID, Attempts: task.Attempts, LastError: handlerErr.Error()}
+				store.EXPECT().DeadLetterTask(gomock.Any(), gomock.Eq(arg)).Times(1).Return(nil)
+				store.EXPECT().RetryTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name:       "Skip Retry",
+			task:       db.Task{ID: 4, Type: testTaskType, Attempts: 1, MaxAttempts: 3},
+			handlerErr: fmt.Errorf("invalid payload: %w", ErrSkipRetry),
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				store.EXPECT().DeadLetterTask(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().RetryTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name: "Unknown Type",
+			task: db.Task{ID: 5, Type: "task:unknown", Attempts: 1, MaxAttempts: 3},
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				store.EXPECT().DeadLetterTask(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().RetryTask(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name:       "Store Error",
+			task:       db.Task{ID: 6, Type: testTaskType, Attempts: 1, MaxAttempts: 3},
+			handlerErr: handlerErr,
+			buildStubs: func(store *mockdb.MockStore, task db.Task) {
+				// The task is claimed again once its lock expires
+				store.EXPECT().RetryTask(gomock.Any(), gomock.Any()).Times(1).Return(sql.ErrConnDone)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store, tc.task)
+
+			processor := newTestProcessor(store, mail.NewMemorySender())
+			processor.handlers[testTaskType] = func(ctx context.Context, payload []byte) error {
+				return tc.handlerErr
+			}
+
+			processor.process(tc.task)
+		})
+	}
+}
+
+func TestProcessRecordsAfterLockTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	processor := NewPGTaskProcessor(store, mail.NewMemorySender(), Config{
+		LockTimeout: 10 * time.Millisecond,
+	}).(*PGTaskProcessor)
+
+	processor.handlers[testTaskType] = func(ctx context.Context, payload []byte) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// The handler used up the lock timeout, recording its outcome doesn't
+	store.EXPECT().
+		RetryTask(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, arg db.RetryTaskParams) error {
+			require.NoError(t, ctx.Err())
+			require.Equal(t, context.DeadlineExceeded.Error(), arg.LastError)
+			return nil
+		})
+
+	processor.process(db.Task{ID: 1, Type: testTaskType, Attempts: 1, MaxAttempts: 3})
+}
+
+func TestReapExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	processor := NewPGTaskProcessor(store, mail.NewMemorySender(), Config{
+		PollInterval: 10 * time.Millisecond,
+	}).(*PGTaskProcessor)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Errors are logged and the next tick tries again
+	expired := []db.Task{{ID: 1, Type: testTaskType, Status: "dead", Attempts: 3, MaxAttempts: 3}}
+	gomock.InOrder(
+		store.EXPECT().DeadLetterExpiredTasks(gomock.Any()).Times(1).Return(nil, sql.ErrConnDone),
+		store.EXPECT().DeadLetterExpiredTasks(gomock.Any()).Times(1).Return(expired, nil),
+		store.EXPECT().
+			DeadLetterExpiredTasks(gomock.Any()).
+			AnyTimes().
+			DoAndReturn(func(context.Context) ([]db.Task, error) {
+				cancel()
+				return []db.Task{}, nil
+			}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		processor.reapExpired(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reaper did not stop")
+	}
+}
+
+func TestProcessNext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	processor := newTestProcessor(store, mail.NewMemorySender())
+
+	var processed []byte
+	processor.handlers[testTaskType] = func(ctx context.Context, payload []byte) error {
+		processed = payload
+		return nil
+	}
+
+	// No task is due
+	store.EXPECT().ClaimTask(gomock.Any(), gomock.Any()).Times(1).Return(db.Task{}, db.ErrRecordNotFound)
+	claimed, err := processor.processNext(context.Background())
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	// The task is locked for the lock timeout
+	task := db.Task{ID: 1, Type: testTaskType, Payload: []byte(`{"id":1}`), Attempts: 1, MaxAttempts: 3}
+	store.EXPECT().
+		ClaimTask(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, lockedUntil time.Time) (db.Task, error) {
+			require.WithinDuration(t, time.Now().Add(defaultLockTimeout), lockedUntil, time.Second)
+			return task, nil
+		})
+	store.EXPECT().CompleteTask(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+
+	claimed, err = processor.processNext(context.Background())
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, task.Payload, processed)
+
+	// Claim errors are reported
+	store.EXPECT().ClaimTask(gomock.Any(), gomock.Any()).Times(1).Return(db.Task{}, sql.ErrConnDone)
+	claimed, err = processor.processNext(context.Background())
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.False(t, claimed)
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().ClaimTask(gomock.Any(), gomock.Any()).AnyTimes().Return(db.Task{}, db.ErrRecordNotFound)
+	store.EXPECT().DeadLetterExpiredTasks(gomock.Any()).AnyTimes().Return([]db.Task{}, nil)
+
+	processor := NewPGTaskProcessor(store, mail.NewMemorySender(), Config{
+		Concurrency:  2,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- processor.Run(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("processor did not stop")
+	}
+}
+
+func TestTaskBackoff(t *testing.T) {
+	config := Config{
+		RetryDelay:    10 * time.Second,
+		RetryMaxDelay: 50 * time.Second,
+	}
+	rnd := rand.New(rand.NewSource(1))
+
+	testCases := []struct {
+		attempt int32
+		max     time.Duration
+	}{
+		{attempt: 1, max: 10 * time.Second},
+		{attempt: 2, max: 20 * time.Second},
+		{attempt: 3, max: 40 * time.Second},
+		{attempt: 4, max: 50 * time.Second},
+		{attempt: 20, max: 50 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		for i := 0; i < 100; i++ {
+			delay := config.backoff(tc.attempt, rnd.Int63n)
+			require.GreaterOrEqual(t, delay, tc.max/2)
+			require.LessOrEqual(t, delay, tc.max)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	config := Config{}.withDefaults()
+	require.Equal(t, defaultConcurrency, config.Concurrency)
+	require.Equal(t, defaultPollInterval, config.PollInterval)
+	require.Equal(t, defaultRetryDelay, config.RetryDelay)
+	require.Equal(t, defaultRetryMaxDelay, config.RetryMaxDelay)
+	require.Equal(t, defaultLockTimeout, config.LockTimeout)
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/pawpaw2022/simplebank/util"
+)
+
+const TaskSendResetPassword = "task:send_reset_password"
+
+// PayloadSendResetPassword identifies the account whose password should be reset.
+// The token is created by the task, so it never appears in the tasks table.
+type PayloadSendResetPassword struct {
+	Email string `json:"email"`
+}
+
+func (distributor *PGTaskDistributor) DistributeTaskSendResetPassword(ctx context.Context, payload *PayloadSendResetPassword, opts ...Option) error {
+	return distributor.distribute(ctx, TaskSendResetPassword, payload, opts)
+}
+
+// processTaskSendResetPassword creates a password reset token and sends it to the user with the email.
+// Nothing is sent to an unknown email, the API answers the same either way so it doesn't reveal the users.
+func (processor *PGTaskProcessor) processTaskSendResetPassword(ctx context.Context, data []byte) error {
+	var payload PayloadSendResetPassword
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %v: %w", err, ErrSkipRetry)
+	}
+
+	user, err := processor.store.GetUserByEmail(ctx, payload.Email)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("cannot get user: %w", err)
+	}
+
+	token, err := util.NewSecretCode()
+	if err != nil {
+		return err
+	}
+
+	_, err = processor.store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: util.HashSecret(token),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create password reset token: %w", err)
+	}
+
+	msg, err := mail.ResetPassword(user.Email, user.FullName, token)
+	if err != nil {
+		return fmt.Errorf("cannot render reset password email: %v: %w", err, ErrSkipRetry)
+	}
+
+	if err := processor.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("cannot send reset password email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// resetTokenPattern extracts the token from the reset password email
+var resetTokenPattern = regexp.MustCompile(`<b>([A-Za-z0-9_-]+)</b>`)
+
+func TestProcessTaskSendResetPassword(t *testing.T) {
+	user := db.User{
+		Username: util.RandomOwner(),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	payload, err := json.Marshal(PayloadSendResetPassword{Email: user.Email})
+	require.NoError(t, err)
+
+	var stored db.CreatePasswordResetTokenParams
+
+	testCases := []struct {
+		name       string
+		payload    []byte
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, err error, messages []mail.Message)
+	}{
+		{
+			name:    "OK",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Eq(user.Email)).Times(1).Return(user, nil)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+						stored = arg
+						return db.PasswordResetToken{Username: arg.Username, TokenHash: arg.TokenHash}, nil
+					})
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.NoError(t, err)
+				require.Len(t, messages, 1)
+				require.Equal(t, []string{user.Email}, messages[0].To)
+
+				// only the hash of the emailed token is stored
+				match := resetTokenPattern.FindStringSubmatch(messages[0].HTML)
+				require.Len(t, match, 2)
+				require.Equal(t, user.Username, stored.Username)
+				require.Equal(t, util.HashSecret(match[1]), stored.TokenHash)
+			},
+		},
+		{
+			name:    "Unknown Email",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Eq(user.Email)).Times(1).Return(db.User{}, db.ErrRecordNotFound)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.NoError(t, err)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Get User Error",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.NotErrorIs(t, err, ErrSkipRetry)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Create Token Error",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).Times(1).Return(db.PasswordResetToken{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Invalid Payload",
+			payload: []byte(`{"email":1}`),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, ErrSkipRetry)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			mailer := mail.NewMemorySender()
+			processor := newTestProcessor(store, mailer)
+
+			err := processor.processTaskSendResetPassword(context.Background(), tc.payload)
+			tc.checker(t, err, mailer.Messages())
+		})
+	}
+}
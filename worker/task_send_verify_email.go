@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pawpaw2022/simplebank/mail"
+)
+
+const TaskSendVerifyEmail = "task:send_verify_email"
+
+// PayloadSendVerifyEmail identifies the verification code to send
+type PayloadSendVerifyEmail struct {
+	VerifyEmailID int64 `json:"verify_email_id"`
+}
+
+func (distributor *PGTaskDistributor) DistributeTaskSendVerifyEmail(ctx context.Context, payload *PayloadSendVerifyEmail, opts ...Option) error {
+	return distributor.distribute(ctx, TaskSendVerifyEmail, payload, opts)
+}
+
+// processTaskSendVerifyEmail sends the link verifying the email address of a new user.
+// The task is distributed within the transaction creating the code, so the code is committed with it.
+func (processor *PGTaskProcessor) processTaskSendVerifyEmail(ctx context.Context, data []byte) error {
+	var payload PayloadSendVerifyEmail
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %v: %w", err, ErrSkipRetry)
+	}
+
+	verifyEmail, err := processor.store.GetVerifyEmail(ctx, payload.VerifyEmailID)
+	if err != nil {
+		return fmt.Errorf("cannot get verify email: %w", err)
+	}
+
+	// The user already opened the link of an earlier attempt
+	if verifyEmail.IsUsed {
+		return nil
+	}
+
+	user, err := processor.store.GetUser(ctx, verifyEmail.Username)
+	if err != nil {
+		return fmt.Errorf("cannot get user: %w", err)
+	}
+
+	link := mail.VerifyEmailLink(processor.config.PublicURL, verifyEmail.ID, verifyEmail.SecretCode)
+	msg, err := mail.VerifyEmail(verifyEmail.Email, user.FullName, link)
+	if err != nil {
+		return fmt.Errorf("cannot render verify email: %v: %w", err, ErrSkipRetry)
+	}
+
+	if err := processor.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("cannot send verify email: %w", err)
+	}
+	return nil
+}
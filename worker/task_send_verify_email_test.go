@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	mockdb "github.com/pawpaw2022/simplebank/db/mock"
+	db "github.com/pawpaw2022/simplebank/db/postgresql"
+	"github.com/pawpaw2022/simplebank/mail"
+	"github.com/pawpaw2022/simplebank/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestProcessTaskSendVerifyEmail(t *testing.T) {
+	user := db.User{
+		Username: util.RandomOwner(),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	verifyEmail := db.VerifyEmail{
+		ID:         util.RandomInt(1, 1000),
+		Username:   user.Username,
+		Email:      user.Email,
+		SecretCode: util.RandomString(32),
+	}
+	payload, err := json.Marshal(PayloadSendVerifyEmail{VerifyEmailID: verifyEmail.ID})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		payload    []byte
+		buildStubs func(store *mockdb.MockStore)
+		checker    func(t *testing.T, err error, messages []mail.Message)
+	}{
+		{
+			name:    "OK",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetVerifyEmail(gomock.Any(), gomock.Eq(verifyEmail.ID)).Times(1).Return(verifyEmail, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.NoError(t, err)
+				require.Len(t, messages, 1)
+				require.Equal(t, []string{user.Email}, messages[0].To)
+
+				link := mail.VerifyEmailLink("http://localhost:8080", verifyEmail.ID, verifyEmail.SecretCode)
+				expected, err := mail.VerifyEmail(user.Email, user.FullName, link)
+				require.NoError(t, err)
+				require.Equal(t, expected.HTML, messages[0].HTML)
+			},
+		},
+		{
+			name:    "Already Used",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				usedVerifyEmail := verifyEmail
+				usedVerifyEmail.IsUsed = true
+
+				store.EXPECT().GetVerifyEmail(gomock.Any(), gomock.Eq(verifyEmail.ID)).Times(1).Return(usedVerifyEmail, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.NoError(t, err)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Not Committed Yet",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetVerifyEmail(gomock.Any(), gomock.Eq(verifyEmail.ID)).Times(1).Return(db.VerifyEmail{}, db.ErrRecordNotFound)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, db.ErrRecordNotFound)
+				require.NotErrorIs(t, err, ErrSkipRetry)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Get User Error",
+			payload: payload,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetVerifyEmail(gomock.Any(), gomock.Eq(verifyEmail.ID)).Times(1).Return(verifyEmail, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Empty(t, messages)
+			},
+		},
+		{
+			name:    "Invalid Payload",
+			payload: []byte(`{"verify_email_id":"abc"}`),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetVerifyEmail(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checker: func(t *testing.T, err error, messages []mail.Message) {
+				require.ErrorIs(t, err, ErrSkipRetry)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			mailer := mail.NewMemorySender()
+			processor := newTestProcessor(store, mailer)
+
+			err := processor.processTaskSendVerifyEmail(context.Background(), tc.payload)
+			tc.checker(t, err, mailer.Messages())
+		})
+	}
+}